@@ -5,10 +5,9 @@ package cloud
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log"
-	"math"
+	"regexp"
 	"sync"
 	"time"
 
@@ -18,6 +17,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -46,20 +46,27 @@ const (
 	accessDeniedErrorCode = "AccessDenied"
 	unauthorizedErrorCode = "UnauthorizedOperation"
 	notFoundErrorOcde     = "NotFound"
-	requestLimitErrorCode = "RequestLimitExceeded"
 
 	snapshotIDFilterName = "block-device-mapping.snapshot-id"
 
-	awsMaxRequestRetries = 6
+	awsPermissionGroupAll = "all"
+	awsUnknownVolumeID    = "vol-ffffffff"
 )
 
 var (
-	instanceStateFilterName = "instance-state-name"
-	instanceStateRunning    = ec2.InstanceStateNameRunning
+	instanceStateFilterName     = "instance-state-name"
+	instanceStatesNotTerminated = []string{
+		ec2.InstanceStateNamePending,
+		ec2.InstanceStateNameRunning,
+		ec2.InstanceStateNameStopping,
+		ec2.InstanceStateNameStopped,
+	}
 
-	awsOwnerIDSelfValue = "self"
+	// The state transition reason contains the time of the transition,
+	// e.g. "User initiated (2018-03-27 19:27:01 GMT)"
+	stateTransitionTimeRegexp = regexp.MustCompile(`\((\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}) GMT\)`)
 
-	errAWSRequestLimit = errors.New("aws request limit hit")
+	awsOwnerIDSelfValue = "self"
 )
 
 func (m *awsResourceManager) InstancesPerAccount() map[string][]Instance {
@@ -176,6 +183,7 @@ func (m *awsResourceManager) AllResourcesPerAccount() map[string]*ResourceCollec
 			if err != nil {
 				log.Printf("Volume error when getting all resources in %s", account)
 				handleAWSAccessDenied(account, err)
+				result.VolumesIncomplete = true
 			}
 			result.Volumes = append(result.Volumes, volumes...)
 			wg.Done()
@@ -190,7 +198,7 @@ func (m *awsResourceManager) AllResourcesPerAccount() map[string]*ResourceCollec
 
 func (m *awsResourceManager) BucketsPerAccount() map[string][]Bucket {
 	log.Println("Getting all buckets in all accounts")
-	sess := session.Must(session.NewSession())
+	sess := NewAWSSession()
 	resultMap := make(map[string][]Bucket)
 	var resultMutext sync.Mutex
 	forEachAccount(m.accounts, sess, func(account string, cred *credentials.Credentials) {
@@ -257,11 +265,13 @@ func (m *awsResourceManager) BucketsPerAccount() map[string][]Bucket {
 							location:     region,
 							id:           *bu.Name,
 							creationTime: *bu.CreationDate,
+							public:       isS3BucketPublic(bucketClient, *bu.Name),
 							tags:         tags,
 						},
 						lastModified: lastMod,
 						objectCount:  count,
 						totalSizeGB:  float64(size) / gbDivider,
+						encrypted:    isS3BucketEncrypted(bucketClient, *bu.Name),
 					}}
 					buckChan <- &buck
 				}(bu, buckChan)
@@ -279,6 +289,46 @@ func (m *awsResourceManager) BucketsPerAccount() map[string][]Bucket {
 	return resultMap
 }
 
+// isS3BucketPublic checks if either the policy or the ACL of a
+// bucket grants access to everyone
+func isS3BucketPublic(client *s3.S3, bucketName string) bool {
+	status, err := client.GetBucketPolicyStatus(&s3.GetBucketPolicyStatusInput{
+		Bucket: aws.String(bucketName),
+	})
+	// A bucket without a policy will return an error, which is fine
+	policyPublic := err == nil && status.PolicyStatus != nil && aws.BoolValue(status.PolicyStatus.IsPublic)
+	if policyPublic {
+		return true
+	}
+	acl, err := client.GetBucketAcl(&s3.GetBucketAclInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		log.Printf("Could not get ACL for bucket %s: %s", bucketName, err)
+		return false
+	}
+	granteeURIs := []string{}
+	for _, grant := range acl.Grants {
+		if grant.Grantee != nil && grant.Grantee.URI != nil {
+			granteeURIs = append(granteeURIs, *grant.Grantee.URI)
+		}
+	}
+	return isS3BucketExposed(policyPublic, granteeURIs)
+}
+
+// isS3BucketEncrypted checks if a bucket has default encryption
+// enabled for new objects
+func isS3BucketEncrypted(client *s3.S3, bucketName string) bool {
+	encryption, err := client.GetBucketEncryption(&s3.GetBucketEncryptionInput{
+		Bucket: aws.String(bucketName),
+	})
+	// A bucket without default encryption will return an error
+	if err != nil {
+		return false
+	}
+	return encryption.ServerSideEncryptionConfiguration != nil && len(encryption.ServerSideEncryptionConfiguration.Rules) > 0
+}
+
 func (m *awsResourceManager) CleanupInstances(instances []Instance) error {
 	return cleanupInstances(instances)
 }
@@ -299,22 +349,35 @@ func (m *awsResourceManager) CleanupBuckets(buckets []Bucket) error {
 	return cleanupBuckets(buckets)
 }
 
-// getAWSInstances will get all running instances using an already
-// set-up client for a specific credential and region.
+// getAWSInstances will get all instances that are not terminated using
+// an already set-up client for a specific credential and region.
 func getAWSInstances(account string, client *ec2.EC2) ([]Instance, error) {
-	// We're only interested in running instances
+	// Stopped instances still cost money, so include everything
+	// that isn't terminated
 	input := &ec2.DescribeInstancesInput{
 		Filters: []*ec2.Filter{&ec2.Filter{
 			Name:   aws.String(instanceStateFilterName),
-			Values: aws.StringSlice([]string{instanceStateRunning})}},
+			Values: aws.StringSlice(instanceStatesNotTerminated)}},
 	}
 	awsReservations, err := client.DescribeInstances(input)
 	if err != nil {
 		return nil, err
 	}
 	result := []Instance{}
+	attachedVolumes, err := getAWSAttachedVolumes(account, client)
+	if err != nil {
+		log.Printf("Could not determine attached volumes in %s:\n%s\n", account, err)
+	}
+	openGroups, err := getOpenSecurityGroups(client)
+	if err != nil {
+		log.Printf("Could not determine open security groups in %s:\n%s\n", account, err)
+	}
 	for _, reservation := range awsReservations.Reservations {
 		for _, instance := range reservation.Instances {
+			// An instance is only publicly exposed if it has a public IP and
+			// a security group that allows traffic from anywhere. If the security
+			// groups couldn't be determined, assume the worst.
+			public := instance.PublicIpAddress != nil && (openGroups == nil || hasOpenSecurityGroup(instance.SecurityGroups, openGroups))
 			inst := awsInstance{baseInstance{
 				baseResource: baseResource{
 					csp:          AWS,
@@ -322,9 +385,12 @@ func getAWSInstances(account string, client *ec2.EC2) ([]Instance, error) {
 					id:           *instance.InstanceId,
 					location:     *client.Config.Region,
 					creationTime: *instance.LaunchTime,
-					public:       instance.PublicIpAddress != nil,
+					public:       public,
 					tags:         convertAWSTags(instance.Tags)},
-				instanceType: *instance.InstanceType,
+				instanceType:        *instance.InstanceType,
+				state:               convertAWSInstanceState(*instance.State.Name),
+				stateTransitionTime: awsStateTransitionTime(instance),
+				attachedVolumes:     attachedVolumes[*instance.InstanceId],
 			}}
 			result = append(result, &inst)
 		}
@@ -357,18 +423,47 @@ func getAWSImages(account string, client *ec2.EC2) ([]Image, error) {
 				public:       *ami.Public,
 				tags:         convertAWSTags(ami.Tags),
 			},
-			name: *ami.Name,
+			name:             *ami.Name,
+			deprecationState: awsDeprecationState(ami.DeprecationTime),
 		}}
+		// An image is only considered encrypted if all of its EBS
+		// volumes are encrypted
+		ebsCount, encryptedCount := 0, 0
 		for _, mapping := range ami.BlockDeviceMappings {
 			if mapping != nil && (*mapping).Ebs != nil && (*(*mapping).Ebs).VolumeSize != nil {
 				img.baseImage.sizeGB += *mapping.Ebs.VolumeSize
 			}
+			if mapping != nil && mapping.Ebs != nil {
+				ebsCount++
+				if aws.BoolValue(mapping.Ebs.Encrypted) {
+					encryptedCount++
+				}
+				if mapping.Ebs.SnapshotId != nil {
+					img.baseImage.backingSnapshotIDs = append(img.baseImage.backingSnapshotIDs, *mapping.Ebs.SnapshotId)
+				}
+			}
 		}
+		// Instance store AMIs don't have any EBS volumes to encrypt
+		img.baseImage.encryptable = ebsCount > 0
+		img.baseImage.encrypted = ebsCount > 0 && ebsCount == encryptedCount
 		result = append(result, &img)
 	}
 	return result, nil
 }
 
+// awsDeprecationState works out the deprecation state of an AMI from the
+// time it's deprecated at, if any
+func awsDeprecationState(deprecationTime *string) string {
+	if deprecationTime == nil {
+		return ImageStateActive
+	}
+	deprecateAt, err := time.Parse(time.RFC3339, *deprecationTime)
+	if err != nil || deprecateAt.After(time.Now()) {
+		return ImageStateActive
+	}
+	return ImageStateDeprecated
+}
+
 // getAWSVolumes will get all volumes (both attached and un-attached)
 // in the current account
 func getAWSVolumes(account string, client *ec2.EC2) ([]Volume, error) {
@@ -379,27 +474,80 @@ func getAWSVolumes(account string, client *ec2.EC2) ([]Volume, error) {
 	}
 	result := []Volume{}
 	for _, volume := range awsVolumes.Volumes {
-		inUse := len(volume.Attachments) > 0 || *volume.State == awsStateInUse
-		vol := awsVolume{baseVolume{
-			baseResource: baseResource{
-				csp:          AWS,
-				owner:        account,
-				id:           *volume.VolumeId,
-				location:     *client.Config.Region,
-				creationTime: *volume.CreateTime,
-				public:       false,
-				tags:         convertAWSTags(volume.Tags),
-			},
-			sizeGB:     *volume.Size,
-			attached:   inUse,
-			encrypted:  *volume.Encrypted,
-			volumeType: *volume.VolumeType,
-		}}
-		result = append(result, &vol)
+		result = append(result, newAWSVolume(account, *client.Config.Region, volume))
 	}
 	return result, nil
 }
 
+// getAWSAttachedVolumes will get all attached volumes in the current
+// account, mapped by the ID of the instance they're attached to
+func getAWSAttachedVolumes(account string, client *ec2.EC2) (map[string][]Volume, error) {
+	input := new(ec2.DescribeVolumesInput)
+	awsVolumes, err := client.DescribeVolumes(input)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]Volume)
+	for _, volume := range awsVolumes.Volumes {
+		for _, attachment := range volume.Attachments {
+			if attachment.InstanceId != nil {
+				result[*attachment.InstanceId] = append(result[*attachment.InstanceId], newAWSVolume(account, *client.Config.Region, volume))
+			}
+		}
+	}
+	return result, nil
+}
+
+func newAWSVolume(account, region string, volume *ec2.Volume) *awsVolume {
+	inUse := len(volume.Attachments) > 0 || *volume.State == awsStateInUse
+	return &awsVolume{baseVolume{
+		baseResource: baseResource{
+			csp:          AWS,
+			owner:        account,
+			id:           *volume.VolumeId,
+			location:     region,
+			creationTime: *volume.CreateTime,
+			public:       false,
+			tags:         convertAWSTags(volume.Tags),
+		},
+		sizeGB:     *volume.Size,
+		attached:   inUse,
+		encrypted:  *volume.Encrypted,
+		volumeType: *volume.VolumeType,
+	}}
+}
+
+func convertAWSInstanceState(state string) string {
+	switch state {
+	case ec2.InstanceStateNamePending:
+		return InstanceStatePending
+	case ec2.InstanceStateNameRunning:
+		return InstanceStateRunning
+	case ec2.InstanceStateNameStopping, ec2.InstanceStateNameShuttingDown:
+		return InstanceStateStopping
+	case ec2.InstanceStateNameStopped:
+		return InstanceStateStopped
+	default:
+		return state
+	}
+}
+
+// awsStateTransitionTime will determine when an instance entered its
+// current state. For running instances this is the launch time, which
+// AWS updates every time the instance is started.
+func awsStateTransitionTime(instance *ec2.Instance) time.Time {
+	if instance.StateTransitionReason != nil {
+		match := stateTransitionTimeRegexp.FindStringSubmatch(*instance.StateTransitionReason)
+		if len(match) == 2 {
+			t, err := time.Parse("2006-01-02 15:04:05", match[1])
+			if err == nil {
+				return t
+			}
+		}
+	}
+	return *instance.LaunchTime
+}
+
 // getAWSSnapshots will get all snapshots in AWS owned
 // by the current account
 func getAWSSnapshots(account string, client *ec2.EC2) ([]Snapshot, error) {
@@ -412,8 +560,15 @@ func getAWSSnapshots(account string, client *ec2.EC2) ([]Snapshot, error) {
 	}
 	result := []Snapshot{}
 	snapshotsInUse := getSnapshotsInUse(client)
+	publicSnapshots := getPublicSnapshots(client)
 	for _, snapshot := range awsSnapshots.Snapshots {
 		_, inUse := snapshotsInUse[*snapshot.SnapshotId]
+		_, public := publicSnapshots[*snapshot.SnapshotId]
+		sourceVolumeID := aws.StringValue(snapshot.VolumeId)
+		if sourceVolumeID == awsUnknownVolumeID {
+			// Snapshots copied from another snapshot have no source volume
+			sourceVolumeID = ""
+		}
 		snap := awsSnapshot{baseSnapshot{
 			baseResource: baseResource{
 				csp:          AWS,
@@ -421,12 +576,13 @@ func getAWSSnapshots(account string, client *ec2.EC2) ([]Snapshot, error) {
 				id:           *snapshot.SnapshotId,
 				location:     *client.Config.Region,
 				creationTime: *snapshot.StartTime,
-				public:       false,
+				public:       public,
 				tags:         convertAWSTags(snapshot.Tags),
 			},
-			sizeGB:    *snapshot.VolumeSize,
-			encrypted: *snapshot.Encrypted,
-			inUse:     inUse,
+			sizeGB:         *snapshot.VolumeSize,
+			encrypted:      *snapshot.Encrypted,
+			inUse:          inUse,
+			sourceVolumeID: sourceVolumeID,
 		}}
 		result = append(result, &snap)
 	}
@@ -453,8 +609,66 @@ func getSnapshotsInUse(client *ec2.EC2) map[string]struct{} {
 	return result
 }
 
+// getPublicSnapshots will find all snapshots owned by the current
+// account which anyone is allowed to create volumes from
+func getPublicSnapshots(client *ec2.EC2) map[string]struct{} {
+	result := make(map[string]struct{})
+	input := &ec2.DescribeSnapshotsInput{
+		OwnerIds:            aws.StringSlice([]string{awsOwnerIDSelfValue}),
+		RestorableByUserIds: aws.StringSlice([]string{awsPermissionGroupAll}),
+	}
+	snapshots, err := client.DescribeSnapshots(input)
+	if err != nil {
+		log.Printf("Could not determine public snapshots:\n%s\n", err)
+		return result
+	}
+	for _, snapshot := range snapshots.Snapshots {
+		result[*snapshot.SnapshotId] = struct{}{}
+	}
+	return result
+}
+
+// getOpenSecurityGroups will find all security groups which allow
+// inbound traffic from any address
+func getOpenSecurityGroups(client *ec2.EC2) (map[string]struct{}, error) {
+	groups, err := client.DescribeSecurityGroups(new(ec2.DescribeSecurityGroupsInput))
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]struct{})
+	for _, group := range groups.SecurityGroups {
+		for _, permission := range group.IpPermissions {
+			open := false
+			for _, ipRange := range permission.IpRanges {
+				if ipRange.CidrIp != nil && isAnyAddress(*ipRange.CidrIp) {
+					open = true
+				}
+			}
+			for _, ipRange := range permission.Ipv6Ranges {
+				if ipRange.CidrIpv6 != nil && isAnyAddress(*ipRange.CidrIpv6) {
+					open = true
+				}
+			}
+			if open {
+				result[*group.GroupId] = struct{}{}
+			}
+		}
+	}
+	return result, nil
+}
+
+func hasOpenSecurityGroup(groups []*ec2.GroupIdentifier, openGroups map[string]struct{}) bool {
+	groupIDs := []string{}
+	for _, group := range groups {
+		if group.GroupId != nil {
+			groupIDs = append(groupIDs, *group.GroupId)
+		}
+	}
+	return anyOpenGroup(groupIDs, openGroups)
+}
+
 func getAllEC2Resources(accounts []string, funcToRun func(client *ec2.EC2, account string)) {
-	sess := session.Must(session.NewSession())
+	sess := NewAWSSession()
 	forEachAccount(accounts, sess, func(account string, cred *credentials.Credentials) {
 		log.Println("Accessing account", account)
 		forEachAWSRegion(func(region string) {
@@ -537,7 +751,7 @@ func convertAWSS3Tags(tags []*s3.Tag) map[string]string {
 }
 
 func clientForAWSResource(res Resource) *ec2.EC2 {
-	sess := session.Must(session.NewSession())
+	sess := NewAWSSession()
 	creds := stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, res.Owner()))
 	return ec2.New(sess, &aws.Config{
 		Credentials: creds,
@@ -579,17 +793,47 @@ func removeAWSTag(r Resource, key string) error {
 	return err
 }
 
-func awsTryWithBackoff(f func() error) error {
-	try := 1
-	var err error
-	for {
-		err = f()
-		if err == nil || err != errAWSRequestLimit || try > awsMaxRequestRetries {
-			break
-		}
-		// Stupid but simple backoff (2^try seconds): 2, 4, 8, 16, 32 etc... seconds
-		time.Sleep(time.Duration(math.Exp2(float64(try))) * time.Second)
-		try++
+// NewAWSSession returns a session whose clients retry with awsRetryer.
+// Clients inherit the retryer unless their own config sets one. Every
+// AWS client should be created from such a session, in other packages
+// as well.
+func NewAWSSession() *session.Session {
+	cfg := request.WithRetryer(&aws.Config{
+		// Make the SDK ask the retryer even for errors it considers
+		// retryable itself, so every retry is taken from the budget
+		EnforceShouldRetryCheck: aws.Bool(true),
+	}, awsRetryer{})
+	return session.Must(session.NewSession(cfg))
+}
+
+type awsRetryer struct{}
+
+func (awsRetryer) MaxRetries() int {
+	return maxRetries
+}
+
+func (awsRetryer) RetryRules(r *request.Request) time.Duration {
+	return backoffDelay(r.RetryCount)
+}
+
+func (awsRetryer) ShouldRetry(r *request.Request) bool {
+	if r.Error == nil || r.RetryCount >= maxRetries || !retryableAWSError(r) {
+		return false
 	}
-	return err
+	if !retries.take() {
+		return false
+	}
+	log.Printf("Retrying %s %s (attempt %d): %s\n", r.ClientInfo.ServiceName, r.Operation.Name, r.RetryCount+1, r.Error)
+	return true
+}
+
+func retryableAWSError(r *request.Request) bool {
+	if r.HTTPResponse != nil && retryableStatus(r.HTTPResponse.StatusCode) {
+		return true
+	}
+	aerr, ok := r.Error.(awserr.Error)
+	if !ok {
+		return isTransientError(r.Error)
+	}
+	return retryableAWSCodes[aerr.Code()] || isTransientError(aerr.OrigErr())
 }
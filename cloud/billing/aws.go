@@ -19,7 +19,6 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
@@ -105,7 +104,7 @@ func getCSVFromS3(name string) (*csv.Reader, error) {
 		log.Println("Could not create file in temp directory")
 		return nil, err
 	}
-	sess := session.Must(session.NewSession())
+	sess := cloud.NewAWSSession()
 	sess.Config.Region = aws.String(awsBillingBucketRegion)
 	downloader := s3manager.NewDownloader(sess)
 	input := &s3.GetObjectInput{
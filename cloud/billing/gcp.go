@@ -39,8 +39,12 @@ func (r *gcpReporter) GenerateReport(start time.Time) Report {
 	if _, err := os.Stat(credsFilePath); os.IsNotExist(err) {
 		log.Fatalln(credsFilePath, "is not a file!")
 	}
-	opt := option.WithServiceAccountFile(credsFilePath)
-	client, err := storage.NewClient(ctx, opt)
+	httpClient, err := cloud.NewGCPHttpClient()
+	if err != nil {
+		log.Printf("Could not initialize storage service:\n%s\n", err)
+		return report
+	}
+	client, err := storage.NewClient(ctx, option.WithHTTPClient(httpClient))
 	if err != nil {
 		log.Printf("Could not initialize storage service:\n%s\n", err)
 		return report
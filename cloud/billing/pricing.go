@@ -6,9 +6,11 @@ package billing
 import (
 	"brkt/cloudsweeper/cloud"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 const (
@@ -95,39 +97,83 @@ var gcpInstanceCostPerHourMap = map[string]float64{
 // ResourceCostPerDay returns the daily cost of a resource in USD
 func ResourceCostPerDay(resource cloud.Resource) float64 {
 	if inst, ok := resource.(cloud.Instance); ok {
-		return InstancePricePerHour(inst) * 24.0
+		return InstanceCostPerDay(inst)
 	} else if vol, ok := resource.(cloud.Volume); ok {
 		return VolumeCostPerDay(vol)
 	} else if img, ok := resource.(cloud.Image); ok {
 		return ImageCostPerDay(img)
 	} else if snap, ok := resource.(cloud.Snapshot); ok {
 		return SnapshotCostPerDay(snap)
+	} else if buck, ok := resource.(cloud.Bucket); ok {
+		return BucketPricePerMonth(buck) / 30.0
 	} else {
-		log.Println("Resource was neither instance, volume, image or snapshot")
+		log.Println("Resource was neither instance, volume, image, snapshot or bucket")
 		return 0.0
 	}
 }
 
+// AccumulatedCost estimates how much a resource has cost in USD since
+// it was created. Buckets change size over time, so they are instead
+// priced by their current monthly cost.
+func AccumulatedCost(resource cloud.Resource) float64 {
+	if buck, ok := resource.(cloud.Bucket); ok {
+		return BucketPricePerMonth(buck)
+	}
+	days := time.Now().Sub(resource.CreationTime()).Hours() / 24.0
+	return days * ResourceCostPerDay(resource)
+}
+
+// LookupCost estimates the daily and accumulated cost of a resource in
+// USD, like ResourceCostPerDay and AccumulatedCost. Instead of stopping
+// housekeeper when a price is unknown, such as for a new volume type,
+// the missing price is logged and ok is false.
+func LookupCost(resource cloud.Resource) (perDay, accumulated float64, ok bool) {
+	var err error
+	switch r := resource.(type) {
+	case cloud.Instance:
+		perDay, err = instanceCostPerDay(r)
+	case cloud.Volume:
+		perDay, err = volumeCostPerDay(r)
+	default:
+		perDay = ResourceCostPerDay(resource)
+	}
+	if err != nil {
+		log.Printf("Could not estimate the cost of %s: %s\n", resource.ID(), err)
+		return 0.0, 0.0, false
+	}
+	if buck, isBucket := resource.(cloud.Bucket); isBucket {
+		return perDay, BucketPricePerMonth(buck), true
+	}
+	days := time.Now().Sub(resource.CreationTime()).Hours() / 24.0
+	return perDay, days * perDay, true
+}
+
 // VolumeCostPerDay returns the daily cost in USD for a
 // certain volume
 func VolumeCostPerDay(volume cloud.Volume) float64 {
+	cost, err := volumeCostPerDay(volume)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return cost
+}
+
+func volumeCostPerDay(volume cloud.Volume) (float64, error) {
 	if volume.CSP() == cloud.AWS {
 		price, ok := awsStorageCostMap[volume.VolumeType()]
 		if !ok {
-			log.Fatalf("Could not find price for %s in AWS", volume.VolumeType())
-			return 0.0
+			return 0.0, fmt.Errorf("Could not find price for %s in AWS", volume.VolumeType())
 		}
-		return price * float64(volume.SizeGB())
+		return price * float64(volume.SizeGB()), nil
 	} else if volume.CSP() == cloud.GCP {
 		price, ok := gcpStorageCostGBDayMap[volume.VolumeType()]
 		if !ok {
-			log.Fatalf("Could not find price for %s in GCP", volume.VolumeType())
-			return 0.0
+			return 0.0, fmt.Errorf("Could not find price for %s in GCP", volume.VolumeType())
 		}
-		return price * float64(volume.SizeGB())
+		return price * float64(volume.SizeGB()), nil
 	}
 	log.Panicln("Unsupported CSP:", volume.CSP())
-	return 0.0
+	return 0.0, nil
 }
 
 // SnapshotCostPerDay returns the daily cost in USD for a
@@ -156,21 +202,55 @@ func ImageCostPerDay(image cloud.Image) float64 {
 	return 0.0
 }
 
+// InstanceCostPerDay returns the daily cost in USD for a certain
+// instance. Stopped instances are only charged for their attached
+// storage.
+func InstanceCostPerDay(instance cloud.Instance) float64 {
+	cost, err := instanceCostPerDay(instance)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return cost
+}
+
+func instanceCostPerDay(instance cloud.Instance) (float64, error) {
+	if instance.State() == cloud.InstanceStateStopped {
+		storageCost := 0.0
+		for _, vol := range instance.AttachedVolumes() {
+			cost, err := volumeCostPerDay(vol)
+			if err != nil {
+				return 0.0, err
+			}
+			storageCost += cost
+		}
+		return storageCost, nil
+	}
+	price, err := instancePricePerHour(instance)
+	return price * 24.0, err
+}
+
 // InstancePricePerHour will return the hourly price in USD for a
 // specified instance.
 func InstancePricePerHour(instance cloud.Instance) float64 {
+	price, err := instancePricePerHour(instance)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return price
+}
+
+func instancePricePerHour(instance cloud.Instance) (float64, error) {
 	if instance.CSP() == cloud.AWS {
-		return awsInstancePricePerHour(instance.Location(), instance.InstanceType())
+		return awsInstancePricePerHour(instance.Location(), instance.InstanceType()), nil
 	} else if instance.CSP() == cloud.GCP {
 		price, ok := gcpInstanceCostPerHourMap[instance.InstanceType()]
 		if !ok {
-			log.Fatalf("Could not find price for %s in GCP", instance.InstanceType())
-			return 0.0
+			return 0.0, fmt.Errorf("Could not find price for %s in GCP", instance.InstanceType())
 		}
-		return price
+		return price, nil
 	}
 	log.Panicln("Unsupported CSP:", instance.CSP())
-	return 0.0
+	return 0.0, nil
 }
 
 // BucketPricePerMonth will return the monthly price in USD for a
@@ -11,7 +11,6 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	storage "google.golang.org/api/storage/v1"
 )
@@ -21,6 +20,7 @@ type baseBucket struct {
 	lastModified time.Time
 	objectCount  int64
 	totalSizeGB  float64
+	encrypted    bool
 }
 
 func (b *baseBucket) LastModified() time.Time {
@@ -35,6 +35,10 @@ func (b *baseBucket) TotalSizeGB() float64 {
 	return b.totalSizeGB
 }
 
+func (b *baseBucket) Encrypted() bool {
+	return b.encrypted
+}
+
 func cleanupBuckets(buckets []Bucket) error {
 	resList := []Resource{}
 	for i := range buckets {
@@ -55,7 +59,7 @@ type awsBucket struct {
 
 func (b *awsBucket) Cleanup() error {
 	log.Printf("Cleaning up bucket %s in %s", b.ID(), b.Owner())
-	sess := session.Must(session.NewSession())
+	sess := NewAWSSession()
 	creds := stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, b.Owner()))
 	s3Client := s3.New(sess, &aws.Config{
 		Credentials: creds,
@@ -113,7 +117,7 @@ func (b *awsBucket) SetTag(key, value string, overwrite bool) error {
 	if exist && !overwrite {
 		return fmt.Errorf("Key %s already exist on %s", key, b.ID())
 	}
-	sess := session.Must(session.NewSession())
+	sess := NewAWSSession()
 	creds := stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, b.Owner()))
 	s3Client := s3.New(sess, &aws.Config{
 		Credentials: creds,
@@ -133,6 +137,35 @@ func (b *awsBucket) SetTag(key, value string, overwrite bool) error {
 	return err
 }
 
+func (b *awsBucket) MakePrivate() error {
+	log.Printf("Making bucket %s private in %s", b.ID(), b.Owner())
+	if !b.Public() {
+		// Bucket is already private
+		return nil
+	}
+	sess := NewAWSSession()
+	creds := stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, b.Owner()))
+	s3Client := s3.New(sess, &aws.Config{
+		Credentials: creds,
+		Region:      aws.String(b.Location()),
+	})
+	input := &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(b.ID()),
+		PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	}
+	_, err := s3Client.PutPublicAccessBlock(input)
+	if err != nil {
+		return err
+	}
+	b.public = false
+	return nil
+}
+
 func (b *awsBucket) RemoveTag(key string) error {
 	// TODO: Implement
 	log.Fatalln("Not implemented for buckets")
@@ -162,3 +195,42 @@ func (b *gcpBucket) RemoveTag(key string) error {
 	log.Println("Bucket tagging not supported on GCP")
 	return nil
 }
+
+func (b *gcpBucket) MakePrivate() error {
+	log.Printf("Making bucket %s private in %s", b.ID(), b.Owner())
+	if !b.Public() {
+		// Bucket is already private
+		return nil
+	}
+	policy, err := b.storage.Buckets.GetIamPolicy(b.ID()).Do()
+	if err != nil {
+		return err
+	}
+	bindings := []*storage.PolicyBindings{}
+	for _, binding := range policy.Bindings {
+		members := []string{}
+		for _, member := range binding.Members {
+			if !isGCPPublicMember(member) {
+				members = append(members, member)
+			}
+		}
+		if len(members) > 0 {
+			binding.Members = members
+			bindings = append(bindings, binding)
+		}
+	}
+	policy.Bindings = bindings
+	_, err = b.storage.Buckets.SetIamPolicy(b.ID(), policy).Do()
+	if err != nil {
+		return err
+	}
+	// Legacy ACLs can grant public access too
+	for _, entity := range []string{gcpAllUsers, gcpAllAuthenticatedUsers} {
+		err = b.storage.BucketAccessControls.Delete(b.ID(), entity).Do()
+		if err != nil && !isGCPNotFoundError(err) {
+			return err
+		}
+	}
+	b.public = false
+	return nil
+}
@@ -80,10 +80,20 @@ type Resource interface {
 }
 
 // Instance composes the Resource interface, and descibes an instance
-// in any CSP.
+// in any CSP. Terminated instances are never included.
 type Instance interface {
 	Resource
 	InstanceType() string
+	// State is one of the InstanceState constants
+	State() string
+	// StateTransitionTime is when the instance entered its current state
+	StateTransitionTime() time.Time
+	// AttachedVolumes are the volumes currently attached to the instance
+	AttachedVolumes() []Volume
+	// Stop will stop a running instance, keeping its volumes
+	Stop() error
+	// Start will start a stopped instance
+	Start() error
 }
 
 // Image composes the Resource interface, and descibe an image in
@@ -92,8 +102,20 @@ type Image interface {
 	Resource
 	Name() string
 	SizeGB() int64
+	Encrypted() bool
+	// Encryptable is false for images that can't be encrypted, such as
+	// instance store AMIs without any EBS volumes
+	Encryptable() bool
+	// BackingSnapshotIDs are the snapshots the image depends on. Only
+	// AMIs in AWS are backed by snapshots.
+	BackingSnapshotIDs() []string
+	// DeprecationState is one of the ImageState constants
+	DeprecationState() string
 
 	MakePrivate() error
+	// Deprecate changes the deprecation state of the image. AMIs can't
+	// be made obsolete, so they're only deprecated.
+	Deprecate(state string) error
 }
 
 // Volume composes the Resource interface, and describe a volume in
@@ -113,6 +135,14 @@ type Snapshot interface {
 	Encrypted() bool
 	InUse() bool
 	SizeGB() int64
+	// SourceVolumeID is the ID of the volume the snapshot was
+	// created from, or empty if unknown. Disk names are only unique
+	// within a zone in GCP, so there it's the zone and name of the
+	// disk, e.g. "us-central1-a/disk-1", or the region and name of a
+	// regional disk
+	SourceVolumeID() string
+
+	MakePrivate() error
 }
 
 // Bucket represents a bucket in a CSP, such as an S3 bucket in AWS
@@ -121,6 +151,9 @@ type Bucket interface {
 	LastModified() time.Time
 	ObjectCount() int64
 	TotalSizeGB() float64
+	Encrypted() bool
+
+	MakePrivate() error
 }
 
 // ResourceCollection encapsulates collections of multiple resources. Does not
@@ -131,11 +164,39 @@ type ResourceCollection struct {
 	Images    []Image
 	Volumes   []Volume
 	Snapshots []Snapshot
+
+	// VolumesIncomplete is set if the volumes in some regions or zones
+	// could not be listed, so volumes missing from Volumes may still exist
+	VolumesIncomplete bool
 }
 
 // CSP represent a cloud service provider, such as AWS
 type CSP string
 
+// The states an instance can be in, independent of CSP
+const (
+	// InstanceStatePending is an instance that is starting
+	InstanceStatePending = "pending"
+	// InstanceStateRunning is a running instance
+	InstanceStateRunning = "running"
+	// InstanceStateStopping is an instance that is stopping
+	InstanceStateStopping = "stopping"
+	// InstanceStateStopped is a stopped instance, which still
+	// costs money for its attached storage
+	InstanceStateStopped = "stopped"
+)
+
+// The deprecation states an image can be in, independent of CSP
+const (
+	// ImageStateActive is an image that is not deprecated
+	ImageStateActive = ""
+	// ImageStateDeprecated is an image that can still be used, but
+	// shouldn't be used for anything new
+	ImageStateDeprecated = "DEPRECATED"
+	// ImageStateObsolete is an image that can no longer be used
+	ImageStateObsolete = "OBSOLETE"
+)
+
 const (
 	// AWS is AWS
 	AWS CSP = "AWS"
@@ -154,7 +215,7 @@ func NewManager(c CSP, accounts ...string) (ResourceManager, error) {
 		return manager, nil
 	case GCP:
 		log.Println("Initializing GCP Resource Manager")
-		client, err := getGCPHttpClient()
+		client, err := NewGCPHttpClient()
 		if err != nil {
 			return nil, err
 		}
@@ -177,7 +238,19 @@ func NewManager(c CSP, accounts ...string) (ResourceManager, error) {
 	}
 }
 
-func getGCPHttpClient() (*http.Client, error) {
+// NewGCPHttpClient returns an authenticated client for the GCP APIs,
+// which retries throttled and failed calls. Every GCP client should use
+// it, in other packages as well.
+func NewGCPHttpClient() (*http.Client, error) {
+	client, err := getGCPAuthClient()
+	if err != nil {
+		return nil, err
+	}
+	client.Transport = &retryTransport{base: client.Transport}
+	return client, nil
+}
+
+func getGCPAuthClient() (*http.Client, error) {
 	credsFile, exist := os.LookupEnv(GcpCredentialsFileKey)
 	if !exist {
 		log.Println("No GCP credentials specified, using default")
@@ -0,0 +1,126 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+// The functions in this file decide if resources are exposed to everyone,
+// from the ACLs, policies and firewall rules read from the CSPs. They're
+// kept apart from the CSP clients, so that they can be tested without them.
+
+const (
+	anyIPv4CIDR = "0.0.0.0/0"
+	anyIPv6CIDR = "::/0"
+
+	s3AllUsersGroupURI           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	s3AuthenticatedUsersGroupURI = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+
+	gcpAllUsers              = "allUsers"
+	gcpAllAuthenticatedUsers = "allAuthenticatedUsers"
+
+	gcpFirewallDirectionIngress = "INGRESS"
+)
+
+// isAnyAddress checks if a CIDR block includes every IPv4 or IPv6 address
+func isAnyAddress(cidr string) bool {
+	return cidr == anyIPv4CIDR || cidr == anyIPv6CIDR
+}
+
+// isS3BucketExposed checks if a bucket is public, given whether AWS
+// considers its policy public and the URIs of the grantees in its ACL.
+// Granting access to every authenticated AWS user is as good as granting
+// it to everyone.
+func isS3BucketExposed(policyPublic bool, granteeURIs []string) bool {
+	if policyPublic {
+		return true
+	}
+	for _, uri := range granteeURIs {
+		if uri == s3AllUsersGroupURI || uri == s3AuthenticatedUsersGroupURI {
+			return true
+		}
+	}
+	return false
+}
+
+// anyOpenGroup checks if any of the security groups, by ID, allows
+// inbound traffic from any address
+func anyOpenGroup(groupIDs []string, openGroups map[string]struct{}) bool {
+	for _, id := range groupIDs {
+		if _, open := openGroups[id]; open {
+			return true
+		}
+	}
+	return false
+}
+
+// isGCPPublicMember checks if a member of an IAM binding or ACL is
+// everyone, or every authenticated Google account
+func isGCPPublicMember(member string) bool {
+	return member == gcpAllUsers || member == gcpAllAuthenticatedUsers
+}
+
+// anyGCPPublicMember checks if any of the members is public
+func anyGCPPublicMember(members []string) bool {
+	for _, member := range members {
+		if isGCPPublicMember(member) {
+			return true
+		}
+	}
+	return false
+}
+
+// gcpFirewall is a GCP firewall rule, reduced to what decides if it
+// exposes an instance. The network is the name of the network, not its URL.
+type gcpFirewall struct {
+	disabled              bool
+	allowsTraffic         bool
+	direction             string
+	sourceRanges          []string
+	network               string
+	targetTags            []string
+	targetServiceAccounts []string
+}
+
+// isOpen checks if the firewall rule is enabled and allows inbound
+// traffic from any address
+func (fw *gcpFirewall) isOpen() bool {
+	if fw.disabled || !fw.allowsTraffic {
+		return false
+	}
+	if fw.direction != "" && fw.direction != gcpFirewallDirectionIngress {
+		return false
+	}
+	for _, sourceRange := range fw.sourceRanges {
+		if isAnyAddress(sourceRange) {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesTo checks if the firewall rule applies to an instance on the
+// specified networks, with the specified network tags and service
+// accounts. A rule without target tags or service accounts applies to
+// every instance on its network.
+func (fw *gcpFirewall) appliesTo(networks, tags, serviceAccounts []string) bool {
+	if !anyStringInList([]string{fw.network}, networks) {
+		return false
+	}
+	if len(fw.targetTags) > 0 && !anyStringInList(fw.targetTags, tags) {
+		return false
+	}
+	if len(fw.targetServiceAccounts) > 0 && !anyStringInList(fw.targetServiceAccounts, serviceAccounts) {
+		return false
+	}
+	return true
+}
+
+func anyStringInList(needles, haystack []string) bool {
+	for _, needle := range needles {
+		for _, s := range haystack {
+			if needle == s {
+				return true
+			}
+		}
+	}
+	return false
+}
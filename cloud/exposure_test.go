@@ -0,0 +1,126 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import "testing"
+
+func TestIsAnyAddress(t *testing.T) {
+	cases := map[string]bool{
+		"0.0.0.0/0":     true,
+		"::/0":          true,
+		"0.0.0.0/1":     false,
+		"0.0.0.0/32":    false,
+		"10.0.0.0/8":    false,
+		"2001:db8::/32": false,
+		"::/128":        false,
+		"":              false,
+	}
+	for cidr, expected := range cases {
+		if isAnyAddress(cidr) != expected {
+			t.Errorf("Expected isAnyAddress(\"%s\") to be %t", cidr, expected)
+		}
+	}
+}
+
+func TestIsS3BucketExposed(t *testing.T) {
+	cases := []struct {
+		name         string
+		policyPublic bool
+		granteeURIs  []string
+		expected     bool
+	}{
+		{"private", false, nil, false},
+		{"public policy", true, nil, true},
+		{"all users", false, []string{s3AllUsersGroupURI}, true},
+		{"authenticated users", false, []string{s3AuthenticatedUsersGroupURI}, true},
+		{"log delivery", false, []string{"http://acs.amazonaws.com/groups/s3/LogDelivery"}, false},
+		{"among others", false, []string{"http://acs.amazonaws.com/groups/s3/LogDelivery", s3AllUsersGroupURI}, true},
+		{"public policy and private ACL", true, []string{"http://acs.amazonaws.com/groups/s3/LogDelivery"}, true},
+	}
+	for _, c := range cases {
+		if exposed := isS3BucketExposed(c.policyPublic, c.granteeURIs); exposed != c.expected {
+			t.Errorf("%s: expected the bucket to be exposed: %t, got %t", c.name, c.expected, exposed)
+		}
+	}
+}
+
+func TestAnyOpenGroup(t *testing.T) {
+	openGroups := map[string]struct{}{"sg-open": {}}
+	cases := []struct {
+		groupIDs []string
+		expected bool
+	}{
+		{nil, false},
+		{[]string{"sg-closed"}, false},
+		{[]string{"sg-open"}, true},
+		{[]string{"sg-closed", "sg-open"}, true},
+	}
+	for _, c := range cases {
+		if open := anyOpenGroup(c.groupIDs, openGroups); open != c.expected {
+			t.Errorf("Expected %v to be open: %t, got %t", c.groupIDs, c.expected, open)
+		}
+	}
+}
+
+func TestAnyGCPPublicMember(t *testing.T) {
+	cases := []struct {
+		members  []string
+		expected bool
+	}{
+		{nil, false},
+		{[]string{"allUsers"}, true},
+		{[]string{"allAuthenticatedUsers"}, true},
+		{[]string{"user:jane@example.com", "allUsers"}, true},
+		{[]string{"user:jane@example.com", "group:dev@example.com", "domain:example.com"}, false},
+		{[]string{"serviceAccount:ci@project.iam.gserviceaccount.com"}, false},
+		{[]string{"projectViewer:project"}, false},
+	}
+	for _, c := range cases {
+		if public := anyGCPPublicMember(c.members); public != c.expected {
+			t.Errorf("Expected %v to be public: %t, got %t", c.members, c.expected, public)
+		}
+	}
+}
+
+func TestGCPFirewallIsOpen(t *testing.T) {
+	cases := []struct {
+		name     string
+		firewall gcpFirewall
+		expected bool
+	}{
+		{"any IPv4", gcpFirewall{allowsTraffic: true, sourceRanges: []string{"0.0.0.0/0"}}, true},
+		{"any IPv6", gcpFirewall{allowsTraffic: true, sourceRanges: []string{"::/0"}}, true},
+		{"ingress", gcpFirewall{allowsTraffic: true, direction: "INGRESS", sourceRanges: []string{"10.0.0.0/8", "0.0.0.0/0"}}, true},
+		{"internal", gcpFirewall{allowsTraffic: true, sourceRanges: []string{"10.0.0.0/8"}}, false},
+		{"egress", gcpFirewall{allowsTraffic: true, direction: "EGRESS", sourceRanges: []string{"0.0.0.0/0"}}, false},
+		{"disabled", gcpFirewall{disabled: true, allowsTraffic: true, sourceRanges: []string{"0.0.0.0/0"}}, false},
+		{"deny", gcpFirewall{sourceRanges: []string{"0.0.0.0/0"}}, false},
+	}
+	for _, c := range cases {
+		if open := c.firewall.isOpen(); open != c.expected {
+			t.Errorf("%s: expected the firewall to be open: %t, got %t", c.name, c.expected, open)
+		}
+	}
+}
+
+func TestGCPFirewallAppliesTo(t *testing.T) {
+	networks, tags, serviceAccounts := []string{"default"}, []string{"web"}, []string{"app@project.iam.gserviceaccount.com"}
+	cases := []struct {
+		name     string
+		firewall gcpFirewall
+		expected bool
+	}{
+		{"whole network", gcpFirewall{network: "default"}, true},
+		{"other network", gcpFirewall{network: "vpc-2"}, false},
+		{"target tag", gcpFirewall{network: "default", targetTags: []string{"db", "web"}}, true},
+		{"other tag", gcpFirewall{network: "default", targetTags: []string{"db"}}, false},
+		{"service account", gcpFirewall{network: "default", targetServiceAccounts: serviceAccounts}, true},
+		{"other service account", gcpFirewall{network: "default", targetServiceAccounts: []string{"ci@project.iam.gserviceaccount.com"}}, false},
+	}
+	for _, c := range cases {
+		if applies := c.firewall.appliesTo(networks, tags, serviceAccounts); applies != c.expected {
+			t.Errorf("%s: expected the firewall to apply: %t, got %t", c.name, c.expected, applies)
+		}
+	}
+}
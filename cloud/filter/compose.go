@@ -0,0 +1,125 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"fmt"
+)
+
+// The functions in this file allow filters and rules to be combined
+// into boolean expressions, for example:
+//
+//	filter.And(
+//		filter.OlderThanXDays(30),
+//		filter.Or(filter.IsUnattached(), filter.Not(filter.HasTag("Release"))),
+//	)
+//
+// The arguments can be any *ResourceFilter, or any rule, such as a
+// func(cloud.Resource) bool or a func(cloud.Volume) bool. Just like
+// when added to a filter, a rule or filter specific to one kind of
+// resource doesn't affect other kinds of resources. Filters combined
+// this way are evaluated without considering the whitelist, and the
+// resulting filter does not override the whitelist unless
+// OverrideWhitelist is set on it.
+
+type operator int
+
+const (
+	opAnd operator = iota
+	opOr
+	opNot
+)
+
+// And returns a filter which only matches resources matched by all of
+// the specified filters and rules
+func And(rules ...interface{}) *ResourceFilter {
+	result := New()
+	for _, rule := range rules {
+		if f, ok := rule.(*ResourceFilter); ok {
+			result.subFilters = append(result.subFilters, f)
+		} else {
+			addRule(result, rule)
+		}
+	}
+	return result
+}
+
+// Or returns a filter which matches resources matched by any of the
+// specified filters and rules
+func Or(rules ...interface{}) *ResourceFilter {
+	result := New()
+	result.operator = opOr
+	for _, rule := range rules {
+		result.subFilters = append(result.subFilters, toFilter(rule))
+	}
+	return result
+}
+
+// Not returns a filter which matches resources not matched by the
+// specified filter or rule. Negating a rule specific to one kind of
+// resource, such as Not(IsUnattached()), gives a rule for the same kind.
+func Not(rule interface{}) *ResourceFilter {
+	result := New()
+	switch r := rule.(type) {
+	case func(cloud.Resource) bool:
+		result.AddGeneralRule(Negate(r))
+	case func(cloud.Instance) bool:
+		result.AddInstanceRule(func(i cloud.Instance) bool { return !r(i) })
+	case func(cloud.Image) bool:
+		result.AddImageRule(func(i cloud.Image) bool { return !r(i) })
+	case func(cloud.Volume) bool:
+		result.AddVolumeRule(func(v cloud.Volume) bool { return !r(v) })
+	case func(cloud.Snapshot) bool:
+		result.AddSnapshotRule(func(s cloud.Snapshot) bool { return !r(s) })
+	case func(cloud.Bucket) bool:
+		result.AddBucketRule(func(b cloud.Bucket) bool { return !r(b) })
+	default:
+		result.operator = opNot
+		result.subFilters = []*ResourceFilter{toFilter(rule)}
+	}
+	return result
+}
+
+// Apply will filter resources of any kind using the specified filters and
+// return the resources which match. A boolean OR is performed between every
+// specified filter.
+func Apply(resources []cloud.Resource, filters ...*ResourceFilter) []cloud.Resource {
+	resultList := []cloud.Resource{}
+	for i := range resources {
+		if or(resources[i], filters) {
+			resultList = append(resultList, resources[i])
+		}
+	}
+	return resultList
+}
+
+func toFilter(rule interface{}) *ResourceFilter {
+	if f, ok := rule.(*ResourceFilter); ok {
+		return f
+	}
+	result := New()
+	addRule(result, rule)
+	return result
+}
+
+func addRule(f *ResourceFilter, rule interface{}) {
+	switch r := rule.(type) {
+	case func(cloud.Resource) bool:
+		f.AddGeneralRule(r)
+	case func(cloud.Instance) bool:
+		f.AddInstanceRule(r)
+	case func(cloud.Image) bool:
+		f.AddImageRule(r)
+	case func(cloud.Volume) bool:
+		f.AddVolumeRule(r)
+	case func(cloud.Snapshot) bool:
+		f.AddSnapshotRule(r)
+	case func(cloud.Bucket) bool:
+		f.AddBucketRule(r)
+	default:
+		// Passing anything else is a programming error
+		panic(fmt.Sprintf("filter: %T is not a filter or rule", rule))
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"testing"
+	"time"
+)
+
+func TestAnd(t *testing.T) {
+	old := &testVolume{testResource{time.Now().AddDate(0, 0, -10), map[string]string{}}, false}
+	attached := &testVolume{testResource{time.Now().AddDate(0, 0, -10), map[string]string{}}, true}
+	recent := &testVolume{testResource{time.Now(), map[string]string{}}, false}
+
+	fil := And(OlderThanXDays(5), IsUnattached())
+	filtered := Volumes([]cloud.Volume{old, attached, recent}, fil)
+	if len(filtered) != 1 || filtered[0] != old {
+		t.Error("Failed to AND rules")
+	}
+
+	nested := And(fil, Not(HasTag("Release")))
+	old.tags = map[string]string{"Release": ""}
+	if len(Volumes([]cloud.Volume{old}, nested)) != 0 {
+		t.Error("Failed to AND nested filters")
+	}
+}
+
+func TestOr(t *testing.T) {
+	old := &testVolume{testResource{time.Now().AddDate(0, 0, -10), map[string]string{}}, true}
+	unattached := &testVolume{testResource{time.Now(), map[string]string{}}, false}
+	neither := &testVolume{testResource{time.Now(), map[string]string{}}, true}
+
+	fil := Or(OlderThanXDays(5), IsUnattached())
+	filtered := Volumes([]cloud.Volume{old, unattached, neither}, fil)
+	if len(filtered) != 2 {
+		t.Error("Failed to OR rules")
+	}
+}
+
+func TestNot(t *testing.T) {
+	attached := &testVolume{testResource{time.Now(), map[string]string{}}, true}
+	unattached := &testVolume{testResource{time.Now(), map[string]string{}}, false}
+	inst := &testInstance{}
+
+	// Negated kind specific rules should not affect other kinds
+	fil := Not(IsUnattached())
+	if !fil.include(attached, nil) || fil.include(unattached, nil) || !fil.include(inst, nil) {
+		t.Error("Failed to negate volume rule")
+	}
+
+	fil = Not(And(IsUnattached(), OlderThanXDays(5)))
+	if !fil.include(unattached, nil) {
+		t.Error("Failed to negate filter")
+	}
+}
+
+func TestComposedWhitelist(t *testing.T) {
+	whitelisted := &testVolume{testResource{time.Now(), map[string]string{WhitelistTagKey: ""}}, false}
+
+	// The whitelist should only be applied once, on the outermost filter
+	fil := Not(Not(IsUnattached()))
+	if fil.include(whitelisted, nil) {
+		t.Error("Whitelisted volume should not be included")
+	}
+	fil.OverrideWhitelist = true
+	if !fil.include(whitelisted, nil) {
+		t.Error("Whitelist should be overridden")
+	}
+}
+
+func TestApply(t *testing.T) {
+	vol := &testVolume{testResource{time.Now().AddDate(0, 0, -10), map[string]string{}}, false}
+	inst := &testInstance{}
+	inst.creationTime = time.Now().AddDate(0, 0, -10)
+	bucket := &testBucket{}
+	bucket.creationTime = time.Now()
+
+	filtered := Apply([]cloud.Resource{vol, inst, bucket}, And(OlderThanXDays(5), IsUnattached()))
+	if len(filtered) != 2 {
+		t.Error("Failed to apply filter to resources of different kinds")
+	}
+}
@@ -32,9 +32,21 @@ type ResourceFilter struct {
 	snapshotRules []func(cloud.Snapshot) bool
 	bucketRules   []func(cloud.Bucket) bool
 
+	// Filters combined using And, Or or Not
+	subFilters []*ResourceFilter
+	operator   operator
+	// Named filters are included in evaluation traces
+	name string
+
 	OverrideWhitelist bool
 }
 
+// Name returns the name of the filter, which is empty unless it was
+// created using Named
+func (f *ResourceFilter) Name() string {
+	return f.name
+}
+
 // AddGeneralRule adds a generic resource rule, which is not specific to
 // any particular type of resource.
 func (f *ResourceFilter) AddGeneralRule(rule func(cloud.Resource) bool) {
@@ -40,13 +40,37 @@ func TestAddingFilters(t *testing.T) {
 
 type testInstance struct {
 	testResource
-	instType string
+	instType       string
+	state          string
+	transitionTime time.Time
 }
 
 func (i *testInstance) InstanceType() string {
 	return i.instType
 }
 
+func (i *testInstance) State() string {
+	return i.state
+}
+
+func (i *testInstance) StateTransitionTime() time.Time {
+	return i.transitionTime
+}
+
+func (i *testInstance) AttachedVolumes() []cloud.Volume {
+	return []cloud.Volume{}
+}
+
+func (i *testInstance) Stop() error {
+	i.state = cloud.InstanceStateStopped
+	return nil
+}
+
+func (i *testInstance) Start() error {
+	i.state = cloud.InstanceStateRunning
+	return nil
+}
+
 // Testing using a single filter and multiple filters for the same
 // resource type is identical for all instance types, so the tests
 // here only do cloud.Instance, but should cover all resource types.
@@ -93,11 +117,19 @@ func TestMultipleInstanceFilter(t *testing.T) {
 
 type testImg struct {
 	testResource
+	snapshotIDs   []string
+	instanceStore bool
 }
 
-func (i *testImg) Name() string       { return "test-img" }
-func (i *testImg) SizeGB() int64      { return 10 }
-func (i *testImg) MakePrivate() error { return nil }
+func (i *testImg) Name() string      { return "test-img" }
+func (i *testImg) SizeGB() int64     { return 10 }
+func (i *testImg) Encrypted() bool   { return false }
+func (i *testImg) Encryptable() bool { return !i.instanceStore }
+
+func (i *testImg) BackingSnapshotIDs() []string { return i.snapshotIDs }
+func (i *testImg) MakePrivate() error           { return nil }
+func (i *testImg) DeprecationState() string     { return cloud.ImageStateActive }
+func (i *testImg) Deprecate(state string) error { return nil }
 
 // This will test the filters being used when marking resources for
 // cleanup. These are:
@@ -7,7 +7,120 @@ import (
 	"brkt/cloudsweeper/cloud"
 )
 
-func (f *ResourceFilter) includeResource(resource cloud.Resource) bool {
+// include checks if the resource matches the filter, and that it's not
+// whitelisted (unless the filter overrides the whitelist). If a trace is
+// specified, the outcome of all named filters is recorded in it.
+func (f *ResourceFilter) include(resource cloud.Resource, trace *Trace) bool {
+	if !f.matches(resource, trace) {
+		return false
+	}
+	if !f.OverrideWhitelist && IsWhitelisted(resource) {
+		trace.record(WhitelistTagKey, 0, false)
+		return false
+	}
+	return true
+}
+
+// matches checks if the resource matches all rules of the filter, and its
+// combined filters. The whitelist is not considered.
+func (f *ResourceFilter) matches(resource cloud.Resource, trace *Trace) bool {
+	if f.name == "" || trace == nil || !f.appliesTo(resource) {
+		return f.matchRules(resource) && f.matchSubFilters(resource, trace)
+	}
+	// Reserve the step before evaluating, so that it's recorded before
+	// any named filters it contains
+	step := trace.record(f.name, trace.depth, false)
+	trace.depth++
+	result := f.matchRules(resource) && f.matchSubFilters(resource, trace)
+	trace.depth--
+	trace.Steps[step].Matched = result
+	return result
+}
+
+// matchRules checks if the resource matches all general rules of the filter,
+// and all the rules specific to the kind of resource
+func (f *ResourceFilter) matchRules(resource cloud.Resource) bool {
+	if !f.matchResource(resource) {
+		return false
+	}
+	if inst, ok := resource.(cloud.Instance); ok {
+		return f.matchInstance(inst)
+	}
+	if img, ok := resource.(cloud.Image); ok {
+		return f.matchImage(img)
+	}
+	if vol, ok := resource.(cloud.Volume); ok {
+		return f.matchVolume(vol)
+	}
+	if snap, ok := resource.(cloud.Snapshot); ok {
+		return f.matchSnapshot(snap)
+	}
+	if buck, ok := resource.(cloud.Bucket); ok {
+		return f.matchBucket(buck)
+	}
+	return false
+}
+
+// matchSubFilters evaluates the combined filters using the filter's
+// operator. Filters that don't apply to the kind of resource, because
+// they only have rules for other kinds of resources, are ignored.
+func (f *ResourceFilter) matchSubFilters(resource cloud.Resource, trace *Trace) bool {
+	switch f.operator {
+	case opOr:
+		applicable := false
+		for _, sub := range f.subFilters {
+			if !sub.appliesTo(resource) {
+				continue
+			}
+			applicable = true
+			if sub.matches(resource, trace) {
+				return true
+			}
+		}
+		return !applicable
+	case opNot:
+		for _, sub := range f.subFilters {
+			if sub.appliesTo(resource) && sub.matches(resource, trace) {
+				return false
+			}
+		}
+		return true
+	default:
+		for _, sub := range f.subFilters {
+			if !sub.matches(resource, trace) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// appliesTo checks if the filter has any rules that apply to the kind
+// of the specified resource
+func (f *ResourceFilter) appliesTo(resource cloud.Resource) bool {
+	if len(f.generalRules) > 0 {
+		return true
+	}
+	if _, ok := resource.(cloud.Instance); ok && len(f.instanceRules) > 0 {
+		return true
+	} else if _, ok := resource.(cloud.Image); ok && len(f.imageRules) > 0 {
+		return true
+	} else if _, ok := resource.(cloud.Volume); ok && len(f.volumeRules) > 0 {
+		return true
+	} else if _, ok := resource.(cloud.Snapshot); ok && len(f.snapshotRules) > 0 {
+		return true
+	} else if _, ok := resource.(cloud.Bucket); ok && len(f.bucketRules) > 0 {
+		return true
+	}
+	for _, sub := range f.subFilters {
+		if sub.appliesTo(resource) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *ResourceFilter) matchResource(resource cloud.Resource) bool {
 	for i := range f.generalRules {
 		if !f.generalRules[i](resource) {
 			return false
@@ -16,116 +129,56 @@ func (f *ResourceFilter) includeResource(resource cloud.Resource) bool {
 	return true
 }
 
-func (f *ResourceFilter) includeInstance(instance cloud.Instance) bool {
-	if !f.includeResource(instance) {
-		return false
-	}
+func (f *ResourceFilter) matchInstance(instance cloud.Instance) bool {
 	for i := range f.instanceRules {
 		if !f.instanceRules[i](instance) {
 			return false
 		}
 	}
-	_, isWhitelisted := instance.Tags()[WhitelistTagKey]
-	return !isWhitelisted || f.OverrideWhitelist
+	return true
 }
 
-func (f *ResourceFilter) includeVolume(volume cloud.Volume) bool {
-	if !f.includeResource(volume) {
-		return false
-	}
+func (f *ResourceFilter) matchVolume(volume cloud.Volume) bool {
 	for i := range f.volumeRules {
 		if !f.volumeRules[i](volume) {
 			return false
 		}
 	}
-	_, isWhitelisted := volume.Tags()[WhitelistTagKey]
-	return !isWhitelisted || f.OverrideWhitelist
+	return true
 }
 
-func (f *ResourceFilter) includeImage(image cloud.Image) bool {
-	if !f.includeResource(image) {
-		return false
-	}
+func (f *ResourceFilter) matchImage(image cloud.Image) bool {
 	for i := range f.imageRules {
 		if !f.imageRules[i](image) {
 			return false
 		}
 	}
-	_, isWhitelisted := image.Tags()[WhitelistTagKey]
-	return !isWhitelisted || f.OverrideWhitelist
+	return true
 }
 
-func (f *ResourceFilter) includeSnapshot(snapshot cloud.Snapshot) bool {
-	if !f.includeResource(snapshot) {
-		return false
-	}
+func (f *ResourceFilter) matchSnapshot(snapshot cloud.Snapshot) bool {
 	for i := range f.snapshotRules {
 		if !f.snapshotRules[i](snapshot) {
 			return false
 		}
 	}
-	_, isWhitelisted := snapshot.Tags()[WhitelistTagKey]
-	return !isWhitelisted || f.OverrideWhitelist
+	return true
 }
 
-func (f *ResourceFilter) includeBucket(bucket cloud.Bucket) bool {
-	if !f.includeResource(bucket) {
-		return false
-	}
+func (f *ResourceFilter) matchBucket(bucket cloud.Bucket) bool {
 	for i := range f.bucketRules {
 		if !f.bucketRules[i](bucket) {
 			return false
 		}
 	}
-	_, isWhitelisted := bucket.Tags()[WhitelistTagKey]
-	return !isWhitelisted || f.OverrideWhitelist
+	return true
 }
 
 func or(resource cloud.Resource, filters []*ResourceFilter) bool {
-	if inst, ok := resource.(cloud.Instance); ok {
-		for _, filter := range filters {
-			if filter.includeInstance(inst) {
-				return true
-			}
-		}
-		return false
-	}
-
-	if img, ok := resource.(cloud.Image); ok {
-		for _, filter := range filters {
-			if filter.includeImage(img) {
-				return true
-			}
-		}
-		return false
-	}
-
-	if vol, ok := resource.(cloud.Volume); ok {
-		for _, filter := range filters {
-			if filter.includeVolume(vol) {
-				return true
-			}
-		}
-		return false
-	}
-
-	if snap, ok := resource.(cloud.Snapshot); ok {
-		for _, filter := range filters {
-			if filter.includeSnapshot(snap) {
-				return true
-			}
+	for _, filter := range filters {
+		if filter.include(resource, nil) {
+			return true
 		}
-		return false
 	}
-
-	if buck, ok := resource.(cloud.Bucket); ok {
-		for _, filter := range filters {
-			if filter.includeBucket(buck) {
-				return true
-			}
-		}
-		return false
-	}
-
 	return false
 }
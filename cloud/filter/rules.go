@@ -5,13 +5,22 @@ package filter
 
 import (
 	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/billing"
 	"log"
+	"path"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
-const (
+// These are the keys of the tags housekeeper uses. They can be changed
+// with SetTagKeys, e.g. to run several independent sweepers. The values of
+// these tags are the same in every CSP. GCP labels can't hold characters
+// such as : or =, so the cloud package encodes values when setting labels
+// and decodes them when reading resources, which means the rules below
+// never see the encoded values.
+var (
 	// WhitelistTagKey marks a resource to not matched by filter
 	WhitelistTagKey = "whitelisted"
 	// LifetimeTagKey marks a resource to be cleaned up after X days
@@ -22,6 +31,34 @@ const (
 	// to keep track of resources that should be cleaned up, but was not explicitly tagged
 	// by the resource owner.
 	DeleteTagKey = "housekeeper-delete-at"
+	// DeleteReasonTagKey is set together with DeleteTagKey, and explains why
+	// housekeeper decided that the resource should be cleaned up
+	DeleteReasonTagKey = "housekeeper-delete-reason"
+	// MarkedAtTagKey is set together with DeleteTagKey, and records when
+	// housekeeper marked the resource for deletion
+	MarkedAtTagKey = "housekeeper-marked-at"
+	// ScheduleTagKey specifies when an instance should be running, such as
+	// "mon-fri 08:00-19:00 America/Los_Angeles". See ParseSchedule.
+	ScheduleTagKey = "housekeeper-schedule"
+	// ReleaseTagKey marks a resource as released, such as a public image
+	// that is meant to be kept
+	ReleaseTagKey = "Release"
+	// ReleaseStageTagKey records which stage of the release lifecycle a
+	// release image is in, and since when
+	ReleaseStageTagKey = "housekeeper-release-stage"
+	// PostponedTagKey is set when a deletion is postponed because of a
+	// change freeze, and records when the resource was to be deleted and
+	// the name of the freeze
+	PostponedTagKey = "housekeeper-postponed"
+	// OffboardedAtTagKey records when the handover of a resource started,
+	// after its owner left the company
+	OffboardedAtTagKey = "housekeeper-offboarded-at"
+	// OwnerTagKey reassigns a resource in the account of a disabled
+	// employee to another employee, by their username
+	OwnerTagKey = "housekeeper-owner"
+)
+
+const (
 	// ExpiryTagValueFormat is the format to use when setting expiry date
 	ExpiryTagValueFormat = "2006-01-02" // Used to parse string
 )
@@ -102,12 +139,94 @@ func IDMatches(ids ...string) func(cloud.Resource) bool {
 // HasTag checks if a resource have a specified tag or not
 func HasTag(tagKey string) func(cloud.Resource) bool {
 	return func(r cloud.Resource) bool {
-		for key := range r.Tags() {
-			if strings.ToLower(key) == strings.ToLower(tagKey) {
-				return true
-			}
+		_, exist := TagValue(r, tagKey)
+		return exist
+	}
+}
+
+// TagEquals checks if a resource has a tag with exactly the
+// specified value
+func TagEquals(tagKey, value string) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		val, exist := TagValue(r, tagKey)
+		return exist && val == value
+	}
+}
+
+// TagMatchesRegexp checks if a resource has a tag with a value matching
+// the specified regular expression
+func TagMatchesRegexp(tagKey string, re *regexp.Regexp) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		val, exist := TagValue(r, tagKey)
+		return exist && re.MatchString(val)
+	}
+}
+
+// TagMatchesGlob checks if a resource has a tag with a value matching
+// the specified glob pattern, such as "ci-*". See path.Match for the
+// pattern syntax.
+func TagMatchesGlob(tagKey, pattern string) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		val, exist := TagValue(r, tagKey)
+		if !exist {
+			return false
 		}
-		return false
+		matched, err := path.Match(pattern, val)
+		return err == nil && matched
+	}
+}
+
+// TagNumberAbove checks if a resource has a numeric tag with a value
+// greater than the specified number
+func TagNumberAbove(tagKey string, number float64) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		val, ok := tagNumber(r, tagKey)
+		return ok && val > number
+	}
+}
+
+// TagNumberBelow checks if a resource has a numeric tag with a value
+// less than the specified number
+func TagNumberBelow(tagKey string, number float64) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		val, ok := tagNumber(r, tagKey)
+		return ok && val < number
+	}
+}
+
+// TagDateBefore checks if a resource has a tag with a date or timestamp
+// before the specified time. See ParseTagTime for supported formats.
+func TagDateBefore(tagKey string, t time.Time) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		val, ok := tagTime(r, tagKey)
+		return ok && val.Before(t)
+	}
+}
+
+// TagDateAfter checks if a resource has a tag with a date or timestamp
+// after the specified time. See ParseTagTime for supported formats.
+func TagDateAfter(tagKey string, t time.Time) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		val, ok := tagTime(r, tagKey)
+		return ok && val.After(t)
+	}
+}
+
+// TagDateOlderThanXDays checks if a resource has a tag with a date or
+// timestamp more than the specified amount of days ago
+func TagDateOlderThanXDays(tagKey string, days int) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		val, ok := tagTime(r, tagKey)
+		return ok && time.Now().After(val.AddDate(0, 0, days))
+	}
+}
+
+// TagMissingOrEmpty checks if a resource either doesn't have the
+// specified tag, or has it with an empty value
+func TagMissingOrEmpty(tagKey string) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		val, exist := TagValue(r, tagKey)
+		return !exist || strings.TrimSpace(val) == ""
 	}
 }
 
@@ -118,49 +237,55 @@ func IsPublic() func(cloud.Resource) bool {
 	}
 }
 
-// LifetimeExceeded check if a resource have the lifetime tag,
-// with the format "housekeeper-lifetime: days-X" (where X is the amount of
-// days to keep the resource). If the lifetime is passed, then
-// this resource should be included in the filter.
-func LifetimeExceeded() func(cloud.Resource) bool {
+// IsUnencrypted checks if a resource is not encrypted. Resources that
+// can't be encrypted, such as instances and instance store AMIs, are
+// never included.
+func IsUnencrypted() func(cloud.Resource) bool {
 	return func(r cloud.Resource) bool {
-		lifetime, hasLifetime := r.Tags()[LifetimeTagKey]
-		if !hasLifetime {
-			// If resource doesn't have the lifetime tag then don't include it
-			return false
-		}
-		days := strings.Split(lifetime, "-")
-		if len(days) != 2 {
-			// Lifetime tag is not on the correct format
-			log.Printf("%s have an incorrect lifetime tag: %s", r.ID(), lifetime)
-			return false
-		}
-		numberOfDays, err := strconv.Atoi(days[1])
-		if err != nil {
-			// Lifetime tag is not on the correct format
-			log.Printf("%s have an incorrect lifetime tag: %s", r.ID(), lifetime)
+		if img, ok := r.(cloud.Image); ok && !img.Encryptable() {
 			return false
 		}
-		expiery := r.CreationTime().Add(time.Hour * 24 * time.Duration(numberOfDays))
-		return time.Now().After(expiery)
+		encryptable, ok := r.(interface {
+			Encrypted() bool
+		})
+		return ok && !encryptable.Encrypted()
+	}
+}
+
+// DailyCostAbove checks if a resource costs more than the specified
+// amount of USD per day to keep around
+func DailyCostAbove(usd float64) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		return billing.ResourceCostPerDay(r) > usd
+	}
+}
+
+// AccumulatedCostAbove checks if a resource has cost more than the
+// specified amount of USD since it was created. Buckets are compared
+// using their monthly cost.
+func AccumulatedCostAbove(usd float64) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		return billing.AccumulatedCost(r) > usd
+	}
+}
+
+// LifetimeExceeded check if a resource have the lifetime tag, with the
+// format "housekeeper-lifetime: days-X" (where X is the amount of days to
+// keep the resource), or any other duration accepted by ParseLifetime.
+// If the lifetime is passed, then this resource should be included in
+// the filter.
+func LifetimeExceeded() func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		return timeTagPassed(r, LifetimeTagKey, LifetimeEnd)
 	}
 }
 
 // ExpiryDatePassed checks is the expiry date for a resource has passed. The
-// expiry tag has the format "housekeeper-expiry: 2018-06-17".
+// expiry tag has the format "housekeeper-expiry: 2018-06-17", or any other
+// value accepted by ParseExpiry.
 func ExpiryDatePassed() func(cloud.Resource) bool {
 	return func(r cloud.Resource) bool {
-		expiryVal, hasExpiry := r.Tags()[ExpiryTagKey]
-		if !hasExpiry {
-			// Don't include resource that doesn't have expiry tag
-			return false
-		}
-		expiryDate, err := time.Parse(ExpiryTagValueFormat, expiryVal)
-		if err != nil {
-			log.Printf("%s has incorrect expiry tag:%s", r.ID(), expiryVal)
-			return false
-		}
-		return time.Now().After(expiryDate)
+		return timeTagPassed(r, ExpiryTagKey, ExpiryTime)
 	}
 }
 
@@ -169,13 +294,12 @@ func ExpiryDatePassed() func(cloud.Resource) bool {
 // includes resources which deletion time is passed.
 func DeleteWithinXHours(hours int) func(cloud.Resource) bool {
 	return func(r cloud.Resource) bool {
-		deleteTimeString, hasDeletion := r.Tags()[DeleteTagKey]
-		if !hasDeletion {
+		deleteTime, exist, err := DeleteTime(r)
+		if !exist {
 			return false
 		}
-		deleteTime, err := time.Parse(time.RFC3339, deleteTimeString)
 		if err != nil {
-			log.Printf("%s has malformed deletion tag: %s\n", r.ID(), deleteTimeString)
+			log.Printf("%s has malformed deletion tag: %s\n", r.ID(), err)
 			return false
 		}
 		within := deleteTime.Add(-(time.Duration(hours) * time.Hour))
@@ -187,16 +311,31 @@ func DeleteWithinXHours(hours int) func(cloud.Resource) bool {
 // delete tag has the format "housekeeper-delete-at: 2018-01-25T16:51:39-08:00".
 func DeleteAtPassed() func(cloud.Resource) bool {
 	return func(r cloud.Resource) bool {
-		deleteAt, exist := r.Tags()[DeleteTagKey]
-		if !exist {
-			return false
-		}
-		deleteAtTime, err := time.Parse(time.RFC3339, deleteAt)
-		if err != nil {
-			log.Printf("%s has malformed deletion tag: %s\n", r.ID(), deleteAt)
-			return false
-		}
-		return time.Now().After(deleteAtTime)
+		return timeTagPassed(r, DeleteTagKey, DeleteTime)
+	}
+}
+
+// Below are instance rules
+
+// IsRunning checks if an instance is running
+func IsRunning() func(cloud.Instance) bool {
+	return func(i cloud.Instance) bool {
+		return i.State() == cloud.InstanceStateRunning
+	}
+}
+
+// IsStopped checks if an instance is stopped
+func IsStopped() func(cloud.Instance) bool {
+	return func(i cloud.Instance) bool {
+		return i.State() == cloud.InstanceStateStopped
+	}
+}
+
+// StoppedForXDays returns instances that have been stopped for
+// longer than the specified amount of days
+func StoppedForXDays(days int) func(cloud.Instance) bool {
+	return func(i cloud.Instance) bool {
+		return IsStopped()(i) && time.Now().After(i.StateTransitionTime().AddDate(0, 0, days))
 	}
 }
 
@@ -225,6 +364,52 @@ func IsNotInUse() func(cloud.Snapshot) bool {
 	}
 }
 
+// SourceVolumeDeleted checks if the volume a snapshot was created from no
+// longer exists among the specified volumes. Since an empty list of volumes
+// most likely means they couldn't be listed, nothing is matched in that case.
+// GCP disks are identified by their zone and name, since that's how the
+// source of a GCP snapshot is identified.
+func SourceVolumeDeleted(existingVolumes []cloud.Volume) func(cloud.Snapshot) bool {
+	volumeIDs := make(map[string]struct{}, len(existingVolumes))
+	for _, vol := range existingVolumes {
+		if vol.CSP() == cloud.GCP {
+			volumeIDs[vol.Location()+"/"+vol.ID()] = struct{}{}
+		} else {
+			volumeIDs[vol.ID()] = struct{}{}
+		}
+	}
+	return func(s cloud.Snapshot) bool {
+		if s.SourceVolumeID() == "" || len(volumeIDs) == 0 {
+			return false
+		}
+		_, exist := volumeIDs[s.SourceVolumeID()]
+		return !exist
+	}
+}
+
+// Below are image rules
+
+// BackingSnapshotMissing checks if any of the snapshots backing an image no
+// longer exists among the specified snapshots. Since an empty list of snapshots
+// most likely means they couldn't be listed, nothing is matched in that case.
+func BackingSnapshotMissing(existingSnapshots []cloud.Snapshot) func(cloud.Image) bool {
+	snapshotIDs := make(map[string]struct{}, len(existingSnapshots))
+	for _, snap := range existingSnapshots {
+		snapshotIDs[snap.ID()] = struct{}{}
+	}
+	return func(i cloud.Image) bool {
+		if len(snapshotIDs) == 0 {
+			return false
+		}
+		for _, id := range i.BackingSnapshotIDs() {
+			if _, exist := snapshotIDs[id]; !exist {
+				return true
+			}
+		}
+		return false
+	}
+}
+
 // Below are bucket rules
 
 // NotModifiedInXDays returns bucket which have not had any modification
@@ -234,3 +419,44 @@ func NotModifiedInXDays(days int) func(cloud.Bucket) bool {
 		return time.Now().After(b.LastModified().AddDate(0, 0, days))
 	}
 }
+
+func tagNumber(r cloud.Resource, tagKey string) (float64, bool) {
+	val, exist := TagValue(r, tagKey)
+	if !exist {
+		return 0, false
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+	if err != nil {
+		log.Printf("%s has a non-numeric %s tag: %s\n", r.ID(), tagKey, val)
+		return 0, false
+	}
+	return number, true
+}
+
+func tagTime(r cloud.Resource, tagKey string) (time.Time, bool) {
+	val, exist := TagValue(r, tagKey)
+	if !exist {
+		return time.Time{}, false
+	}
+	t, err := ParseTagTime(val)
+	if err != nil {
+		log.Printf("%s has a malformed %s tag: %s\n", r.ID(), tagKey, val)
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// timeTagPassed checks if the time given by a housekeeper tag has passed.
+// Resources with a malformed tag are never included, use MalformedTags
+// to find them.
+func timeTagPassed(r cloud.Resource, tagKey string, parse func(cloud.Resource) (time.Time, bool, error)) bool {
+	t, exist, err := parse(r)
+	if !exist {
+		return false
+	}
+	if err != nil {
+		log.Printf("%s has a malformed %s tag: %s\n", r.ID(), tagKey, err)
+		return false
+	}
+	return time.Now().After(t)
+}
@@ -5,6 +5,8 @@ package filter
 
 import (
 	"brkt/cloudsweeper/cloud"
+	"regexp"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -292,6 +294,30 @@ func TestDeletePassed(t *testing.T) {
 	}
 }
 
+func TestStopped(t *testing.T) {
+	inst := &testInstance{}
+	inst.state = cloud.InstanceStateRunning
+	inst.transitionTime = time.Now().AddDate(0, 0, -10)
+
+	if !IsRunning()(inst) {
+		t.Error("Instance is running")
+	}
+
+	if IsStopped()(inst) || StoppedForXDays(5)(inst) {
+		t.Error("Instance is not stopped")
+	}
+
+	inst.state = cloud.InstanceStateStopped
+
+	if !StoppedForXDays(5)(inst) {
+		t.Error("Instance has been stopped for more than 5 days")
+	}
+
+	if StoppedForXDays(15)(inst) {
+		t.Error("Instance has not been stopped for more than 15 days")
+	}
+}
+
 type testVolume struct {
 	testResource
 	attached bool
@@ -329,6 +355,8 @@ type testBucket struct {
 func (b *testBucket) LastModified() time.Time { return b.lastModified }
 func (b *testBucket) ObjectCount() int64      { return 10 }
 func (b *testBucket) TotalSizeGB() float64    { return 5.13 }
+func (b *testBucket) Encrypted() bool         { return true }
+func (b *testBucket) MakePrivate() error      { return nil }
 
 func TestNotModified(t *testing.T) {
 	foo := &testBucket{
@@ -349,17 +377,22 @@ func TestNotModified(t *testing.T) {
 
 type testSnap struct {
 	testResource
-	inUse bool
+	inUse          bool
+	sourceVolumeID string
 }
 
-func (s *testSnap) Encrypted() bool { return false }
-func (s *testSnap) SizeGB() int64   { return 5 }
-func (s *testSnap) InUse() bool     { return s.inUse }
+func (s *testSnap) Encrypted() bool    { return false }
+func (s *testSnap) SizeGB() int64      { return 5 }
+func (s *testSnap) InUse() bool        { return s.inUse }
+func (s *testSnap) MakePrivate() error { return nil }
+
+func (s *testSnap) SourceVolumeID() string { return s.sourceVolumeID }
 
 func TestInUse(t *testing.T) {
 	foo := &testSnap{
 		testResource{time.Now(), map[string]string{}},
 		false,
+		"",
 	}
 
 	if IsInUse()(foo) {
@@ -372,3 +405,199 @@ func TestInUse(t *testing.T) {
 		t.Error("Snapshot is in use")
 	}
 }
+
+func TestUnencrypted(t *testing.T) {
+	vol := &testVolume{
+		testResource{time.Now(), map[string]string{}},
+		false,
+	}
+	if !IsUnencrypted()(vol) {
+		t.Error("Volume is not encrypted")
+	}
+
+	buck := &testBucket{
+		testResource{time.Now(), map[string]string{}},
+		time.Now(),
+	}
+	if IsUnencrypted()(buck) {
+		t.Error("Bucket is encrypted")
+	}
+
+	inst := &testInstance{}
+	if IsUnencrypted()(inst) {
+		t.Error("Instances can't be encrypted")
+	}
+
+	img := &testImg{}
+	if !IsUnencrypted()(img) {
+		t.Error("Image is not encrypted")
+	}
+	img.instanceStore = true
+	if IsUnencrypted()(img) {
+		t.Error("Instance store images can't be encrypted")
+	}
+}
+
+func TestSourceVolumeDeleted(t *testing.T) {
+	vol := &testVolume{}
+	snap := &testSnap{}
+	existing := []cloud.Volume{vol}
+
+	if SourceVolumeDeleted(existing)(snap) {
+		t.Error("Snapshot has no source volume")
+	}
+
+	snap.sourceVolumeID = testID
+	if SourceVolumeDeleted(existing)(snap) {
+		t.Error("Source volume still exists")
+	}
+
+	snap.sourceVolumeID = "some-deleted-volume"
+	if !SourceVolumeDeleted(existing)(snap) {
+		t.Error("Source volume has been deleted")
+	}
+
+	if SourceVolumeDeleted([]cloud.Volume{})(snap) {
+		t.Error("Should not match without any known volumes")
+	}
+
+	// GCP disk names are only unique within a zone
+	disk := &testGCPVolume{testVolume{}, "us-central1-a"}
+	snap.sourceVolumeID = "us-central1-a/" + testID
+	if SourceVolumeDeleted([]cloud.Volume{disk})(snap) {
+		t.Error("Source disk still exists")
+	}
+	snap.sourceVolumeID = "us-central1-b/" + testID
+	if !SourceVolumeDeleted([]cloud.Volume{disk})(snap) {
+		t.Error("A disk with the same name in another zone is not the source")
+	}
+	// Regional disks are located in their region
+	regional := &testGCPVolume{testVolume{}, "us-central1"}
+	snap.sourceVolumeID = "us-central1/" + testID
+	if SourceVolumeDeleted([]cloud.Volume{disk, regional})(snap) {
+		t.Error("Source regional disk still exists")
+	}
+}
+
+type testGCPVolume struct {
+	testVolume
+	zone string
+}
+
+func (v *testGCPVolume) CSP() cloud.CSP   { return cloud.GCP }
+func (v *testGCPVolume) Location() string { return v.zone }
+
+func TestBackingSnapshotMissing(t *testing.T) {
+	snap := &testSnap{}
+	img := &testImg{}
+	existing := []cloud.Snapshot{snap}
+
+	if BackingSnapshotMissing(existing)(img) {
+		t.Error("Image is not backed by snapshots")
+	}
+
+	img.snapshotIDs = []string{testID}
+	if BackingSnapshotMissing(existing)(img) {
+		t.Error("Backing snapshot still exists")
+	}
+
+	img.snapshotIDs = []string{testID, "some-deleted-snapshot"}
+	if !BackingSnapshotMissing(existing)(img) {
+		t.Error("Backing snapshot is missing")
+	}
+
+	if BackingSnapshotMissing([]cloud.Snapshot{})(img) {
+		t.Error("Should not match without any known snapshots")
+	}
+}
+
+func TestTagEquals(t *testing.T) {
+	res := &testResource{time.Now(), map[string]string{"env": "ci"}}
+	if !TagEquals("env", "ci")(res) {
+		t.Error("Tag value is equal")
+	}
+	if !TagEquals("Env", "ci")(res) {
+		t.Error("Tag keys should be case insensitive")
+	}
+	if TagEquals("env", "prod")(res) || TagEquals("owner", "ci")(res) {
+		t.Error("Tag value is not equal")
+	}
+}
+
+func TestTagMatches(t *testing.T) {
+	res := &testResource{time.Now(), map[string]string{"branch": "feature/cleanup-42"}}
+	if !TagMatchesRegexp("branch", regexp.MustCompile(`^feature/.*-\d+$`))(res) {
+		t.Error("Tag value should match regexp")
+	}
+	if TagMatchesRegexp("branch", regexp.MustCompile(`^release/`))(res) {
+		t.Error("Tag value should not match regexp")
+	}
+	if !TagMatchesGlob("branch", "feature/*")(res) {
+		t.Error("Tag value should match glob")
+	}
+	if TagMatchesGlob("branch", "release/*")(res) || TagMatchesGlob("missing", "*")(res) {
+		t.Error("Tag value should not match glob")
+	}
+}
+
+func TestTagNumber(t *testing.T) {
+	res := &testResource{time.Now(), map[string]string{"build-number": "120", "bad": "abc"}}
+	if !TagNumberAbove("build-number", 100)(res) || TagNumberAbove("build-number", 120)(res) {
+		t.Error("Wrong result comparing tag number")
+	}
+	if !TagNumberBelow("build-number", 121)(res) || TagNumberBelow("build-number", 50)(res) {
+		t.Error("Wrong result comparing tag number")
+	}
+	if TagNumberAbove("bad", 0)(res) || TagNumberBelow("bad", 1000)(res) {
+		t.Error("Non-numeric tag values should never match")
+	}
+}
+
+func TestTagDate(t *testing.T) {
+	old := time.Now().AddDate(0, 0, -20)
+	res := &testResource{time.Now(), map[string]string{
+		"built":    old.Format(time.RFC3339),
+		"day":      old.Format(ExpiryTagValueFormat),
+		"unix":     strconv.FormatInt(old.Unix(), 10),
+		"bad-date": "last tuesday",
+	}}
+	for _, key := range []string{"built", "day", "unix"} {
+		if !TagDateOlderThanXDays(key, 14)(res) || TagDateOlderThanXDays(key, 30)(res) {
+			t.Errorf("Wrong age of %s tag", key)
+		}
+		if !TagDateBefore(key, time.Now())(res) || TagDateAfter(key, time.Now())(res) {
+			t.Errorf("Wrong comparison of %s tag", key)
+		}
+	}
+	if TagDateOlderThanXDays("bad-date", 1)(res) || TagDateBefore("bad-date", time.Now())(res) {
+		t.Error("Malformed dates should never match")
+	}
+}
+
+func TestTagMissingOrEmpty(t *testing.T) {
+	res := &testResource{time.Now(), map[string]string{"owner": "", "env": "ci"}}
+	if !TagMissingOrEmpty("owner")(res) || !TagMissingOrEmpty("team")(res) {
+		t.Error("Tag is missing or empty")
+	}
+	if TagMissingOrEmpty("env")(res) {
+		t.Error("Tag has a value")
+	}
+}
+
+func TestCostRules(t *testing.T) {
+	// 10 GB of AWS snapshot storage, at $0.05 per GB and month
+	img := &testImg{testResource: testResource{time.Now().AddDate(0, 0, -60), map[string]string{}}}
+
+	if !DailyCostAbove(0.01)(img) || DailyCostAbove(0.1)(img) {
+		t.Error("Wrong daily cost")
+	}
+	if !AccumulatedCostAbove(0.9)(img) || AccumulatedCostAbove(1.1)(img) {
+		t.Error("Wrong accumulated cost")
+	}
+
+	fil := New()
+	fil.AddGeneralRule(Negate(DailyCostAbove(1)))
+	if len(Images([]cloud.Image{img}, fil)) != 1 {
+		t.Error("Cheap image should be included")
+	}
+}
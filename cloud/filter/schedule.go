@@ -0,0 +1,175 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Schedule is the parsed value of the schedule tag, which specifies when
+// an instance should be running. The format is "days start-end zone", for
+// example "mon-fri 08:00-19:00 America/Los_Angeles". The days can be a
+// range, a comma separated list or "daily", and the time zone defaults to
+// UTC. A window that ends before it starts runs past midnight, into the
+// following day.
+type Schedule struct {
+	Days     map[time.Weekday]bool
+	Start    time.Duration
+	End      time.Duration
+	Location *time.Location
+}
+
+// ParseSchedule parses the value of a schedule tag
+func ParseSchedule(value string) (Schedule, error) {
+	fields := strings.Fields(strings.ToLower(value))
+	if len(fields) < 2 || len(fields) > 3 {
+		return Schedule{}, fmt.Errorf("\"%s\" is not on the format \"days start-end [zone]\"", value)
+	}
+	days, err := parseWeekdays(fields[0])
+	if err != nil {
+		return Schedule{}, err
+	}
+	window := strings.Split(fields[1], "-")
+	if len(window) != 2 {
+		return Schedule{}, fmt.Errorf("\"%s\" is not a time window such as 08:00-19:00", fields[1])
+	}
+	start, err := parseTimeOfDay(window[0])
+	if err != nil {
+		return Schedule{}, err
+	}
+	end, err := parseTimeOfDay(window[1])
+	if err != nil {
+		return Schedule{}, err
+	}
+	if start == end {
+		return Schedule{}, fmt.Errorf("time window %s is empty", fields[1])
+	}
+	loc := time.UTC
+	if len(fields) == 3 {
+		// Time zone names are case sensitive, so use the original value
+		loc, err = time.LoadLocation(strings.Fields(value)[2])
+		if err != nil {
+			return Schedule{}, fmt.Errorf("unknown time zone \"%s\"", strings.Fields(value)[2])
+		}
+	}
+	return Schedule{Days: days, Start: start, End: end, Location: loc}, nil
+}
+
+// Active checks if an instance on this schedule should be running at
+// the specified time
+func (s Schedule) Active(t time.Time) bool {
+	t = t.In(s.Location)
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	yesterday := (t.Weekday() + 6) % 7
+	if s.Start < s.End {
+		return s.Days[t.Weekday()] && sinceMidnight >= s.Start && sinceMidnight < s.End
+	}
+	return (s.Days[t.Weekday()] && sinceMidnight >= s.Start) || (s.Days[yesterday] && sinceMidnight < s.End)
+}
+
+// HoursPerWeek returns how many hours per week an instance on this
+// schedule is running
+func (s Schedule) HoursPerWeek() float64 {
+	window := s.End - s.Start
+	if window < 0 {
+		window += day
+	}
+	return float64(len(s.Days)) * window.Hours()
+}
+
+// GetSchedule returns the parsed schedule tag of a resource, and whether
+// the resource has a schedule tag at all
+func GetSchedule(r cloud.Resource) (Schedule, bool, error) {
+	value, exist := TagValue(r, ScheduleTagKey)
+	if !exist {
+		return Schedule{}, false, nil
+	}
+	s, err := ParseSchedule(value)
+	return s, true, err
+}
+
+// OutsideSchedule checks if an instance has a schedule, and the current
+// time is outside of it. Instances with a malformed schedule are never
+// included.
+func OutsideSchedule() func(cloud.Instance) bool {
+	return func(i cloud.Instance) bool {
+		s, ok := instanceSchedule(i)
+		return ok && !s.Active(time.Now())
+	}
+}
+
+// WithinSchedule checks if an instance has a schedule, and the current
+// time is within it
+func WithinSchedule() func(cloud.Instance) bool {
+	return func(i cloud.Instance) bool {
+		s, ok := instanceSchedule(i)
+		return ok && s.Active(time.Now())
+	}
+}
+
+func instanceSchedule(i cloud.Instance) (Schedule, bool) {
+	s, exist, err := GetSchedule(i)
+	if !exist {
+		return Schedule{}, false
+	}
+	if err != nil {
+		log.Printf("%s has a malformed %s tag: %s\n", i.ID(), ScheduleTagKey, err)
+		return Schedule{}, false
+	}
+	return s, true
+}
+
+func parseWeekdays(value string) (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool)
+	if value == "daily" || value == "*" {
+		for _, d := range weekdays {
+			days[d] = true
+		}
+		return days, nil
+	}
+	for _, part := range strings.Split(value, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return nil, fmt.Errorf("\"%s\" is not a range of days", part)
+		}
+		first, ok := weekdays[bounds[0]]
+		if !ok {
+			return nil, fmt.Errorf("\"%s\" is not a day, use mon, tue, etc.", bounds[0])
+		}
+		last, ok := weekdays[bounds[len(bounds)-1]]
+		if !ok {
+			return nil, fmt.Errorf("\"%s\" is not a day, use mon, tue, etc.", bounds[len(bounds)-1])
+		}
+		// Ranges can wrap around the end of the week, such as fri-mon
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("\"%s\" is not a time of day such as 08:00", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	s, err := ParseSchedule("mon-fri 08:00-19:00")
+	if err != nil {
+		t.Fatalf("Could not parse schedule: %s", err)
+	}
+	if s.HoursPerWeek() != 55 {
+		t.Errorf("Expected 55 hours per week, got %.1f", s.HoursPerWeek())
+	}
+	if s.Location != time.UTC {
+		t.Errorf("Schedule should default to UTC, got %s", s.Location)
+	}
+
+	for _, valid := range []string{"daily 22:00-06:00", "mon,wed,fri 09:00-17:00", "fri-mon 00:00-23:59 UTC"} {
+		if _, err := ParseSchedule(valid); err != nil {
+			t.Errorf("Schedule \"%s\" should be valid: %s", valid, err)
+		}
+	}
+	for _, invalid := range []string{"", "mon-fri", "weekdays 08:00-19:00", "mon-fri 8-19", "mon-fri 08:00-08:00", "mon-fri 08:00-19:00 Mars/Olympus"} {
+		if _, err := ParseSchedule(invalid); err == nil {
+			t.Errorf("Schedule \"%s\" should not be valid", invalid)
+		}
+	}
+}
+
+func TestScheduleActive(t *testing.T) {
+	// 2018-06-18 is a Monday
+	office, _ := ParseSchedule("mon-fri 08:00-19:00")
+	if !office.Active(time.Date(2018, 6, 18, 8, 0, 0, 0, time.UTC)) {
+		t.Error("Schedule should be active at the start of the window")
+	}
+	if office.Active(time.Date(2018, 6, 18, 19, 0, 0, 0, time.UTC)) {
+		t.Error("Schedule should not be active at the end of the window")
+	}
+	if office.Active(time.Date(2018, 6, 17, 12, 0, 0, 0, time.UTC)) {
+		t.Error("Schedule should not be active on a Sunday")
+	}
+
+	night, _ := ParseSchedule("fri 22:00-06:00")
+	if !night.Active(time.Date(2018, 6, 23, 2, 0, 0, 0, time.UTC)) {
+		t.Error("Overnight window should continue into Saturday")
+	}
+	if night.Active(time.Date(2018, 6, 22, 2, 0, 0, 0, time.UTC)) {
+		t.Error("Overnight window should not include early Friday")
+	}
+	if night.HoursPerWeek() != 8 {
+		t.Errorf("Expected 8 hours per week, got %.1f", night.HoursPerWeek())
+	}
+}
+
+func TestScheduleRules(t *testing.T) {
+	now := time.Now().UTC()
+	window := func(from, to time.Duration) string {
+		return "daily " + now.Add(from).Format("15:04") + "-" + now.Add(to).Format("15:04")
+	}
+	inside := &testInstance{}
+	inside.tags = map[string]string{ScheduleTagKey: window(-time.Hour, time.Hour)}
+	outside := &testInstance{}
+	outside.tags = map[string]string{ScheduleTagKey: window(2*time.Hour, 3*time.Hour)}
+	unscheduled := &testInstance{}
+	unscheduled.tags = map[string]string{}
+
+	fil := New()
+	fil.AddInstanceRule(OutsideSchedule())
+	filtered := Instances([]cloud.Instance{inside, outside, unscheduled}, fil)
+	if len(filtered) != 1 || filtered[0] != outside {
+		t.Error("Only the instance outside its schedule should be included")
+	}
+	if !WithinSchedule()(inside) || WithinSchedule()(outside) {
+		t.Error("Wrong instances within their schedule")
+	}
+	if WithinSchedule()(unscheduled) || OutsideSchedule()(unscheduled) {
+		t.Error("Instances without a schedule should never be included")
+	}
+}
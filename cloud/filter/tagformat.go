@@ -0,0 +1,271 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+)
+
+// minUnixTimestampDigits is the number of digits in Unix timestamps since
+// September 2001
+const minUnixTimestampDigits = 10
+
+var (
+	// Timestamps that aren't RFC3339 are still accepted with a space
+	// instead of a T, without seconds or without a time zone (UTC)
+	tagTimeFormats = []string{
+		time.RFC3339,
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02 15:04Z07:00",
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+		ExpiryTagValueFormat,
+	}
+
+	shortDurationRegexp = regexp.MustCompile(`^(\d+)\s*(h|d|w)$`)
+	isoDurationRegexp   = regexp.MustCompile(`^p(?:(\d+)w)?(?:(\d+)d)?(?:t(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s)?)?$`)
+	isoDurationUnits    = []time.Duration{week, day, time.Hour, time.Minute, time.Second}
+)
+
+// ParseTagTime parses a date or timestamp from a tag value. The value can
+// be a RFC3339 timestamp, a date on the format YYYY-MM-DD or a Unix
+// timestamp in seconds. Unix timestamps must have at least 10 digits, so
+// that numbers such as "30" or "20231201" aren't taken for dates in 1970
+// and make resources expire. Timestamps can also be given without seconds,
+// with a space instead of a T, or followed by the name of a time zone,
+// such as "2018-06-17 18:00 Europe/Stockholm". Timestamps without any
+// time zone are in UTC.
+func ParseTagTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	loc := time.UTC
+	if i := strings.LastIndex(value, " "); i > 0 {
+		if zone, err := time.LoadLocation(value[i+1:]); err == nil {
+			loc = zone
+			value = strings.TrimSpace(value[:i])
+		}
+	}
+	for _, format := range tagTimeFormats {
+		if t, err := time.ParseInLocation(format, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if len(value) < minUnixTimestampDigits {
+			return time.Time{}, fmt.Errorf("\"%s\" is not a date, Unix timestamps must have at least %d digits", value, minUnixTimestampDigits)
+		}
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("\"%s\" is not a date or timestamp", value)
+}
+
+// ParseLifetime parses the value of a lifetime tag into the duration the
+// resource should be kept for. Besides the original "days-X" format the
+// value can be a number of days, a number followed by a unit (h, d or w,
+// e.g. "36h" or "2w"), a Go duration such as "90m", or an ISO 8601
+// duration such as "P10D" or "P1DT12H".
+func ParseLifetime(value string) (time.Duration, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	lifetime, err := parseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if lifetime <= 0 {
+		return 0, fmt.Errorf("lifetime \"%s\" must be positive", value)
+	}
+	return lifetime, nil
+}
+
+// ParseExpiry parses the value of an expiry tag into the time when the
+// resource expires. The value can be anything ParseTagTime accepts, or a
+// duration prefixed with "+" which is relative to when the resource was
+// created, e.g. "+2w".
+func ParseExpiry(value string, created time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "+") {
+		after, err := ParseLifetime(value[1:])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return created.Add(after), nil
+	}
+	return ParseTagTime(value)
+}
+
+// LifetimeEnd returns when the lifetime of a resource ends, and whether
+// the resource has a lifetime tag at all
+func LifetimeEnd(r cloud.Resource) (time.Time, bool, error) {
+	value, exist := TagValue(r, LifetimeTagKey)
+	if !exist {
+		return time.Time{}, false, nil
+	}
+	lifetime, err := ParseLifetime(value)
+	if err != nil {
+		return time.Time{}, true, err
+	}
+	return r.CreationTime().Add(lifetime), true, nil
+}
+
+// ExpiryTime returns when a resource expires, and whether the resource
+// has an expiry tag at all
+func ExpiryTime(r cloud.Resource) (time.Time, bool, error) {
+	value, exist := TagValue(r, ExpiryTagKey)
+	if !exist {
+		return time.Time{}, false, nil
+	}
+	expiry, err := ParseExpiry(value, r.CreationTime())
+	return expiry, true, err
+}
+
+// DeleteTime returns when a resource is marked to be deleted, and
+// whether the resource is marked for deletion at all
+func DeleteTime(r cloud.Resource) (time.Time, bool, error) {
+	value, exist := TagValue(r, DeleteTagKey)
+	if !exist {
+		return time.Time{}, false, nil
+	}
+	deleteAt, err := ParseTagTime(value)
+	return deleteAt, true, err
+}
+
+// MarkedTime returns when a resource was marked for deletion, and
+// whether the time it was marked is known at all
+func MarkedTime(r cloud.Resource) (time.Time, bool, error) {
+	value, exist := TagValue(r, MarkedAtTagKey)
+	if !exist {
+		return time.Time{}, false, nil
+	}
+	markedAt, err := ParseTagTime(value)
+	return markedAt, true, err
+}
+
+// Postponement returns when a resource was originally to be deleted, and
+// the name of the freeze its deletion was postponed by. The value of the
+// postponed tag is on the format "2018-12-24T10:00:00Z;Holidays".
+func Postponement(r cloud.Resource) (time.Time, string, bool) {
+	value, exist := TagValue(r, PostponedTagKey)
+	if !exist {
+		return time.Time{}, "", false
+	}
+	parts := strings.SplitN(value, ";", 2)
+	original, err := time.Parse(time.RFC3339, parts[0])
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	name := ""
+	if len(parts) == 2 {
+		name = parts[1]
+	}
+	return original, name, true
+}
+
+// FormatPostponement formats the value of a postponed tag
+func FormatPostponement(original time.Time, freeze string) string {
+	return fmt.Sprintf("%s;%s", original.UTC().Format(time.RFC3339), freeze)
+}
+
+// OffboardedTime returns when the handover of a resource started, and
+// whether it has started at all
+func OffboardedTime(r cloud.Resource) (time.Time, bool, error) {
+	value, exist := TagValue(r, OffboardedAtTagKey)
+	if !exist {
+		return time.Time{}, false, nil
+	}
+	offboardedAt, err := ParseTagTime(value)
+	return offboardedAt, true, err
+}
+
+// TagProblem describes a housekeeper tag with a value that can't be used
+type TagProblem struct {
+	Key   string
+	Value string
+	Err   error
+}
+
+func (p TagProblem) String() string {
+	return fmt.Sprintf("%s=\"%s\": %s", p.Key, p.Value, p.Err)
+}
+
+// MalformedTags returns all housekeeper tags of a resource that have
+// values which can't be parsed, sorted by key
+func MalformedTags(r cloud.Resource) []TagProblem {
+	problems := []TagProblem{}
+	check := func(key string, parse func(cloud.Resource) (time.Time, bool, error)) {
+		if _, _, err := parse(r); err != nil {
+			value, _ := TagValue(r, key)
+			problems = append(problems, TagProblem{key, value, err})
+		}
+	}
+	check(LifetimeTagKey, LifetimeEnd)
+	check(ExpiryTagKey, ExpiryTime)
+	check(DeleteTagKey, DeleteTime)
+	check(MarkedAtTagKey, MarkedTime)
+	check(OffboardedAtTagKey, OffboardedTime)
+	check(ScheduleTagKey, func(r cloud.Resource) (time.Time, bool, error) {
+		_, exist, err := GetSchedule(r)
+		return time.Time{}, exist, err
+	})
+	check(WhitelistTagKey, func(r cloud.Resource) (time.Time, bool, error) {
+		_, exist, err := GetWhitelist(r)
+		return time.Time{}, exist, err
+	})
+	sort.Slice(problems, func(i, j int) bool {
+		return problems[i].Key < problems[j].Key
+	})
+	return problems
+}
+
+// HasMalformedTags checks if a resource has any housekeeper tags with
+// values that can't be parsed
+func HasMalformedTags() func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		return len(MalformedTags(r)) > 0
+	}
+}
+
+// parseDuration parses the durations accepted by ParseLifetime
+func parseDuration(value string) (time.Duration, error) {
+	if strings.HasPrefix(value, "days-") {
+		days, err := strconv.Atoi(strings.TrimPrefix(value, "days-"))
+		if err != nil {
+			return 0, fmt.Errorf("\"%s\" is not a number of days", value)
+		}
+		return time.Duration(days) * day, nil
+	}
+	if days, err := strconv.Atoi(value); err == nil {
+		return time.Duration(days) * day, nil
+	}
+	if match := shortDurationRegexp.FindStringSubmatch(value); match != nil {
+		number, _ := strconv.Atoi(match[1])
+		unit := map[string]time.Duration{"h": time.Hour, "d": day, "w": week}[match[2]]
+		return time.Duration(number) * unit, nil
+	}
+	if match := isoDurationRegexp.FindStringSubmatch(value); match != nil && value != "p" && value != "pt" {
+		duration := time.Duration(0)
+		for i, part := range match[1:] {
+			if part != "" {
+				number, _ := strconv.Atoi(part)
+				duration += time.Duration(number) * isoDurationUnits[i]
+			}
+		}
+		return duration, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return duration, nil
+	}
+	return 0, fmt.Errorf("\"%s\" is not a duration", value)
+}
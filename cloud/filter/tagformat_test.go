@@ -0,0 +1,122 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLifetime(t *testing.T) {
+	valid := map[string]time.Duration{
+		"days-5":  5 * day,
+		"30":      30 * day,
+		"36h":     36 * time.Hour,
+		"2w":      2 * week,
+		"10d":     10 * day,
+		"90m":     90 * time.Minute,
+		"P10D":    10 * day,
+		"P2W":     2 * week,
+		"P1DT12H": 36 * time.Hour,
+		"PT30M":   30 * time.Minute,
+	}
+	for value, expected := range valid {
+		lifetime, err := ParseLifetime(value)
+		if err != nil {
+			t.Errorf("Could not parse lifetime %s: %s", value, err)
+		} else if lifetime != expected {
+			t.Errorf("Lifetime %s should be %s, got %s", value, expected, lifetime)
+		}
+	}
+
+	for _, invalid := range []string{"", "days-five", "forever", "P", "PT", "P1Y", "0", "-3d"} {
+		if _, err := ParseLifetime(invalid); err == nil {
+			t.Errorf("Lifetime \"%s\" should not be valid", invalid)
+		}
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	created := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	valid := map[string]time.Time{
+		"2018-06-17":                created.AddDate(0, 0, 16).Add(-12 * time.Hour),
+		"2018-06-17T18:00:00+02:00": time.Date(2018, 6, 17, 16, 0, 0, 0, time.UTC),
+		"2018-06-17 18:00":          time.Date(2018, 6, 17, 18, 0, 0, 0, time.UTC),
+		"+2w":                       created.AddDate(0, 0, 14),
+		"+P1DT12H":                  created.Add(36 * time.Hour),
+		"1529258400":                time.Date(2018, 6, 17, 18, 0, 0, 0, time.UTC),
+	}
+	for value, expected := range valid {
+		expiry, err := ParseExpiry(value, created)
+		if err != nil {
+			t.Errorf("Could not parse expiry %s: %s", value, err)
+		} else if !expiry.Equal(expected) {
+			t.Errorf("Expiry %s should be %s, got %s", value, expected, expiry)
+		}
+	}
+
+	for _, invalid := range []string{"soon", "+forever", "2018-13-01", "30", "20231201", "-5"} {
+		if _, err := ParseExpiry(invalid, created); err == nil {
+			t.Errorf("Expiry \"%s\" should not be valid", invalid)
+		}
+	}
+}
+
+func TestFlexibleLifetimeAndExpiry(t *testing.T) {
+	res := &testResource{time.Now().Add(-48 * time.Hour), map[string]string{LifetimeTagKey: "36h"}}
+	if !LifetimeExceeded()(res) {
+		t.Error("36h lifetime should be exceeded after two days")
+	}
+	res.tags[LifetimeTagKey] = "P1W"
+	if LifetimeExceeded()(res) {
+		t.Error("One week lifetime should not be exceeded after two days")
+	}
+
+	res.tags[ExpiryTagKey] = "+1d"
+	if !ExpiryDatePassed()(res) {
+		t.Error("Relative expiry should have passed")
+	}
+	res.tags[ExpiryTagKey] = time.Now().Add(time.Hour).Format(time.RFC3339)
+	if ExpiryDatePassed()(res) {
+		t.Error("Expiry in an hour should not have passed")
+	}
+
+	// Bare integers are not taken for Unix timestamps in 1970
+	for _, value := range []string{"30", "20231201"} {
+		res.tags[ExpiryTagKey] = value
+		if ExpiryDatePassed()(res) {
+			t.Errorf("Integer expiry %s should not expire the resource", value)
+		}
+		res.tags[DeleteTagKey] = value
+		if DeleteWithinXHours(48)(res) {
+			t.Errorf("Integer delete-at %s should not delete the resource", value)
+		}
+		delete(res.tags, DeleteTagKey)
+	}
+}
+
+func TestMalformedTags(t *testing.T) {
+	res := &testResource{time.Now(), map[string]string{
+		LifetimeTagKey:  "a while",
+		ExpiryTagKey:    "20231201",
+		DeleteTagKey:    "tomorrow",
+		WhitelistTagKey: "until=someday",
+	}}
+	problems := MalformedTags(res)
+	if len(problems) != 4 {
+		t.Fatalf("Expected 4 malformed tags, got %v", problems)
+	}
+	keys := []string{problems[0].Key, problems[1].Key, problems[2].Key, problems[3].Key}
+	if keys[0] != DeleteTagKey || keys[1] != ExpiryTagKey || keys[2] != LifetimeTagKey || keys[3] != WhitelistTagKey {
+		t.Errorf("Wrong malformed tags: %v", keys)
+	}
+	if !HasMalformedTags()(res) {
+		t.Error("Resource should have malformed tags")
+	}
+
+	valid := &testResource{time.Now(), map[string]string{LifetimeTagKey: "2w", ExpiryTagKey: "+P10D"}}
+	if HasMalformedTags()(valid) {
+		t.Errorf("Resource should not have malformed tags: %v", MalformedTags(valid))
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+const defaultNamespace = "housekeeper"
+
+// TagKeys are the keys of the tags housekeeper reads and writes. Running
+// several independent sweepers requires them to use different keys, so
+// that they don't act on each other's tags. The keys are configured with
+// a JSON file such as:
+//
+//	{
+//	    "namespace": "sweeper",
+//	    "whitelist": "sweeper-whitelisted",
+//	    "aliases": {"housekeeper-lifetime": "sweeper-lifetime"}
+//	}
+//
+// The namespace is the prefix of the lifetime, expiry, delete-at,
+// delete-reason, marked-at, postponed, release-stage, offboarded-at,
+// owner and schedule tags. Keys set explicitly take precedence.
+type TagKeys struct {
+	Namespace    string `json:"namespace,omitempty"`
+	Whitelist    string `json:"whitelist,omitempty"`
+	Lifetime     string `json:"lifetime,omitempty"`
+	Expiry       string `json:"expiry,omitempty"`
+	DeleteAt     string `json:"delete_at,omitempty"`
+	DeleteReason string `json:"delete_reason,omitempty"`
+	MarkedAt     string `json:"marked_at,omitempty"`
+	Postponed    string `json:"postponed,omitempty"`
+	ReleaseStage string `json:"release_stage,omitempty"`
+	OffboardedAt string `json:"offboarded_at,omitempty"`
+	Owner        string `json:"owner,omitempty"`
+	Schedule     string `json:"schedule,omitempty"`
+	Release      string `json:"release,omitempty"`
+	// Aliases maps legacy keys to the key that replaced them. Legacy keys
+	// are still read, until they've been migrated to the new key.
+	Aliases map[string]string `json:"aliases,omitempty"`
+}
+
+// aliases of the keys currently in use, see SetTagKeys
+var aliases = map[string]string{}
+
+// DefaultTagKeys returns the tag keys used unless configured otherwise
+func DefaultTagKeys() TagKeys {
+	return TagKeys{
+		Namespace:    defaultNamespace,
+		Whitelist:    "whitelisted",
+		Lifetime:     defaultNamespace + "-lifetime",
+		Expiry:       defaultNamespace + "-expiry",
+		DeleteAt:     defaultNamespace + "-delete-at",
+		DeleteReason: defaultNamespace + "-delete-reason",
+		MarkedAt:     defaultNamespace + "-marked-at",
+		Postponed:    defaultNamespace + "-postponed",
+		ReleaseStage: defaultNamespace + "-release-stage",
+		OffboardedAt: defaultNamespace + "-offboarded-at",
+		Owner:        defaultNamespace + "-owner",
+		Schedule:     defaultNamespace + "-schedule",
+		Release:      "Release",
+		Aliases:      map[string]string{},
+	}
+}
+
+// ParseTagKeys parses a JSON tag key configuration. Keys that are not
+// set are derived from the namespace, or use their default.
+func ParseTagKeys(data []byte) (TagKeys, error) {
+	keys := TagKeys{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&keys); err != nil {
+		return TagKeys{}, fmt.Errorf("Could not parse tag keys: %s", err)
+	}
+	defaults := DefaultTagKeys()
+	if keys.Namespace == "" {
+		keys.Namespace = defaults.Namespace
+	}
+	namespaced := func(key *string, suffix string) {
+		if *key == "" {
+			*key = keys.Namespace + suffix
+		}
+	}
+	namespaced(&keys.Lifetime, "-lifetime")
+	namespaced(&keys.Expiry, "-expiry")
+	namespaced(&keys.DeleteAt, "-delete-at")
+	namespaced(&keys.DeleteReason, "-delete-reason")
+	namespaced(&keys.MarkedAt, "-marked-at")
+	namespaced(&keys.Postponed, "-postponed")
+	namespaced(&keys.ReleaseStage, "-release-stage")
+	namespaced(&keys.OffboardedAt, "-offboarded-at")
+	namespaced(&keys.Owner, "-owner")
+	namespaced(&keys.Schedule, "-schedule")
+	if keys.Whitelist == "" {
+		keys.Whitelist = defaults.Whitelist
+	}
+	if keys.Release == "" {
+		keys.Release = defaults.Release
+	}
+	if keys.Aliases == nil {
+		keys.Aliases = map[string]string{}
+	}
+	return keys, keys.validate()
+}
+
+// LoadTagKeys reads a JSON tag key configuration from a file. If no file
+// is specified the default tag keys are returned.
+func LoadTagKeys(path string) (TagKeys, error) {
+	if path == "" {
+		return DefaultTagKeys(), nil
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return TagKeys{}, err
+	}
+	return ParseTagKeys(raw)
+}
+
+// SetTagKeys changes the tag keys used by all rules, and by housekeeper
+// when tagging resources
+func SetTagKeys(keys TagKeys) {
+	WhitelistTagKey = keys.Whitelist
+	LifetimeTagKey = keys.Lifetime
+	ExpiryTagKey = keys.Expiry
+	DeleteTagKey = keys.DeleteAt
+	DeleteReasonTagKey = keys.DeleteReason
+	MarkedAtTagKey = keys.MarkedAt
+	PostponedTagKey = keys.Postponed
+	ReleaseStageTagKey = keys.ReleaseStage
+	OffboardedAtTagKey = keys.OffboardedAt
+	OwnerTagKey = keys.Owner
+	ScheduleTagKey = keys.Schedule
+	ReleaseTagKey = keys.Release
+	aliases = make(map[string]string)
+	for legacy, key := range keys.Aliases {
+		aliases[legacy] = key
+	}
+}
+
+// Aliases returns a copy of the legacy tag keys currently in use, mapped
+// to the key that replaced them
+func Aliases() map[string]string {
+	copied := make(map[string]string)
+	for legacy, key := range aliases {
+		copied[legacy] = key
+	}
+	return copied
+}
+
+// LegacyKeys returns the legacy keys that are aliases of a tag key,
+// sorted alphabetically
+func LegacyKeys(tagKey string) []string {
+	legacy := []string{}
+	for old, key := range aliases {
+		if strings.ToLower(key) == strings.ToLower(tagKey) {
+			legacy = append(legacy, old)
+		}
+	}
+	sort.Strings(legacy)
+	return legacy
+}
+
+// TagValue looks up the value of a tag, ignoring the case of the key just
+// like HasTag does. If the resource doesn't have the tag, its legacy keys
+// are looked up instead.
+func TagValue(r cloud.Resource, tagKey string) (string, bool) {
+	if val, exist := lookupTag(r.Tags(), tagKey); exist {
+		return val, true
+	}
+	for _, legacy := range LegacyKeys(tagKey) {
+		if val, exist := lookupTag(r.Tags(), legacy); exist {
+			return val, true
+		}
+	}
+	return "", false
+}
+
+func (k TagKeys) validate() error {
+	names := []string{"whitelist", "lifetime", "expiry", "delete_at", "delete_reason", "marked_at", "postponed", "release_stage", "offboarded_at", "owner", "schedule", "release"}
+	keys := []string{k.Whitelist, k.Lifetime, k.Expiry, k.DeleteAt, k.DeleteReason, k.MarkedAt, k.Postponed, k.ReleaseStage, k.OffboardedAt, k.Owner, k.Schedule, k.Release}
+	inUse := make(map[string]string)
+	for i, key := range keys {
+		if other, exist := inUse[strings.ToLower(key)]; exist {
+			return fmt.Errorf("%s and %s both use the tag key %s", other, names[i], key)
+		}
+		inUse[strings.ToLower(key)] = names[i]
+	}
+	for legacy, key := range k.Aliases {
+		if _, exist := inUse[strings.ToLower(key)]; !exist {
+			return fmt.Errorf("alias %s refers to %s, which is not a tag key in use", legacy, key)
+		}
+		if name, exist := inUse[strings.ToLower(legacy)]; exist {
+			return fmt.Errorf("alias %s is the %s tag key in use", legacy, name)
+		}
+	}
+	return nil
+}
+
+func lookupTag(tags map[string]string, tagKey string) (string, bool) {
+	if val, exist := tags[tagKey]; exist {
+		return val, true
+	}
+	for key, val := range tags {
+		if strings.ToLower(key) == strings.ToLower(tagKey) {
+			return val, true
+		}
+	}
+	return "", false
+}
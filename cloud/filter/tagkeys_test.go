@@ -0,0 +1,69 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTagKeys(t *testing.T) {
+	keys, err := ParseTagKeys([]byte(`{"namespace": "sweeper", "whitelist": "sweeper-keep"}`))
+	if err != nil {
+		t.Fatalf("Could not parse tag keys: %s", err)
+	}
+	if keys.Lifetime != "sweeper-lifetime" || keys.DeleteAt != "sweeper-delete-at" || keys.Schedule != "sweeper-schedule" {
+		t.Errorf("Keys should be in the sweeper namespace: %+v", keys)
+	}
+	if keys.Whitelist != "sweeper-keep" || keys.Release != "Release" {
+		t.Errorf("Wrong whitelist or release keys: %+v", keys)
+	}
+
+	empty, err := ParseTagKeys([]byte(`{}`))
+	if err != nil || !reflect.DeepEqual(empty, DefaultTagKeys()) {
+		t.Errorf("An empty configuration should use the default keys: %+v", empty)
+	}
+
+	invalid := []string{
+		`{"lifetime": "whitelisted"}`,
+		`{"aliases": {"old-lifetime": "unknown-key"}}`,
+		`{"aliases": {"housekeeper-expiry": "housekeeper-lifetime"}}`,
+		`{"prefix": "sweeper"}`,
+	}
+	for _, raw := range invalid {
+		if _, err := ParseTagKeys([]byte(raw)); err == nil {
+			t.Errorf("Tag keys %s should not be valid", raw)
+		}
+	}
+}
+
+func TestTagKeyAliases(t *testing.T) {
+	keys, err := ParseTagKeys([]byte(`{"namespace": "sweeper", "aliases": {"housekeeper-lifetime": "sweeper-lifetime", "Keep": "whitelisted"}}`))
+	if err != nil {
+		t.Fatalf("Could not parse tag keys: %s", err)
+	}
+	SetTagKeys(keys)
+	defer SetTagKeys(DefaultTagKeys())
+
+	res := &testResource{time.Now().AddDate(0, 0, -10), map[string]string{"housekeeper-lifetime": "5d"}}
+	if !LifetimeExceeded()(res) {
+		t.Error("The legacy lifetime tag should still be read")
+	}
+	if !HasTag(LifetimeTagKey)(res) {
+		t.Error("HasTag should consider legacy keys")
+	}
+	res.tags[LifetimeTagKey] = "30d"
+	if LifetimeExceeded()(res) {
+		t.Error("The new lifetime tag should take precedence over the legacy one")
+	}
+
+	kept := &testResource{time.Now(), map[string]string{"keep": ""}}
+	if !IsWhitelisted(kept) {
+		t.Error("Legacy whitelist tag should still whitelist the resource")
+	}
+	if !reflect.DeepEqual(LegacyKeys(WhitelistTagKey), []string{"Keep"}) {
+		t.Errorf("Wrong legacy keys: %v", LegacyKeys(WhitelistTagKey))
+	}
+}
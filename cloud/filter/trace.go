@@ -0,0 +1,114 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"fmt"
+	"strings"
+)
+
+// Trace records the outcome of every named filter that was evaluated
+// for a resource, which is used to explain why a resource was, or
+// wasn't, matched by a filter
+type Trace struct {
+	Steps []TraceStep
+	depth int
+}
+
+// TraceStep is the outcome of a single named filter. Depth is how many
+// named filters the filter is nested in.
+type TraceStep struct {
+	Rule    string
+	Matched bool
+	Depth   int
+}
+
+// Named returns a filter with the specified name, which matches the same
+// resources as the specified filter or rule. Only named filters are
+// included in evaluation traces.
+func Named(name string, rule interface{}) *ResourceFilter {
+	result := And(rule)
+	result.name = name
+	return result
+}
+
+// Explain evaluates the filter for a resource, just like when filtering
+// resources, and returns the result together with a trace of all named
+// filters that were evaluated. Evaluation stops as soon as the outcome is
+// known, so not every named filter is necessarily included in the trace.
+func (f *ResourceFilter) Explain(resource cloud.Resource) (bool, *Trace) {
+	trace := new(Trace)
+	return f.include(resource, trace), trace
+}
+
+// Matched returns the names of all filters that matched
+func (t *Trace) Matched() []string {
+	return t.withOutcome(true)
+}
+
+// Failed returns the names of all filters that didn't match
+func (t *Trace) Failed() []string {
+	return t.withOutcome(false)
+}
+
+// Reason returns a single line summary of why the resource was matched,
+// listing every matched top level filter followed by the matched filters
+// it contains, such as "old: older_than_months(months=6), unattached"
+func (t *Trace) Reason() string {
+	parts := []string{}
+	for i, step := range t.Steps {
+		if step.Depth > 0 || !step.Matched {
+			continue
+		}
+		nested := []string{}
+		for _, child := range t.Steps[i+1:] {
+			if child.Depth == 0 {
+				break
+			}
+			if child.Matched {
+				nested = append(nested, child.Rule)
+			}
+		}
+		if len(nested) > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %s", step.Rule, strings.Join(nested, ", ")))
+		} else {
+			parts = append(parts, step.Rule)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// String returns the full trace, with one filter per line
+func (t *Trace) String() string {
+	lines := []string{}
+	for _, step := range t.Steps {
+		outcome := "matched"
+		if !step.Matched {
+			outcome = "failed"
+		}
+		lines = append(lines, fmt.Sprintf("%s%s: %s", strings.Repeat("  ", step.Depth), step.Rule, outcome))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (t *Trace) withOutcome(matched bool) []string {
+	result := []string{}
+	for _, step := range t.Steps {
+		if step.Matched == matched {
+			result = append(result, step.Rule)
+		}
+	}
+	return result
+}
+
+// record adds a step to the trace and returns its index. Recording
+// to a nil trace does nothing.
+func (t *Trace) record(rule string, depth int, matched bool) int {
+	if t == nil {
+		return -1
+	}
+	t.Steps = append(t.Steps, TraceStep{rule, matched, depth})
+	return len(t.Steps) - 1
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExplain(t *testing.T) {
+	vol := &testVolume{testResource{time.Now().AddDate(0, 0, -10), map[string]string{}}, false}
+
+	fil := Named("old-volumes", And(
+		Named("older than 5 days", OlderThanXDays(5)),
+		Named("unattached", IsUnattached()),
+		Named("not released", Not(HasTag("Release"))),
+	))
+	included, trace := fil.Explain(vol)
+	if !included {
+		t.Fatal("Volume should be included")
+	}
+	expected := []string{"old-volumes", "older than 5 days", "unattached", "not released"}
+	if !reflect.DeepEqual(trace.Matched(), expected) {
+		t.Errorf("Wrong matched filters: %v", trace.Matched())
+	}
+	if trace.Reason() != "old-volumes: older than 5 days, unattached, not released" {
+		t.Errorf("Wrong reason: %s", trace.Reason())
+	}
+
+	vol.attached = true
+	included, trace = fil.Explain(vol)
+	if included {
+		t.Fatal("Attached volume should not be included")
+	}
+	if !reflect.DeepEqual(trace.Failed(), []string{"old-volumes", "unattached"}) {
+		t.Errorf("Wrong failed filters: %v", trace.Failed())
+	}
+	if trace.Reason() != "" {
+		t.Errorf("Unmatched resource should have no reason: %s", trace.Reason())
+	}
+}
+
+func TestExplainSkipsOtherKinds(t *testing.T) {
+	inst := &testInstance{}
+	inst.creationTime = time.Now().AddDate(0, 0, -10)
+
+	fil := Named("old", And(
+		Named("older than 5 days", OlderThanXDays(5)),
+		Named("unattached", IsUnattached()),
+	))
+	included, trace := fil.Explain(inst)
+	if !included {
+		t.Fatal("Instance should be included")
+	}
+	if !reflect.DeepEqual(trace.Matched(), []string{"old", "older than 5 days"}) {
+		t.Errorf("Volume rule should not be part of the trace: %v", trace.Matched())
+	}
+}
+
+func TestExplainWhitelisted(t *testing.T) {
+	vol := &testVolume{testResource{time.Now(), map[string]string{WhitelistTagKey: ""}}, false}
+	included, trace := Named("unattached", IsUnattached()).Explain(vol)
+	if included {
+		t.Fatal("Whitelisted volume should not be included")
+	}
+	if !reflect.DeepEqual(trace.Failed(), []string{WhitelistTagKey}) {
+		t.Errorf("Whitelist should be part of the trace: %v", trace.Failed())
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	whitelistUntilKey  = "until"
+	whitelistReasonKey = "reason"
+)
+
+// Whitelist is the parsed value of the whitelist tag. An empty value
+// whitelists the resource indefinitely, while a value on the format
+// "until=2026-12-31;reason=perf-lab" whitelists the resource until the
+// specified date has passed, and states why. Both parts are optional.
+type Whitelist struct {
+	// Until is when the whitelisting lapses, or the zero time if it never does
+	Until  time.Time
+	Reason string
+}
+
+// ParseWhitelist parses the value of a whitelist tag. Values that don't
+// use the key=value format are treated as a reason for whitelisting the
+// resource indefinitely, unless they're just "true" or "yes".
+func ParseWhitelist(value string) (Whitelist, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "=") {
+		switch strings.ToLower(value) {
+		case "", "true", "yes":
+			return Whitelist{}, nil
+		default:
+			return Whitelist{Reason: value}, nil
+		}
+	}
+	wl := Whitelist{}
+	for _, part := range strings.Split(value, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		keyVal := strings.SplitN(part, "=", 2)
+		if len(keyVal) != 2 {
+			return Whitelist{}, fmt.Errorf("\"%s\" is not on the format key=value", part)
+		}
+		key, val := strings.ToLower(strings.TrimSpace(keyVal[0])), strings.TrimSpace(keyVal[1])
+		switch key {
+		case whitelistUntilKey:
+			until, err := ParseTagTime(val)
+			if err != nil {
+				return Whitelist{}, err
+			}
+			if _, err := time.Parse(ExpiryTagValueFormat, val); err == nil {
+				// A date is whitelisted until the end of that day
+				until = until.AddDate(0, 0, 1)
+			}
+			wl.Until = until
+		case whitelistReasonKey:
+			wl.Reason = val
+		default:
+			return Whitelist{}, fmt.Errorf("unknown whitelist key \"%s\"", key)
+		}
+	}
+	return wl, nil
+}
+
+// Permanent checks if the whitelisting never lapses
+func (w Whitelist) Permanent() bool {
+	return w.Until.IsZero()
+}
+
+// Expired checks if the whitelisting has lapsed
+func (w Whitelist) Expired() bool {
+	return !w.Permanent() && time.Now().After(w.Until)
+}
+
+// GetWhitelist returns the parsed whitelist tag of a resource, and
+// whether the resource has a whitelist tag at all
+func GetWhitelist(r cloud.Resource) (Whitelist, bool, error) {
+	value, exist := TagValue(r, WhitelistTagKey)
+	if !exist {
+		return Whitelist{}, false, nil
+	}
+	wl, err := ParseWhitelist(value)
+	return wl, true, err
+}
+
+// IsWhitelisted checks if a resource is currently whitelisted. Resources
+// with a malformed whitelist tag are considered whitelisted, to avoid
+// cleaning up resources the owner tried to keep.
+func IsWhitelisted(r cloud.Resource) bool {
+	wl, exist, err := GetWhitelist(r)
+	if !exist {
+		return false
+	}
+	if err != nil {
+		log.Printf("%s has a malformed whitelist tag: %s\n", r.ID(), err)
+		return true
+	}
+	return !wl.Expired()
+}
+
+// WhitelistExpiresWithinXDays checks if a resource has a whitelisting
+// which lapses within the specified amount of days. This includes
+// whitelists that have already lapsed.
+func WhitelistExpiresWithinXDays(days int) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		wl, exist, err := GetWhitelist(r)
+		if !exist || err != nil || wl.Permanent() {
+			return false
+		}
+		return time.Now().AddDate(0, 0, days).After(wl.Until)
+	}
+}
+
+// WhitelistUnjustified checks if a resource is whitelisted without
+// stating a reason, or with a malformed whitelist tag
+func WhitelistUnjustified() func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		wl, exist, err := GetWhitelist(r)
+		return exist && (err != nil || wl.Reason == "")
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"testing"
+	"time"
+)
+
+func TestParseWhitelist(t *testing.T) {
+	wl, err := ParseWhitelist("until=2026-12-31;reason=perf-lab")
+	if err != nil {
+		t.Fatalf("Could not parse whitelist: %s", err)
+	}
+	if wl.Reason != "perf-lab" {
+		t.Errorf("Wrong reason: %s", wl.Reason)
+	}
+	// The whitelisting should last the whole day
+	if !wl.Until.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Wrong until: %s", wl.Until)
+	}
+
+	for _, permanent := range []string{"", "true", "Yes", "reason=build server"} {
+		wl, err = ParseWhitelist(permanent)
+		if err != nil || !wl.Permanent() {
+			t.Errorf("\"%s\" should whitelist indefinitely", permanent)
+		}
+	}
+
+	wl, err = ParseWhitelist("needed by the perf lab")
+	if err != nil || !wl.Permanent() || wl.Reason != "needed by the perf lab" {
+		t.Error("Free text should be treated as the reason")
+	}
+
+	for _, malformed := range []string{"until=someday", "owner=me", "until=2026-12-31;perf-lab"} {
+		if _, err = ParseWhitelist(malformed); err == nil {
+			t.Errorf("\"%s\" should not be a valid whitelist", malformed)
+		}
+	}
+}
+
+func TestWhitelistExpiry(t *testing.T) {
+	future := time.Now().AddDate(0, 1, 0).Format(ExpiryTagValueFormat)
+	past := time.Now().AddDate(0, 0, -2).Format(ExpiryTagValueFormat)
+	active := &testVolume{testResource{time.Now(), map[string]string{WhitelistTagKey: "until=" + future}}, false}
+	expired := &testVolume{testResource{time.Now(), map[string]string{WhitelistTagKey: "until=" + past}}, false}
+	malformed := &testVolume{testResource{time.Now(), map[string]string{WhitelistTagKey: "until=someday"}}, false}
+
+	if !IsWhitelisted(active) || IsWhitelisted(expired) {
+		t.Error("Whitelist expiry not honoured")
+	}
+	if !IsWhitelisted(malformed) {
+		t.Error("Malformed whitelists should be whitelisted")
+	}
+
+	fil := New()
+	fil.AddVolumeRule(IsUnattached())
+	filtered := Volumes([]cloud.Volume{active, expired, malformed}, fil)
+	if len(filtered) != 1 || filtered[0] != expired {
+		t.Error("Only the expired whitelist should be included")
+	}
+}
+
+func TestWhitelistReviewRules(t *testing.T) {
+	soon := time.Now().AddDate(0, 0, 5).Format(ExpiryTagValueFormat)
+	late := time.Now().AddDate(1, 0, 0).Format(ExpiryTagValueFormat)
+	lapsing := &testResource{time.Now(), map[string]string{WhitelistTagKey: "until=" + soon + ";reason=demo"}}
+	justified := &testResource{time.Now(), map[string]string{WhitelistTagKey: "until=" + late + ";reason=demo"}}
+	unjustified := &testResource{time.Now(), map[string]string{WhitelistTagKey: ""}}
+	notWhitelisted := &testResource{time.Now(), map[string]string{}}
+
+	if !WhitelistExpiresWithinXDays(14)(lapsing) || WhitelistExpiresWithinXDays(14)(justified) {
+		t.Error("Wrong lapsing whitelists")
+	}
+	if WhitelistExpiresWithinXDays(14)(unjustified) || WhitelistExpiresWithinXDays(14)(notWhitelisted) {
+		t.Error("Permanent or missing whitelists never lapse")
+	}
+	if !WhitelistUnjustified()(unjustified) || WhitelistUnjustified()(justified) || WhitelistUnjustified()(notWhitelisted) {
+		t.Error("Wrong unjustified whitelists")
+	}
+}
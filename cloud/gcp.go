@@ -11,9 +11,17 @@ import (
 	"time"
 
 	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
 	storage "google.golang.org/api/storage/v1"
 )
 
+const (
+	gcpImageActive     = "ACTIVE"
+	gcpImageDeprecated = "DEPRECATED"
+	gcpImageObsolete   = "OBSOLETE"
+	gcpImageDeleted    = "DELETED"
+)
+
 // Google Cloud API error codes can be found here:
 // https://github.com/googleapis/googleapis/blob/master/google/rpc/code.proto
 
@@ -24,6 +32,10 @@ var (
 
 // gcpResourceManager uses the Go API client for Google Cloud
 // https://github.com/google/google-api-go-client
+//
+// All data in GCP is encrypted at rest by Google. A GCP resource is
+// only considered encrypted if it uses a customer managed or customer
+// supplied encryption key.
 type gcpResourceManager struct {
 	projects []string
 	compute  *compute.Service
@@ -40,9 +52,13 @@ func (m *gcpResourceManager) InstancesPerAccount() map[string][]Instance {
 	var resultMutex sync.Mutex // Projects are processed in parallel
 	m.forEachProject(func(project string) {
 		instList := []Instance{}
+		firewalls, err := m.getOpenFirewalls(project)
+		if err != nil {
+			log.Printf("Could not list firewalls in %s: %s", project, err)
+		}
 		var listMutex sync.Mutex // Zones are proccessed in parallel
 		m.forEachZone(project, func(zone string) {
-			inst, err := m.getInstances(project, zone)
+			inst, err := m.getInstances(project, zone, firewalls)
 			if err != nil {
 				log.Printf("Could not list instances in (%s, %s): %s", project, zone, err)
 				if err == ErrPermissionDenied {
@@ -88,33 +104,45 @@ func (m *gcpResourceManager) ImagesPerAccount() map[string][]Image {
 }
 
 func (m *gcpResourceManager) VolumesPerAccount() map[string][]Volume {
+	volumes, _ := m.volumesPerAccount()
+	return volumes
+}
+
+// volumesPerAccount lists the zonal and regional disks in all projects.
+// The projects where some zones or regions could not be listed are also
+// returned, since disks missing from them may still exist.
+func (m *gcpResourceManager) volumesPerAccount() (map[string][]Volume, map[string]bool) {
 	log.Println("Getting volumes in all projects")
 	result := make(map[string][]Volume)
+	incomplete := make(map[string]bool)
 	var resultMutex sync.Mutex // Projects are processed in parallel
 	m.forEachProject(func(project string) {
 		diskList := []Volume{}
-		var listMutex sync.Mutex // Zones are proccessed in parallel
-		m.forEachZone(project, func(zone string) {
-			volumes, err := m.getVolumes(project, zone)
+		failed := false
+		var listMutex sync.Mutex // Zones and regions are proccessed in parallel
+		list := func(location string, regional bool) {
+			volumes, err := m.getVolumes(project, location, regional)
+			listMutex.Lock()
+			defer listMutex.Unlock()
 			if err != nil {
-				log.Printf("Could not list disks in (%s, %s): %s", project, zone, err)
-				if err == ErrPermissionDenied {
-					log.Println(err)
-				} else {
+				log.Printf("Could not list disks in (%s, %s): %s", project, location, err)
+				if err != ErrPermissionDenied {
 					// If it was an unknown error, abort
 					log.Fatalln(err)
 				}
-			} else if len(volumes) > 0 {
-				listMutex.Lock()
-				diskList = append(diskList, volumes...)
-				listMutex.Unlock()
+				failed = true
+				return
 			}
-		})
+			diskList = append(diskList, volumes...)
+		}
+		zonesErr := m.forEachZone(project, func(zone string) { list(zone, false) })
+		regionsErr := m.forEachRegion(project, func(region string) { list(region, true) })
 		resultMutex.Lock()
 		result[project] = diskList
+		incomplete[project] = failed || zonesErr != nil || regionsErr != nil
 		resultMutex.Unlock()
 	})
-	return result
+	return result, incomplete
 }
 
 func (m *gcpResourceManager) SnapshotsPerAccount() map[string][]Snapshot {
@@ -171,6 +199,7 @@ func (m *gcpResourceManager) AllResourcesPerAccount() map[string]*ResourceCollec
 	var instanceMap map[string][]Instance
 	var imageMap map[string][]Image
 	var volumeMap map[string][]Volume
+	var volumesIncomplete map[string]bool
 	var snapMap map[string][]Snapshot
 	wg.Add(4)
 	go func() {
@@ -182,7 +211,7 @@ func (m *gcpResourceManager) AllResourcesPerAccount() map[string]*ResourceCollec
 		wg.Done()
 	}()
 	go func() {
-		volumeMap = m.VolumesPerAccount()
+		volumeMap, volumesIncomplete = m.volumesPerAccount()
 		wg.Done()
 	}()
 	go func() {
@@ -197,6 +226,8 @@ func (m *gcpResourceManager) AllResourcesPerAccount() map[string]*ResourceCollec
 			Images:    imageMap[project],
 			Volumes:   volumeMap[project],
 			Snapshots: snapMap[project],
+
+			VolumesIncomplete: volumesIncomplete[project],
 		}
 		resultMutex.Lock()
 		result[project] = collection
@@ -238,24 +269,51 @@ func (m *gcpResourceManager) forEachProject(f func(project string)) {
 	wg.Wait()
 }
 
-func (m *gcpResourceManager) forEachZone(project string, f func(zone string)) {
+func (m *gcpResourceManager) forEachZone(project string, f func(zone string)) error {
 	zones, err := m.compute.Zones.List(project).Do()
 	if err != nil {
 		log.Printf("Could not list zones in %s. Err: %v", project, err)
-		return
+		return err
 	}
-	var wg sync.WaitGroup
+	names := []string{}
 	for _, z := range zones.Items {
+		names = append(names, z.Name)
+	}
+	forEachGCPLocation(names, f)
+	return nil
+}
+
+func (m *gcpResourceManager) forEachRegion(project string, f func(region string)) error {
+	regions, err := m.compute.Regions.List(project).Do()
+	if err != nil {
+		log.Printf("Could not list regions in %s. Err: %v", project, err)
+		return err
+	}
+	names := []string{}
+	for _, r := range regions.Items {
+		names = append(names, r.Name)
+	}
+	forEachGCPLocation(names, f)
+	return nil
+}
+
+func forEachGCPLocation(locations []string, f func(location string)) {
+	var wg sync.WaitGroup
+	for _, l := range locations {
 		wg.Add(1)
-		go func(z string) {
-			f(z)
+		go func(l string) {
+			f(l)
 			wg.Done()
-		}(z.Name)
+		}(l)
 	}
 	wg.Wait()
 }
 
-func (m *gcpResourceManager) getInstances(project, zone string) ([]Instance, error) {
+// getInstances will list all instances in a zone. An instance is considered
+// public if it has an external IP and any of the specified open firewalls
+// apply to it. If the firewalls are nil, then every instance with an
+// external IP is considered public.
+func (m *gcpResourceManager) getInstances(project, zone string, openFirewalls []*gcpFirewall) ([]Instance, error) {
 	instances, err := m.compute.Instances.List(project, zone).Do()
 	if err != nil {
 		if instances != nil && isGCPAccessDeniedError(instances.HTTPStatusCode) {
@@ -263,6 +321,15 @@ func (m *gcpResourceManager) getInstances(project, zone string) ([]Instance, err
 		}
 		return nil, err
 	}
+	disks := make(map[string]*compute.Disk)
+	diskList, err := m.listDisks(project, zone, false)
+	if err != nil {
+		log.Printf("Could not list disks in (%s, %s): %s", project, zone, err)
+	} else {
+		for _, disk := range diskList {
+			disks[disk.SelfLink] = disk
+		}
+	}
 	res := []Instance{}
 	for _, i := range instances.Items {
 		creationTime, err := time.Parse(time.RFC3339, i.CreationTimestamp)
@@ -271,9 +338,13 @@ func (m *gcpResourceManager) getInstances(project, zone string) ([]Instance, err
 			// Set to Now so it doesn't incorrecntly get tagged for deletion
 			creationTime = time.Now()
 		}
-		labels := i.Labels
-		if labels == nil {
-			labels = make(map[string]string)
+		labels := decodeGCPLabels(i.Labels)
+		public := hasGCPExternalIP(i) && (openFirewalls == nil || hasOpenGCPFirewall(i, openFirewalls))
+		attachedVolumes := []Volume{}
+		for _, attached := range i.Disks {
+			if disk, ok := disks[attached.Source]; ok {
+				attachedVolumes = append(attachedVolumes, m.newGCPVolume(project, zone, disk))
+			}
 		}
 		res = append(res, &gcpInstance{baseInstance{
 			baseResource: baseResource{
@@ -281,11 +352,14 @@ func (m *gcpResourceManager) getInstances(project, zone string) ([]Instance, err
 				owner:        project,
 				id:           i.Name,
 				location:     zone,
-				public:       true,
-				tags:         i.Labels,
+				public:       public,
+				tags:         labels,
 				creationTime: creationTime,
 			},
-			instanceType: parseGCPResourceURL(i.MachineType),
+			instanceType:        parseGCPResourceURL(i.MachineType),
+			state:               convertGCPInstanceStatus(i.Status),
+			stateTransitionTime: gcpStateTransitionTime(i, creationTime),
+			attachedVolumes:     attachedVolumes,
 		},
 			m.compute,
 		})
@@ -309,9 +383,13 @@ func (m *gcpResourceManager) getImages(project string) ([]Image, error) {
 			// Set to Now so it doesn't incorrecntly get tagged for deletion
 			creationTime = time.Now()
 		}
-		labels := img.Labels
-		if labels == nil {
-			labels = make(map[string]string)
+		labels := decodeGCPLabels(img.Labels)
+		public := false
+		policy, err := m.compute.Images.GetIamPolicy(project, img.Name).Do()
+		if err != nil {
+			log.Printf("Could not get IAM policy of %s (in %s): %s", img.Name, project, err)
+		} else {
+			public = isGCPPolicyPublic(policy)
 		}
 		imgList = append(imgList, &gcpImage{
 			baseImage: baseImage{
@@ -322,10 +400,13 @@ func (m *gcpResourceManager) getImages(project string) ([]Image, error) {
 					location:     "",
 					creationTime: creationTime,
 					tags:         labels,
-					public:       true,
+					public:       public,
 				},
-				name:   img.Name,
-				sizeGB: img.DiskSizeGb,
+				name:             img.Name,
+				sizeGB:           img.DiskSizeGb,
+				encrypted:        img.ImageEncryptionKey != nil,
+				encryptable:      true,
+				deprecationState: gcpDeprecationState(img.Deprecated),
 			},
 			compute: m.compute,
 		})
@@ -333,46 +414,100 @@ func (m *gcpResourceManager) getImages(project string) ([]Image, error) {
 	return imgList, nil
 }
 
-func (m *gcpResourceManager) getVolumes(project, zone string) ([]Volume, error) {
-	volumes, err := m.compute.Disks.List(project, zone).Do()
+// gcpDeprecationState converts the deprecation status of a GCP image. GCP
+// images in the DELETED state can no longer be used, just like obsolete
+// images.
+func gcpDeprecationState(status *compute.DeprecationStatus) string {
+	if status == nil {
+		return ImageStateActive
+	}
+	switch status.State {
+	case gcpImageDeprecated:
+		return ImageStateDeprecated
+	case gcpImageObsolete, gcpImageDeleted:
+		return ImageStateObsolete
+	default:
+		return ImageStateActive
+	}
+}
+
+// gcpDeprecationStateName returns the GCP name of a deprecation state
+func gcpDeprecationStateName(state string) string {
+	switch state {
+	case ImageStateDeprecated:
+		return gcpImageDeprecated
+	case ImageStateObsolete:
+		return gcpImageObsolete
+	default:
+		return gcpImageActive
+	}
+}
+
+// getVolumes lists the disks in a zone, or the regional disks in a region
+func (m *gcpResourceManager) getVolumes(project, location string, regional bool) ([]Volume, error) {
+	disks, err := m.listDisks(project, location, regional)
 	if err != nil {
-		if volumes != nil && isGCPAccessDeniedError(volumes.HTTPStatusCode) {
-			return nil, ErrPermissionDenied
-		}
 		return nil, err
 	}
 	diskList := []Volume{}
-	for _, disk := range volumes.Items {
-		creationTime, err := time.Parse(time.RFC3339, disk.CreationTimestamp)
-		if err != nil {
-			log.Printf("Could not parse timestamp of %s (in %s): %s", disk.Name, project, err)
-			// Set to Now so it doesn't incorrecntly get tagged for deletion
-			creationTime = time.Now()
+	for _, disk := range disks {
+		diskList = append(diskList, m.newGCPVolume(project, location, disk))
+	}
+	return diskList, nil
+}
+
+// listDisks lists all pages of the disks in a zone, or of the regional
+// disks in a region
+func (m *gcpResourceManager) listDisks(project, location string, regional bool) ([]*compute.Disk, error) {
+	disks := []*compute.Disk{}
+	var nextPageToken string
+	for ok := true; ok; ok = nextPageToken != "" {
+		var page *compute.DiskList
+		var err error
+		if regional {
+			page, err = m.compute.RegionDisks.List(project, location).PageToken(nextPageToken).Do()
+		} else {
+			page, err = m.compute.Disks.List(project, location).PageToken(nextPageToken).Do()
 		}
-		labels := disk.Labels
-		if labels == nil {
-			labels = make(map[string]string)
+		if err != nil {
+			if page != nil && isGCPAccessDeniedError(page.HTTPStatusCode) {
+				return nil, ErrPermissionDenied
+			}
+			return nil, err
 		}
-		diskList = append(diskList, &gcpVolume{
-			baseVolume: baseVolume{
-				baseResource: baseResource{
-					csp:          GCP,
-					owner:        project,
-					id:           disk.Name,
-					location:     zone,
-					creationTime: creationTime,
-					public:       true,
-					tags:         labels,
-				},
-				sizeGB:     disk.SizeGb,
-				encrypted:  false,
-				attached:   disk.Users != nil && len(disk.Users) > 0,
-				volumeType: parseGCPResourceURL(disk.Type),
+		disks = append(disks, page.Items...)
+		nextPageToken = page.NextPageToken
+	}
+	return disks, nil
+}
+
+func (m *gcpResourceManager) newGCPVolume(project, location string, disk *compute.Disk) *gcpVolume {
+	creationTime, err := time.Parse(time.RFC3339, disk.CreationTimestamp)
+	if err != nil {
+		log.Printf("Could not parse timestamp of %s (in %s): %s", disk.Name, project, err)
+		// Set to Now so it doesn't incorrecntly get tagged for deletion
+		creationTime = time.Now()
+	}
+	labels := decodeGCPLabels(disk.Labels)
+	return &gcpVolume{
+		baseVolume: baseVolume{
+			baseResource: baseResource{
+				csp:          GCP,
+				owner:        project,
+				id:           disk.Name,
+				location:     location,
+				creationTime: creationTime,
+				public:       false,
+				tags:         labels,
 			},
-			compute: m.compute,
-		})
+			sizeGB:     disk.SizeGb,
+			encrypted:  disk.DiskEncryptionKey != nil,
+			attached:   disk.Users != nil && len(disk.Users) > 0,
+			volumeType: parseGCPResourceURL(disk.Type),
+		},
+		compute:  m.compute,
+		regional: disk.Region != "",
 	}
-	return diskList, nil
 }
 
 func (m *gcpResourceManager) getSnapshots(project string) ([]Snapshot, error) {
@@ -384,6 +519,7 @@ func (m *gcpResourceManager) getSnapshots(project string) ([]Snapshot, error) {
 		return nil, err
 	}
 	snapList := []Snapshot{}
+	snapshotsInUse := m.getSnapshotsInUse(project)
 	for _, snap := range snapshots.Items {
 		creationTime, err := time.Parse(time.RFC3339, snap.CreationTimestamp)
 		if err != nil {
@@ -391,9 +527,17 @@ func (m *gcpResourceManager) getSnapshots(project string) ([]Snapshot, error) {
 			// Set to Now so it doesn't incorrecntly get tagged for deletion
 			creationTime = time.Now()
 		}
-		labels := snap.Labels
-		if labels == nil {
-			labels = make(map[string]string)
+		labels := decodeGCPLabels(snap.Labels)
+		// Snapshots created by a snapshot schedule are managed by the
+		// schedule's retention policy, so treat those as in use too
+		_, inUse := snapshotsInUse[snap.Name]
+		inUse = inUse || snap.AutoCreated
+		public := false
+		policy, err := m.compute.Snapshots.GetIamPolicy(project, snap.Name).Do()
+		if err != nil {
+			log.Printf("Could not get IAM policy of %s (in %s): %s", snap.Name, project, err)
+		} else {
+			public = isGCPPolicyPublic(policy)
 		}
 		snapList = append(snapList, &gcpSnapshot{
 			baseSnapshot: baseSnapshot{
@@ -402,13 +546,14 @@ func (m *gcpResourceManager) getSnapshots(project string) ([]Snapshot, error) {
 					id:           snap.Name,
 					owner:        project,
 					location:     "",
-					public:       true,
+					public:       public,
 					creationTime: creationTime,
 					tags:         labels,
 				},
-				encrypted: false,
-				inUse:     false,
-				sizeGB:    snap.DiskSizeGb,
+				encrypted:      snap.SnapshotEncryptionKey != nil,
+				inUse:          inUse,
+				sizeGB:         snap.DiskSizeGb,
+				sourceVolumeID: parseGCPDiskURL(snap.SourceDisk),
 			},
 			compute: m.compute,
 		})
@@ -416,8 +561,38 @@ func (m *gcpResourceManager) getSnapshots(project string) ([]Snapshot, error) {
 	return snapList, nil
 }
 
+// getSnapshotsInUse will find all snapshots in a project which
+// an image or a disk has been created from.
+func (m *gcpResourceManager) getSnapshotsInUse(project string) map[string]struct{} {
+	result := make(map[string]struct{})
+	images, err := m.compute.Images.List(project).Do()
+	if err != nil {
+		log.Printf("Could not determine snapshots in use by images in %s: %s", project, err)
+	} else {
+		for _, img := range images.Items {
+			if img.SourceSnapshot != "" {
+				result[parseGCPResourceURL(img.SourceSnapshot)] = struct{}{}
+			}
+		}
+	}
+	disks, err := m.compute.Disks.AggregatedList(project).Do()
+	if err != nil {
+		log.Printf("Could not determine snapshots in use by disks in %s: %s", project, err)
+	} else {
+		for _, scopedList := range disks.Items {
+			for _, disk := range scopedList.Disks {
+				if disk.SourceSnapshot != "" {
+					result[parseGCPResourceURL(disk.SourceSnapshot)] = struct{}{}
+				}
+			}
+		}
+	}
+	return result
+}
+
 func (m *gcpResourceManager) getBuckets(project string) ([]Bucket, error) {
-	buckets, err := m.storage.Buckets.List(project).Do()
+	// The full projection is needed to include the bucket ACLs
+	buckets, err := m.storage.Buckets.List(project).Projection("full").Do()
 	if err != nil {
 		if buckets != nil && isGCPAccessDeniedError(buckets.HTTPStatusCode) {
 			return nil, ErrPermissionDenied
@@ -435,14 +610,15 @@ func (m *gcpResourceManager) getBuckets(project string) ([]Bucket, error) {
 		if err != nil {
 			lastModified = time.Time{}
 		}
-		labels := buck.Labels
-		if labels == nil {
-			labels = make(map[string]string)
-		}
+		labels := decodeGCPLabels(buck.Labels)
 		count, size, err := m.bucketDetails(buck.Name)
 		if err != nil {
 			log.Printf("Could not get object details for %s: %s", buck.Name, err)
 		}
+		public, err := m.isBucketPublic(buck)
+		if err != nil {
+			log.Printf("Could not determine if %s is public: %s", buck.Name, err)
+		}
 		buckList = append(buckList, &gcpBucket{
 			baseBucket: baseBucket{
 				baseResource: baseResource{
@@ -451,12 +627,13 @@ func (m *gcpResourceManager) getBuckets(project string) ([]Bucket, error) {
 					id:           buck.Name,
 					tags:         labels,
 					creationTime: creationTime,
-					public:       false,
+					public:       public,
 					location:     buck.Location,
 				},
 				lastModified: lastModified,
 				objectCount:  count,
 				totalSizeGB:  size,
+				encrypted:    buck.Encryption != nil && buck.Encryption.DefaultKmsKeyName != "",
 			},
 			storage: m.storage,
 		})
@@ -487,6 +664,152 @@ func (m *gcpResourceManager) bucketDetails(bucketID string) (int64, float64, err
 	return count, sizeGB, nil
 }
 
+// isBucketPublic checks if either the IAM policy or the ACL of a
+// bucket grants access to everyone
+func (m *gcpResourceManager) isBucketPublic(bucket *storage.Bucket) (bool, error) {
+	for _, acl := range bucket.Acl {
+		if isGCPPublicMember(acl.Entity) {
+			return true, nil
+		}
+	}
+	policy, err := m.storage.Buckets.GetIamPolicy(bucket.Name).Do()
+	if err != nil {
+		return false, err
+	}
+	for _, binding := range policy.Bindings {
+		if anyGCPPublicMember(binding.Members) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getOpenFirewalls will list all enabled firewall rules in a project
+// which allow inbound traffic from any address
+func (m *gcpResourceManager) getOpenFirewalls(project string) ([]*gcpFirewall, error) {
+	firewalls, err := m.compute.Firewalls.List(project).Do()
+	if err != nil {
+		if firewalls != nil && isGCPAccessDeniedError(firewalls.HTTPStatusCode) {
+			return nil, ErrPermissionDenied
+		}
+		return nil, err
+	}
+	result := []*gcpFirewall{}
+	for _, fw := range firewalls.Items {
+		firewall := &gcpFirewall{
+			disabled:              fw.Disabled,
+			allowsTraffic:         len(fw.Allowed) > 0,
+			direction:             fw.Direction,
+			sourceRanges:          fw.SourceRanges,
+			network:               parseGCPResourceURL(fw.Network),
+			targetTags:            fw.TargetTags,
+			targetServiceAccounts: fw.TargetServiceAccounts,
+		}
+		if firewall.isOpen() {
+			result = append(result, firewall)
+		}
+	}
+	return result, nil
+}
+
+// hasOpenGCPFirewall checks if any of the specified firewalls apply
+// to the instance, based on its networks, network tags and service accounts
+func hasOpenGCPFirewall(inst *compute.Instance, firewalls []*gcpFirewall) bool {
+	networks := []string{}
+	for _, iface := range inst.NetworkInterfaces {
+		networks = append(networks, parseGCPResourceURL(iface.Network))
+	}
+	instanceTags := []string{}
+	if inst.Tags != nil {
+		instanceTags = inst.Tags.Items
+	}
+	serviceAccounts := []string{}
+	for _, sa := range inst.ServiceAccounts {
+		serviceAccounts = append(serviceAccounts, sa.Email)
+	}
+	for _, fw := range firewalls {
+		if fw.appliesTo(networks, instanceTags, serviceAccounts) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasGCPExternalIP(inst *compute.Instance) bool {
+	for _, iface := range inst.NetworkInterfaces {
+		for _, config := range iface.AccessConfigs {
+			if config.NatIP != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func convertGCPInstanceStatus(status string) string {
+	switch status {
+	case "PROVISIONING", "STAGING":
+		return InstanceStatePending
+	case "RUNNING":
+		return InstanceStateRunning
+	case "STOPPING", "SUSPENDING":
+		return InstanceStateStopping
+	case "TERMINATED", "SUSPENDED":
+		// A terminated instance in GCP is stopped, not deleted
+		return InstanceStateStopped
+	default:
+		return strings.ToLower(status)
+	}
+}
+
+// gcpStateTransitionTime will determine when an instance entered its
+// current state, falling back to the creation time if unknown
+func gcpStateTransitionTime(inst *compute.Instance, creationTime time.Time) time.Time {
+	timestamp := inst.LastStartTimestamp
+	if convertGCPInstanceStatus(inst.Status) == InstanceStateStopped {
+		timestamp = inst.LastStopTimestamp
+	}
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return creationTime
+	}
+	return t
+}
+
+func isGCPPolicyPublic(policy *compute.Policy) bool {
+	for _, binding := range policy.Bindings {
+		if anyGCPPublicMember(binding.Members) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeGCPPublicMembers removes everyone with public access from the
+// bindings of a policy. Bindings left without members are dropped.
+func removeGCPPublicMembers(policy *compute.Policy) *compute.Policy {
+	bindings := []*compute.Binding{}
+	for _, binding := range policy.Bindings {
+		members := []string{}
+		for _, member := range binding.Members {
+			if !isGCPPublicMember(member) {
+				members = append(members, member)
+			}
+		}
+		if len(members) > 0 {
+			binding.Members = members
+			bindings = append(bindings, binding)
+		}
+	}
+	policy.Bindings = bindings
+	return policy
+}
+
+func isGCPNotFoundError(err error) bool {
+	gerr, ok := err.(*googleapi.Error)
+	return ok && gerr.Code == 404
+}
+
 // Figure out if http response code is permission denied
 func isGCPAccessDeniedError(code int) bool {
 	switch code {
@@ -499,6 +822,18 @@ func isGCPAccessDeniedError(code int) bool {
 	}
 }
 
+// parseGCPDiskURL returns the zone and name of a disk from its URL, e.g.
+// "us-central1-a/disk-1" from ".../zones/us-central1-a/disks/disk-1". The
+// region is returned instead for regional disks.
+func parseGCPDiskURL(in string) string {
+	parts := strings.Split(in, "/")
+	n := len(parts)
+	if n >= 4 && (parts[n-4] == "zones" || parts[n-4] == "regions") && parts[n-2] == "disks" {
+		return parts[n-3] + "/" + parts[n-1]
+	}
+	return parseGCPResourceURL(in)
+}
+
 func parseGCPResourceURL(in string) string {
 	parts := strings.Split(in, "/")
 	n := len(parts)
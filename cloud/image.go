@@ -5,19 +5,22 @@ package cloud
 
 import (
 	"errors"
-	"fmt"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	compute "google.golang.org/api/compute/v1"
 )
 
 type baseImage struct {
 	baseResource
-	name   string
-	sizeGB int64
+	name               string
+	sizeGB             int64
+	encrypted          bool
+	encryptable        bool
+	backingSnapshotIDs []string
+	deprecationState   string
 }
 
 func (i *baseImage) Name() string {
@@ -28,6 +31,22 @@ func (i *baseImage) SizeGB() int64 {
 	return i.sizeGB
 }
 
+func (i *baseImage) Encrypted() bool {
+	return i.encrypted
+}
+
+func (i *baseImage) Encryptable() bool {
+	return i.encryptable
+}
+
+func (i *baseImage) BackingSnapshotIDs() []string {
+	return i.backingSnapshotIDs
+}
+
+func (i *baseImage) DeprecationState() string {
+	return i.deprecationState
+}
+
 func cleanupImages(images []Image) error {
 	resList := []Resource{}
 	for i := range images {
@@ -48,21 +67,11 @@ type awsImage struct {
 
 func (i *awsImage) Cleanup() error {
 	log.Printf("Cleaning up image %s in %s", i.ID(), i.Owner())
-	return awsTryWithBackoff(i.cleanup)
-}
-
-func (i *awsImage) cleanup() error {
 	client := clientForAWSResource(i)
 	input := &ec2.DeregisterImageInput{
 		ImageId: aws.String(i.ID()),
 	}
 	_, err := client.DeregisterImage(input)
-	if err != nil {
-		aerr, ok := err.(awserr.Error)
-		if ok && aerr.Code() == requestLimitErrorCode {
-			return errAWSRequestLimit
-		}
-	}
 	return err
 }
 
@@ -85,7 +94,7 @@ func (i *awsImage) MakePrivate() error {
 		ImageId: aws.String(i.ID()),
 		LaunchPermission: &ec2.LaunchPermissionModifications{
 			Remove: []*ec2.LaunchPermission{&ec2.LaunchPermission{
-				Group: aws.String("all"),
+				Group: aws.String(awsPermissionGroupAll),
 			}},
 		},
 	}
@@ -97,6 +106,33 @@ func (i *awsImage) MakePrivate() error {
 	return nil
 }
 
+// Deprecate deprecates the AMI. AWS doesn't accept a deprecation time in
+// the past, so the AMI is deprecated a minute from now.
+func (i *awsImage) Deprecate(state string) error {
+	client := clientForAWSResource(i)
+	if state == ImageStateActive {
+		log.Printf("Cancelling deprecation of image %s in %s", i.ID(), i.Owner())
+		_, err := client.DisableImageDeprecation(&ec2.DisableImageDeprecationInput{
+			ImageId: aws.String(i.ID()),
+		})
+		if err != nil {
+			return err
+		}
+		i.deprecationState = ImageStateActive
+		return nil
+	}
+	log.Printf("Deprecating image %s in %s", i.ID(), i.Owner())
+	_, err := client.EnableImageDeprecation(&ec2.EnableImageDeprecationInput{
+		ImageId:     aws.String(i.ID()),
+		DeprecateAt: aws.Time(time.Now().Add(time.Minute)),
+	})
+	if err != nil {
+		return err
+	}
+	i.deprecationState = ImageStateDeprecated
+	return nil
+}
+
 // GCP
 
 type gcpImage struct {
@@ -115,14 +151,10 @@ func (i *gcpImage) SetTag(key, value string, overwrite bool) error {
 	if err != nil {
 		return nil
 	}
-	newLabels := img.Labels
-	if newLabels == nil {
-		newLabels = make(map[string]string)
-	}
-	if _, exist := newLabels[key]; exist && !overwrite {
-		return fmt.Errorf("Key %s already exist on %s", key, i.ID())
+	newLabels, err := setGCPLabel(img.Labels, i.ID(), key, value, overwrite)
+	if err != nil {
+		return err
 	}
-	newLabels[key] = value
 	req := &compute.GlobalSetLabelsRequest{
 		Labels:           newLabels,
 		LabelFingerprint: img.LabelFingerprint,
@@ -131,21 +163,16 @@ func (i *gcpImage) SetTag(key, value string, overwrite bool) error {
 	if err != nil {
 		return err
 	}
-	i.tags = newLabels
+	i.tags = decodeGCPLabels(newLabels)
 	return nil
 }
 
 func (i *gcpImage) RemoveTag(key string) error {
-	newLabels := make(map[string]string)
-	for k, val := range i.tags {
-		if k != key {
-			newLabels[k] = val
-		}
-	}
 	img, err := i.compute.Images.Get(i.Owner(), i.ID()).Do()
 	if err != nil {
 		return err
 	}
+	newLabels := removeGCPLabel(img.Labels, key)
 	req := &compute.GlobalSetLabelsRequest{
 		Labels:           newLabels,
 		LabelFingerprint: img.LabelFingerprint,
@@ -154,11 +181,45 @@ func (i *gcpImage) RemoveTag(key string) error {
 	if err != nil {
 		return err
 	}
-	i.tags = newLabels
+	i.tags = decodeGCPLabels(newLabels)
 	return nil
 }
 
 func (i *gcpImage) MakePrivate() error {
-	log.Println("Attempted to make GCP image private, NO-OP")
+	log.Printf("Making image %s private in %s", i.ID(), i.Owner())
+	if !i.Public() {
+		// Image is already private
+		return nil
+	}
+	policy, err := i.compute.Images.GetIamPolicy(i.Owner(), i.ID()).Do()
+	if err != nil {
+		return err
+	}
+	req := &compute.GlobalSetPolicyRequest{
+		Policy: removeGCPPublicMembers(policy),
+	}
+	_, err = i.compute.Images.SetIamPolicy(i.Owner(), i.ID(), req).Do()
+	if err != nil {
+		return err
+	}
+	i.public = false
+	return nil
+}
+
+func (i *gcpImage) Deprecate(state string) error {
+	log.Printf("Setting deprecation state of image %s in %s to %s", i.ID(), i.Owner(), gcpDeprecationStateName(state))
+	status := &compute.DeprecationStatus{State: gcpDeprecationStateName(state)}
+	now := time.Now().Format(time.RFC3339)
+	switch state {
+	case ImageStateDeprecated:
+		status.Deprecated = now
+	case ImageStateObsolete:
+		status.Obsolete = now
+	}
+	_, err := i.compute.Images.Deprecate(i.Owner(), i.ID(), status).Do()
+	if err != nil {
+		return err
+	}
+	i.deprecationState = state
 	return nil
 }
@@ -5,10 +5,8 @@ package cloud
 
 import (
 	"errors"
-	"fmt"
 	"log"
-
-	"github.com/aws/aws-sdk-go/aws/awserr"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
@@ -17,13 +15,28 @@ import (
 
 type baseInstance struct {
 	baseResource
-	instanceType string
+	instanceType        string
+	state               string
+	stateTransitionTime time.Time
+	attachedVolumes     []Volume
 }
 
 func (i *baseInstance) InstanceType() string {
 	return i.instanceType
 }
 
+func (i *baseInstance) State() string {
+	return i.state
+}
+
+func (i *baseInstance) StateTransitionTime() time.Time {
+	return i.stateTransitionTime
+}
+
+func (i *baseInstance) AttachedVolumes() []Volume {
+	return i.attachedVolumes
+}
+
 func cleanupInstances(instances []Instance) error {
 	resList := []Resource{}
 	for i := range instances {
@@ -45,21 +58,31 @@ type awsInstance struct {
 // Cleanup will termiante this instance
 func (i *awsInstance) Cleanup() error {
 	log.Printf("Cleaning up instance %s in %s", i.ID(), i.Owner())
-	return awsTryWithBackoff(i.cleanup)
-}
-
-func (i *awsInstance) cleanup() error {
 	client := clientForAWSResource(i)
 	input := &ec2.TerminateInstancesInput{
 		InstanceIds: aws.StringSlice([]string{i.id}),
 	}
 	_, err := client.TerminateInstances(input)
-	if err != nil {
-		aerr, ok := err.(awserr.Error)
-		if ok && aerr.Code() == requestLimitErrorCode {
-			return errAWSRequestLimit
-		}
+	return err
+}
+
+// Stop will stop this instance
+func (i *awsInstance) Stop() error {
+	log.Printf("Stopping instance %s in %s", i.ID(), i.Owner())
+	input := &ec2.StopInstancesInput{
+		InstanceIds: aws.StringSlice([]string{i.id}),
 	}
+	_, err := clientForAWSResource(i).StopInstances(input)
+	return err
+}
+
+// Start will start this instance
+func (i *awsInstance) Start() error {
+	log.Printf("Starting instance %s in %s", i.ID(), i.Owner())
+	input := &ec2.StartInstancesInput{
+		InstanceIds: aws.StringSlice([]string{i.id}),
+	}
+	_, err := clientForAWSResource(i).StartInstances(input)
 	return err
 }
 
@@ -84,19 +107,29 @@ func (i *gcpInstance) Cleanup() error {
 	return err
 }
 
+// Stop will stop this instance
+func (i *gcpInstance) Stop() error {
+	log.Printf("Stopping instance %s in %s", i.ID(), i.Owner())
+	_, err := i.compute.Instances.Stop(i.Owner(), i.Location(), i.ID()).Do()
+	return err
+}
+
+// Start will start this instance
+func (i *gcpInstance) Start() error {
+	log.Printf("Starting instance %s in %s", i.ID(), i.Owner())
+	_, err := i.compute.Instances.Start(i.Owner(), i.Location(), i.ID()).Do()
+	return err
+}
+
 func (i *gcpInstance) SetTag(key, value string, overwrite bool) error {
 	inst, err := i.compute.Instances.Get(i.Owner(), i.Location(), i.ID()).Do()
 	if err != nil {
 		return err
 	}
-	newLabels := inst.Labels
-	if newLabels == nil {
-		newLabels = make(map[string]string)
-	}
-	if _, exist := newLabels[key]; exist && !overwrite {
-		return fmt.Errorf("Key %s already exist on %s", key, i.ID())
+	newLabels, err := setGCPLabel(inst.Labels, i.ID(), key, value, overwrite)
+	if err != nil {
+		return err
 	}
-	newLabels[key] = value
 	req := &compute.InstancesSetLabelsRequest{
 		Labels:           newLabels,
 		LabelFingerprint: inst.LabelFingerprint,
@@ -105,21 +138,16 @@ func (i *gcpInstance) SetTag(key, value string, overwrite bool) error {
 	if err != nil {
 		return err
 	}
-	i.tags = newLabels
+	i.tags = decodeGCPLabels(newLabels)
 	return nil
 }
 
 func (i *gcpInstance) RemoveTag(key string) error {
-	newLabels := make(map[string]string)
-	for k, val := range i.tags {
-		if k != key {
-			newLabels[k] = val
-		}
-	}
 	inst, err := i.compute.Instances.Get(i.Owner(), i.Location(), i.ID()).Do()
 	if err != nil {
 		return err
 	}
+	newLabels := removeGCPLabel(inst.Labels, key)
 	req := &compute.InstancesSetLabelsRequest{
 		Labels:           newLabels,
 		LabelFingerprint: inst.LabelFingerprint,
@@ -128,6 +156,6 @@ func (i *gcpInstance) RemoveTag(key string) error {
 	if err != nil {
 		return err
 	}
-	i.tags = newLabels
+	i.tags = decodeGCPLabels(newLabels)
 	return nil
 }
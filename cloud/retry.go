@@ -0,0 +1,218 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// All AWS and GCP calls are retried when they're throttled or fail with a
+// transient error. AWS clients get this through NewAWSSession, and GCP
+// clients through the transport of NewGCPHttpClient. Every retry uses
+// jittered exponential backoff, and takes from a retry budget shared by
+// the whole run, so housekeeper fails rather than retrying forever when a
+// CSP is having problems.
+const (
+	// DefaultRetryBudget is the number of retries allowed per run
+	DefaultRetryBudget = 500
+
+	maxRetries      = 6
+	retryBaseDelay  = time.Second
+	retryMaxDelay   = 60 * time.Second
+	gcpRateLimitTag = "rateLimitExceeded"
+)
+
+var (
+	// Error codes AWS uses for throttling and transient errors
+	retryableAWSCodes = map[string]bool{
+		"Throttling":                             true,
+		"ThrottlingException":                    true,
+		"ThrottledException":                     true,
+		"RequestThrottled":                       true,
+		"RequestThrottledException":              true,
+		"RequestLimitExceeded":                   true,
+		"TooManyRequestsException":               true,
+		"ProvisionedThroughputExceededException": true,
+		"TransactionInProgressException":         true,
+		"SlowDown":                               true,
+		"BandwidthLimitExceeded":                 true,
+		"EC2ThrottledException":                  true,
+		"PriorRequestNotComplete":                true,
+		"RequestTimeout":                         true,
+		"RequestTimeoutException":                true,
+		"InternalError":                          true,
+		"InternalFailure":                        true,
+		"ServiceUnavailable":                     true,
+		"Unavailable":                            true,
+	}
+
+	retries = newRetryBudget(DefaultRetryBudget)
+)
+
+// SetRetryBudget sets the number of retries allowed for the rest of the run
+func SetRetryBudget(n int) {
+	retries = newRetryBudget(n)
+}
+
+type retryBudget struct {
+	mu        sync.Mutex
+	remaining int
+	exhausted bool
+}
+
+func newRetryBudget(n int) *retryBudget {
+	return &retryBudget{remaining: n}
+}
+
+// take uses one retry from the budget, if there are any left
+func (b *retryBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.remaining <= 0 {
+		if !b.exhausted {
+			log.Println("The retry budget is used up, throttled and failed calls will no longer be retried")
+			b.exhausted = true
+		}
+		return false
+	}
+	b.remaining--
+	return true
+}
+
+// backoffDelay returns how long to wait before a retry. The first retry
+// has attempt 0. The delay doubles with every attempt, and half of it is
+// random so that concurrent calls don't retry at the same time.
+func backoffDelay(attempt int) time.Duration {
+	delay := retryMaxDelay
+	if attempt < 16 {
+		delay = retryBaseDelay << uint(attempt)
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryableStatus checks if an HTTP status means the call was throttled
+// or failed because of a transient problem in the CSP
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// isTransientError checks if an error is a network error that is likely
+// to go away when the call is retried
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if nerr, ok := err.(net.Error); ok && (nerr.Timeout() || nerr.Temporary()) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset by peer") || strings.Contains(msg, "broken pipe")
+}
+
+// retryTransport retries GCP API calls. Requests with a body are only
+// retried if the body can be read again.
+type retryTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	replayable := req.Body == nil || req.GetBody != nil
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.WithContext(req.Context())
+			r.Body = body
+		}
+		resp, err := t.base.RoundTrip(r)
+		if !replayable || attempt >= maxRetries || !shouldRetryHTTP(resp, err) || !retries.take() {
+			return resp, err
+		}
+		delay := backoffDelay(attempt)
+		if resp != nil {
+			if after := retryAfter(resp); after > delay {
+				delay = after
+			}
+			log.Printf("Retrying %s %s (attempt %d): %s\n", req.Method, req.URL.Path, attempt+1, resp.Status)
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			log.Printf("Retrying %s %s (attempt %d): %s\n", req.Method, req.URL.Path, attempt+1, err)
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// shouldRetryHTTP checks the result of a GCP call. GCP returns 403 rather
+// than 429 when some rate limits are exceeded, so the reason in the body
+// of a 403 is checked too.
+func shouldRetryHTTP(resp *http.Response, err error) bool {
+	if err != nil {
+		return isTransientError(err)
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		return rateLimited(resp)
+	}
+	return retryableStatus(resp.StatusCode)
+}
+
+// rateLimited checks if the body of a response has a rate limit reason.
+// The body is replaced so it can still be read by the caller.
+func rateLimited(resp *http.Response) bool {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	// Matches both rateLimitExceeded and userRateLimitExceeded
+	return bytes.Contains(bytes.ToLower(body), []byte(strings.ToLower(gcpRateLimitTag)))
+}
+
+// retryAfter returns how long the Retry-After header of a response asks
+// to wait, up to the maximum backoff delay
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	after := time.Duration(seconds) * time.Second
+	if after > retryMaxDelay {
+		return retryMaxDelay
+	}
+	return after
+}
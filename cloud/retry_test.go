@@ -0,0 +1,139 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt := 0; attempt < 20; attempt++ {
+		max := retryMaxDelay
+		if attempt < 6 {
+			max = retryBaseDelay << uint(attempt)
+		}
+		for i := 0; i < 10; i++ {
+			delay := backoffDelay(attempt)
+			if delay < max/2 || delay > max {
+				t.Errorf("Delay %s of attempt %d is not between %s and %s", delay, attempt, max/2, max)
+			}
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := newRetryBudget(2)
+	if !b.take() || !b.take() {
+		t.Fatal("Retries within the budget should be allowed")
+	}
+	if b.take() {
+		t.Error("Retries should not be allowed when the budget is used up")
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	transient := []error{
+		timeoutError{},
+		io.ErrUnexpectedEOF,
+		errors.New("read tcp 10.0.0.1:443: read: connection reset by peer"),
+	}
+	for _, err := range transient {
+		if !isTransientError(err) {
+			t.Errorf("\"%s\" should be transient", err)
+		}
+	}
+	permanent := []error{nil, errors.New("InvalidVolume.NotFound")}
+	for _, err := range permanent {
+		if isTransientError(err) {
+			t.Errorf("\"%v\" should not be transient", err)
+		}
+	}
+}
+
+func TestShouldRetryHTTP(t *testing.T) {
+	response := func(status int, body string) *http.Response {
+		return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader(body))}
+	}
+	testCases := []struct {
+		resp  *http.Response
+		err   error
+		retry bool
+	}{
+		{response(http.StatusTooManyRequests, ""), nil, true},
+		{response(http.StatusServiceUnavailable, ""), nil, true},
+		{response(http.StatusForbidden, `{"error": {"errors": [{"reason": "rateLimitExceeded"}]}}`), nil, true},
+		{response(http.StatusForbidden, `{"error": {"errors": [{"reason": "userRateLimitExceeded"}]}}`), nil, true},
+		{response(http.StatusForbidden, `{"error": {"errors": [{"reason": "forbidden"}]}}`), nil, false},
+		{response(http.StatusNotFound, ""), nil, false},
+		{response(http.StatusOK, ""), nil, false},
+		{nil, timeoutError{}, true},
+	}
+	for i, tc := range testCases {
+		if retry := shouldRetryHTTP(tc.resp, tc.err); retry != tc.retry {
+			t.Errorf("Test case %d: expected retry to be %t", i, tc.retry)
+		}
+	}
+	// The body must still be readable after checking for rate limits
+	resp := response(http.StatusForbidden, "forbidden")
+	shouldRetryHTTP(resp, nil)
+	if body, _ := ioutil.ReadAll(resp.Body); string(body) != "forbidden" {
+		t.Errorf("Expected body to be kept, got \"%s\"", body)
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	defer SetRetryBudget(DefaultRetryBudget)
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "labels" {
+			t.Errorf("Expected the request body on every attempt, got \"%s\"", body)
+		}
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &retryTransport{base: http.DefaultTransport}}
+
+	start := time.Now()
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("labels"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls != 2 {
+		t.Errorf("Expected a successful retry, got status %d after %d calls", resp.StatusCode, calls)
+	}
+	if time.Since(start) < retryBaseDelay/2 {
+		t.Error("The retry should have been delayed")
+	}
+
+	SetRetryBudget(0)
+	calls = 0
+	resp, err = client.Post(server.URL, "text/plain", strings.NewReader("labels"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || calls != 1 {
+		t.Errorf("Nothing should be retried without a budget, got status %d after %d calls", resp.StatusCode, calls)
+	}
+}
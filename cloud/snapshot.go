@@ -5,11 +5,8 @@ package cloud
 
 import (
 	"errors"
-	"fmt"
 	"log"
 
-	"github.com/aws/aws-sdk-go/aws/awserr"
-
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	compute "google.golang.org/api/compute/v1"
@@ -17,9 +14,10 @@ import (
 
 type baseSnapshot struct {
 	baseResource
-	encrypted bool
-	inUse     bool
-	sizeGB    int64
+	encrypted      bool
+	inUse          bool
+	sizeGB         int64
+	sourceVolumeID string
 }
 
 func (s *baseSnapshot) Encrypted() bool {
@@ -34,6 +32,10 @@ func (s *baseSnapshot) SizeGB() int64 {
 	return s.sizeGB
 }
 
+func (s *baseSnapshot) SourceVolumeID() string {
+	return s.sourceVolumeID
+}
+
 func cleanupSnapshots(snapshots []Snapshot) error {
 	resList := []Resource{}
 	for i := range snapshots {
@@ -54,21 +56,11 @@ type awsSnapshot struct {
 
 func (s *awsSnapshot) Cleanup() error {
 	log.Printf("Cleaning up snapshot %s in %s", s.ID(), s.Owner())
-	return awsTryWithBackoff(s.cleanup)
-}
-
-func (s *awsSnapshot) cleanup() error {
 	client := clientForAWSResource(s)
 	input := &ec2.DeleteSnapshotInput{
 		SnapshotId: aws.String(s.ID()),
 	}
 	_, err := client.DeleteSnapshot(input)
-	if err != nil {
-		aerr, ok := err.(awserr.Error)
-		if ok && aerr.Code() == requestLimitErrorCode {
-			return errAWSRequestLimit
-		}
-	}
 	return err
 }
 
@@ -80,6 +72,30 @@ func (s *awsSnapshot) RemoveTag(key string) error {
 	return removeAWSTag(s, key)
 }
 
+func (s *awsSnapshot) MakePrivate() error {
+	log.Printf("Making snapshot %s private in %s", s.ID(), s.Owner())
+	if !s.Public() {
+		// Snapshot is already private
+		return nil
+	}
+	client := clientForAWSResource(s)
+	input := &ec2.ModifySnapshotAttributeInput{
+		SnapshotId: aws.String(s.ID()),
+		Attribute:  aws.String(ec2.SnapshotAttributeNameCreateVolumePermission),
+		CreateVolumePermission: &ec2.CreateVolumePermissionModifications{
+			Remove: []*ec2.CreateVolumePermission{&ec2.CreateVolumePermission{
+				Group: aws.String(awsPermissionGroupAll),
+			}},
+		},
+	}
+	_, err := client.ModifySnapshotAttribute(input)
+	if err != nil {
+		return err
+	}
+	s.public = false
+	return nil
+}
+
 // GCP
 
 type gcpSnapshot struct {
@@ -98,14 +114,10 @@ func (s *gcpSnapshot) SetTag(key, value string, overwrite bool) error {
 	if err != nil {
 		return err
 	}
-	newLabels := snap.Labels
-	if newLabels == nil {
-		newLabels = make(map[string]string)
-	}
-	if _, exist := newLabels[key]; exist && !overwrite {
-		return fmt.Errorf("Key %s already exist on %s", key, s.ID())
+	newLabels, err := setGCPLabel(snap.Labels, s.ID(), key, value, overwrite)
+	if err != nil {
+		return err
 	}
-	newLabels[key] = value
 	req := &compute.GlobalSetLabelsRequest{
 		Labels:           newLabels,
 		LabelFingerprint: snap.LabelFingerprint,
@@ -114,21 +126,16 @@ func (s *gcpSnapshot) SetTag(key, value string, overwrite bool) error {
 	if err != nil {
 		return err
 	}
-	s.tags = newLabels
+	s.tags = decodeGCPLabels(newLabels)
 	return nil
 }
 
 func (s *gcpSnapshot) RemoveTag(key string) error {
-	newLabels := make(map[string]string)
-	for k, val := range s.tags {
-		if k != key {
-			newLabels[k] = val
-		}
-	}
 	snap, err := s.compute.Snapshots.Get(s.Owner(), s.ID()).Do()
 	if err != nil {
 		return err
 	}
+	newLabels := removeGCPLabel(snap.Labels, key)
 	req := &compute.GlobalSetLabelsRequest{
 		Labels:           newLabels,
 		LabelFingerprint: snap.LabelFingerprint,
@@ -137,6 +144,27 @@ func (s *gcpSnapshot) RemoveTag(key string) error {
 	if err != nil {
 		return err
 	}
-	s.tags = newLabels
+	s.tags = decodeGCPLabels(newLabels)
+	return nil
+}
+
+func (s *gcpSnapshot) MakePrivate() error {
+	log.Printf("Making snapshot %s private in %s", s.ID(), s.Owner())
+	if !s.Public() {
+		// Snapshot is already private
+		return nil
+	}
+	policy, err := s.compute.Snapshots.GetIamPolicy(s.Owner(), s.ID()).Do()
+	if err != nil {
+		return err
+	}
+	req := &compute.GlobalSetPolicyRequest{
+		Policy: removeGCPPublicMembers(policy),
+	}
+	_, err = s.compute.Snapshots.SetIamPolicy(s.Owner(), s.ID(), req).Do()
+	if err != nil {
+		return err
+	}
+	s.public = false
 	return nil
 }
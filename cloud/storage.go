@@ -0,0 +1,68 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// UploadObject uploads data to an object in S3 or GCS, specified with a
+// URL such as s3://bucket/path/to/object or gs://bucket/path/to/object.
+// The credentials housekeeper runs with are used, without assuming a
+// role in any account.
+func UploadObject(destination string, data []byte) error {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return fmt.Errorf("Invalid destination \"%s\": %s", destination, err)
+	}
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return fmt.Errorf("Destination \"%s\" must include both a bucket and an object name", destination)
+	}
+	switch u.Scheme {
+	case "s3":
+		return uploadS3Object(bucket, key, data)
+	case "gs":
+		return uploadGCSObject(bucket, key, data)
+	default:
+		return fmt.Errorf("Destination \"%s\" must start with s3:// or gs://", destination)
+	}
+}
+
+func uploadS3Object(bucket, key string, data []byte) error {
+	sess := NewAWSSession()
+	region, err := s3manager.GetBucketRegion(context.Background(), sess, bucket, defaultAWSRegion)
+	if err != nil {
+		return err
+	}
+	sess.Config.Region = aws.String(region)
+	uploader := s3manager.NewUploader(sess)
+	_, err = uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+func uploadGCSObject(bucket, name string, data []byte) error {
+	client, err := NewGCPHttpClient()
+	if err != nil {
+		return err
+	}
+	storageService, err := storage.New(client)
+	if err != nil {
+		return fmt.Errorf("Could not initialize storage service: %s", err)
+	}
+	_, err = storageService.Objects.Insert(bucket, &storage.Object{Name: name}).Media(bytes.NewReader(data)).Do()
+	return err
+}
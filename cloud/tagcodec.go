@@ -0,0 +1,141 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// GCP labels can be at most 63 characters long
+	gcpLabelMaxLength = 63
+	gcpEscapeChar     = '_'
+	// gcpEncodedPrefix marks the values that have been escaped. Escaped
+	// values never start with _ otherwise, since _ is escaped itself.
+	gcpEncodedPrefix = "_hk_"
+)
+
+// EncodeTagValue converts a tag value into one that can be stored on a
+// resource in the specified CSP. AWS tags can hold any value, while GCP
+// labels can only contain lowercase letters, digits, - and _. Other
+// characters are escaped as _ followed by their hex code, and the value
+// is prefixed with "_hk_" to mark it as escaped, so that e.g.
+// "2018-01-25T16:51:39Z" is stored as "_hk_2018-01-25_5416_3a51_3a39_5a".
+// Values without such characters are stored as they are. Values that are
+// too long for a GCP label are truncated, so they can't be decoded back
+// into the original value.
+func EncodeTagValue(csp CSP, value string) string {
+	if csp != GCP {
+		return value
+	}
+	encoded, _ := encodeGCPTagValue(value)
+	return encoded
+}
+
+// encodeGCPTagValue escapes a value for a GCP label, and tells whether it
+// had to be truncated
+func encodeGCPTagValue(value string) (string, bool) {
+	escaped := false
+	for _, r := range value {
+		escaped = escaped || needsGCPEscape(r)
+	}
+	var encoded strings.Builder
+	if escaped {
+		encoded.WriteString(gcpEncodedPrefix)
+	}
+	for _, r := range value {
+		var part string
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			part = string(r)
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			part = fmt.Sprintf("%c%02x", gcpEscapeChar, r)
+		case r > unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			// GCP allows international characters, as long as they're lowercase
+			part = string(unicode.ToLower(r))
+		default:
+			part = "-"
+		}
+		if encoded.Len()+len(part) > gcpLabelMaxLength {
+			return encoded.String(), true
+		}
+		encoded.WriteString(part)
+	}
+	return encoded.String(), false
+}
+
+// DecodeTagValue converts a tag value read from a resource in the
+// specified CSP back into the value that was given to EncodeTagValue.
+// Only values marked as escaped by EncodeTagValue are decoded, so labels
+// written by hand, such as "backup_20231201", are left alone.
+func DecodeTagValue(csp CSP, value string) string {
+	if csp != GCP || !strings.HasPrefix(value, gcpEncodedPrefix) {
+		return value
+	}
+	value = strings.TrimPrefix(value, gcpEncodedPrefix)
+	var decoded strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == gcpEscapeChar && i+3 <= len(value) {
+			code, err := strconv.ParseUint(value[i+1:i+3], 16, 8)
+			if err == nil && value[i+1:i+3] == strings.ToLower(value[i+1:i+3]) && needsGCPEscape(rune(code)) {
+				decoded.WriteByte(byte(code))
+				i += 2
+				continue
+			}
+		}
+		decoded.WriteByte(value[i])
+	}
+	return decoded.String()
+}
+
+// needsGCPEscape checks if a character is escaped by EncodeTagValue
+func needsGCPEscape(r rune) bool {
+	isValid := (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-'
+	return !isValid && r < unicode.MaxASCII && unicode.IsPrint(r)
+}
+
+// decodeGCPLabels returns the labels of a GCP resource as tags, with
+// their values decoded
+func decodeGCPLabels(labels map[string]string) map[string]string {
+	tags := make(map[string]string)
+	for key, value := range labels {
+		tags[key] = DecodeTagValue(GCP, value)
+	}
+	return tags
+}
+
+// setGCPLabel returns a copy of the labels of a GCP resource, with the
+// specified label encoded and added to it
+func setGCPLabel(labels map[string]string, id, key, value string, overwrite bool) (map[string]string, error) {
+	key = strings.ToLower(key)
+	if _, exist := labels[key]; exist && !overwrite {
+		return nil, fmt.Errorf("Key %s already exist on %s", key, id)
+	}
+	newLabels := make(map[string]string)
+	for k, val := range labels {
+		newLabels[k] = val
+	}
+	encoded, truncated := encodeGCPTagValue(value)
+	if truncated {
+		log.Printf("The value of %s on %s is too long for a GCP label, only \"%s\" is kept\n", key, id, DecodeTagValue(GCP, encoded))
+	}
+	newLabels[key] = encoded
+	return newLabels, nil
+}
+
+// removeGCPLabel returns a copy of the labels of a GCP resource,
+// without the specified label
+func removeGCPLabel(labels map[string]string, key string) map[string]string {
+	newLabels := make(map[string]string)
+	for k, val := range labels {
+		if k != strings.ToLower(key) {
+			newLabels[k] = val
+		}
+	}
+	return newLabels
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var gcpLabelValue = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{N}_-]{0,63}$`)
+
+func TestEncodeGCPTagValue(t *testing.T) {
+	values := []string{
+		"2018-01-25T16:51:39-08:00",
+		"2018-06-17",
+		"until=2026-12-31;reason=perf-lab",
+		"old: older_than_days(days=30), unattached",
+		"days-5",
+		"",
+	}
+	for _, value := range values {
+		encoded := EncodeTagValue(GCP, value)
+		if !gcpLabelValue.MatchString(encoded) {
+			t.Errorf("\"%s\" is not a valid GCP label value", encoded)
+		}
+		if decoded := DecodeTagValue(GCP, encoded); decoded != value {
+			t.Errorf("Expected \"%s\" after decoding, got \"%s\"", value, decoded)
+		}
+	}
+
+	if EncodeTagValue(GCP, "2018-01-25T16:51:39Z") != "_hk_2018-01-25_5416_3a51_3a39_5a" {
+		t.Errorf("Unexpected encoding: %s", EncodeTagValue(GCP, "2018-01-25T16:51:39Z"))
+	}
+	if EncodeTagValue(GCP, "2018-06-17") != "2018-06-17" {
+		t.Error("Values without escapes should be stored as they are")
+	}
+	if EncodeTagValue(AWS, "Some Value") != "Some Value" {
+		t.Error("AWS tag values should not be encoded")
+	}
+}
+
+func TestEncodeLongGCPTagValue(t *testing.T) {
+	value := strings.Repeat("a:", 40)
+	encoded := EncodeTagValue(GCP, value)
+	if len(encoded) > gcpLabelMaxLength {
+		t.Errorf("Encoded value is too long: %d", len(encoded))
+	}
+	// Escapes must not be cut in half when truncating
+	if decoded := DecodeTagValue(GCP, encoded); !strings.HasPrefix(value, decoded) || strings.Contains(decoded, "_") {
+		t.Errorf("Truncated value was not decoded correctly: %s", decoded)
+	}
+	if _, truncated := encodeGCPTagValue(value); !truncated {
+		t.Error("Expected the value to be reported as truncated")
+	}
+	if _, truncated := encodeGCPTagValue("old; public"); truncated {
+		t.Error("Short values should not be reported as truncated")
+	}
+}
+
+func TestDecodeHandWrittenGCPLabels(t *testing.T) {
+	for _, value := range []string{"build_12", "perf_lab", "my_ab_label", "trailing_", "backup_20231201", "team_2b", "v1_41"} {
+		if decoded := DecodeTagValue(GCP, value); decoded != value {
+			t.Errorf("Hand written label \"%s\" should not be decoded, got \"%s\"", value, decoded)
+		}
+		// The same values set by housekeeper survive a round trip
+		if decoded := DecodeTagValue(GCP, EncodeTagValue(GCP, value)); decoded != value {
+			t.Errorf("Expected \"%s\" after a round trip, got \"%s\"", value, decoded)
+		}
+	}
+}
@@ -5,11 +5,9 @@ package cloud
 
 import (
 	"errors"
-	"fmt"
 	"log"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	compute "google.golang.org/api/compute/v1"
 )
@@ -58,21 +56,11 @@ type awsVolume struct {
 
 func (v *awsVolume) Cleanup() error {
 	log.Printf("Cleaning up volume %s in %s", v.ID(), v.Owner())
-	return awsTryWithBackoff(v.cleanup)
-}
-
-func (v *awsVolume) cleanup() error {
 	client := clientForAWSResource(v)
 	input := &ec2.DeleteVolumeInput{
 		VolumeId: aws.String(v.ID()),
 	}
 	_, err := client.DeleteVolume(input)
-	if err != nil {
-		aerr, ok := err.(awserr.Error)
-		if ok && aerr.Code() == requestLimitErrorCode {
-			return errAWSRequestLimit
-		}
-	}
 	return err
 }
 
@@ -89,58 +77,67 @@ func (v *awsVolume) RemoveTag(key string) error {
 type gcpVolume struct {
 	baseVolume
 	compute *compute.Service
+	// regional disks are replicated across the zones of a region, their
+	// location is the region rather than a zone
+	regional bool
 }
 
 func (v *gcpVolume) Cleanup() error {
 	log.Printf("Cleaning up volume %s in %s", v.ID(), v.Owner())
-	_, err := v.compute.Disks.Delete(v.Owner(), v.Location(), v.ID()).Do()
+	var err error
+	if v.regional {
+		_, err = v.compute.RegionDisks.Delete(v.Owner(), v.Location(), v.ID()).Do()
+	} else {
+		_, err = v.compute.Disks.Delete(v.Owner(), v.Location(), v.ID()).Do()
+	}
 	return err
 }
 
 func (v *gcpVolume) SetTag(key, value string, overwrite bool) error {
-	disk, err := v.compute.Disks.Get(v.Owner(), v.Location(), v.ID()).Do()
+	disk, err := v.getDisk()
 	if err != nil {
 		return err
 	}
-	newLabels := disk.Labels
-	if newLabels == nil {
-		newLabels = make(map[string]string)
-	}
-	if _, exist := newLabels[key]; exist && !overwrite {
-		return fmt.Errorf("Key %s already exist on %s", key, v.ID())
-	}
-	newLabels[key] = value
-	req := &compute.ZoneSetLabelsRequest{
-		LabelFingerprint: disk.LabelFingerprint,
-		Labels:           newLabels,
-	}
-	_, err = v.compute.Disks.SetLabels(v.Owner(), v.Location(), v.ID(), req).Do()
+	newLabels, err := setGCPLabel(disk.Labels, v.ID(), key, value, overwrite)
 	if err != nil {
 		return err
 	}
-	v.tags = newLabels
-	return nil
+	return v.setLabels(disk, newLabels)
 }
 
 func (v *gcpVolume) RemoveTag(key string) error {
-	newLabels := make(map[string]string)
-	for k, val := range v.tags {
-		if k != key {
-			newLabels[k] = val
-		}
-	}
-	disk, err := v.compute.Disks.Get(v.Owner(), v.Location(), v.ID()).Do()
+	disk, err := v.getDisk()
 	if err != nil {
 		return err
 	}
-	req := &compute.ZoneSetLabelsRequest{
-		Labels:           newLabels,
-		LabelFingerprint: disk.LabelFingerprint,
+	return v.setLabels(disk, removeGCPLabel(disk.Labels, key))
+}
+
+func (v *gcpVolume) getDisk() (*compute.Disk, error) {
+	if v.regional {
+		return v.compute.RegionDisks.Get(v.Owner(), v.Location(), v.ID()).Do()
+	}
+	return v.compute.Disks.Get(v.Owner(), v.Location(), v.ID()).Do()
+}
+
+func (v *gcpVolume) setLabels(disk *compute.Disk, newLabels map[string]string) error {
+	var err error
+	if v.regional {
+		req := &compute.RegionSetLabelsRequest{
+			LabelFingerprint: disk.LabelFingerprint,
+			Labels:           newLabels,
+		}
+		_, err = v.compute.RegionDisks.SetLabels(v.Owner(), v.Location(), v.ID(), req).Do()
+	} else {
+		req := &compute.ZoneSetLabelsRequest{
+			LabelFingerprint: disk.LabelFingerprint,
+			Labels:           newLabels,
+		}
+		_, err = v.compute.Disks.SetLabels(v.Owner(), v.Location(), v.ID(), req).Do()
 	}
-	_, err = v.compute.Disks.SetLabels(v.Owner(), v.Location(), v.ID(), req).Do()
 	if err != nil {
 		return err
 	}
-	v.tags = newLabels
+	v.tags = decodeGCPLabels(newLabels)
 	return nil
 }
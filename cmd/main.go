@@ -6,14 +6,21 @@ package main
 import (
 	"brkt/cloudsweeper/cloud"
 	"brkt/cloudsweeper/cloud/billing"
+	"brkt/cloudsweeper/cloud/filter"
 	hk "brkt/cloudsweeper/housekeeper"
+	"brkt/cloudsweeper/housekeeper/approval"
+	"brkt/cloudsweeper/housekeeper/audit"
 	"brkt/cloudsweeper/housekeeper/cleanup"
+	"brkt/cloudsweeper/housekeeper/freeze"
 	"brkt/cloudsweeper/housekeeper/notify"
+	"brkt/cloudsweeper/housekeeper/policy"
+	"brkt/cloudsweeper/housekeeper/schedule"
 	"brkt/cloudsweeper/housekeeper/setup"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 )
@@ -26,12 +33,56 @@ const (
 	prodAWSAccount      = "992270393355"
 
 	warningHoursInAdvance = 48
+
+	defaultUnencryptedDays = 30
+	defaultHandoverDays    = 30
+	defaultOrphanGraceDays = 2
+	defaultEncryptionEnvs  = "prod"
+
+	defaultPlanFile     = "plan.json"
+	defaultAuditFile    = "audit.jsonl"
+	defaultApprovalFile = "approvals.json"
+	defaultApprovalAddr = ":8080"
+
+	approvalSecretKey = "APPROVAL_SECRET"
 )
 
 var (
 	orgFile      = flag.String("org-file", defaultOrgFile, "Specify where to find the JSON with organization information")
 	warningHours = flag.Int("warning-hours", warningHoursInAdvance, "The number of hours in advance to warn about resource deletion")
 	cspToUse     = flag.String("csp", defaultCSPFlag, "Which CSP to run against")
+	remediate    = flag.Bool("remediate", false, "Make public resources private when running the security review")
+
+	unencryptedDays = flag.Int("unencrypted-days", defaultUnencryptedDays, "The number of days before unencrypted resources are marked for cleanup")
+	enforceEnvs     = flag.String("encryption-environments", defaultEncryptionEnvs, "Comma separated list of account environments where encryption is enforced")
+	orphanGrace     = flag.Int("orphan-grace-days", defaultOrphanGraceDays, "The number of days after which orphaned resources marked for cleanup are deleted")
+	handoverDays    = flag.Int("handover-days", defaultHandoverDays, "The number of days managers have to hand over the resources of disabled employees before they're marked for cleanup")
+
+	policyFile = flag.String("policy-file", "", "Specify where to find the JSON policy with cleanup rules. The default policy is used if not set")
+	dryRun     = flag.Bool("dry-run", false, "Only report what the schedule, migrate-tags and reset commands would change")
+	tagConfig  = flag.String("tag-config", "", "Specify where to find the JSON with the tag keys to use. The default keys are used if not set")
+	freezeFile = flag.String("freeze-calendar", "", "Specify where to find the iCalendar file with the change freezes, when nothing is deleted or stopped")
+	planFile   = flag.String("plan-file", defaultPlanFile, "Specify where the plan and apply commands write and read the plan")
+	noLimits   = flag.Bool("override-limits", false, "Ignore the safety limits of the policy, deleting everything that has expired")
+	retryLimit = flag.Int("retry-budget", cloud.DefaultRetryBudget, "The number of times throttled or failed AWS and GCP calls are retried during a run")
+
+	auditFile   = flag.String("audit-file", defaultAuditFile, "Specify where to append the audit journal of all changes made to resources")
+	auditUpload = flag.String("audit-upload", "", "Upload the audit journal of every run to this S3 or GCS prefix, e.g. s3://bucket/audit")
+	auditActor  = flag.String("audit-actor", defaultActor(), "Who is running housekeeper, as recorded in the audit journal")
+	account     = flag.String("account", "", "Only show audit entries for this account")
+	resourceID  = flag.String("resource-id", "", "Only show audit entries for this resource")
+	since       = flag.String("since", "", "Only show audit entries from this date, e.g. 2018-01-29")
+	until       = flag.String("until", "", "Only show audit entries before this date, e.g. 2018-02-01")
+
+	resetAccounts = flag.String("reset-accounts", "", "Comma separated list of accounts to reset. All accounts are reset if not set")
+	resetIDs      = flag.String("reset-ids", "", "Comma separated list of resource IDs to reset. All resources are reset if not set")
+	resetKinds    = flag.String("reset-kinds", "", "Comma separated list of resource kinds to reset, e.g. volume,snapshot. All kinds are reset if not set")
+	markedAfter   = flag.String("marked-after", "", "Only reset resources marked for deletion after this date, e.g. 2018-01-29")
+	clearLifetime = flag.Bool("clear-lifetime", false, "Also remove lifetime and expiry tags when resetting")
+
+	approvalFile = flag.String("approval-file", defaultApprovalFile, "Specify where to keep the deletions that await the approval of a manager")
+	approvalURL  = flag.String("approval-url", "http://localhost"+defaultApprovalAddr, "The URL of the approval server, used for the links in approval emails")
+	approvalAddr = flag.String("approval-addr", defaultApprovalAddr, "The address the approval server listens on")
 )
 
 const banner = `
@@ -51,6 +102,22 @@ const (
 	cmdWarn     = "warn"
 	cmdBilling  = "billing-report"
 	cmdUntagged = "find-untagged"
+	cmdSecurity = "security-review"
+	cmdEncrypt  = "encryption-review"
+	cmdEnforce  = "mark-unencrypted"
+	cmdOrphans  = "find-orphans"
+	cmdMarkOrph = "mark-orphans"
+	cmdPolicy   = "policy-check"
+	cmdWLReview = "whitelist-review"
+	cmdTagCheck = "tag-report"
+	cmdSchedule = "schedule"
+	cmdMigrate  = "migrate-tags"
+	cmdPlanMark = "plan-mark"
+	cmdPlanDel  = "plan-cleanup"
+	cmdApply    = "apply"
+	cmdAudit    = "audit"
+	cmdOffboard = "offboard"
+	cmdApprove  = "approval-server"
 
 	defaultCSPFlag = cspFlagAWS
 	cspFlagAWS     = "aws"
@@ -60,24 +127,38 @@ const (
 func main() {
 	fmt.Println(banner)
 	flag.Parse()
+	loadTagKeys(*tagConfig)
+	loadFreezeCalendar(*freezeFile)
+	cloud.SetRetryBudget(*retryLimit)
 	csp := cspFromFlag(*cspToUse)
 	fmt.Printf("Running against %s...\n", csp)
-	switch getPositional() {
+	command := getPositional()
+	journal := audit.New(*auditFile, *auditActor, command)
+	audit.SetJournal(journal)
+	defer closeJournal(journal)
+	approvals := approval.NewStore(*approvalFile)
+	cleanup.SetApprovalStore(approvals)
+	switch command {
 	case cmdCleanup:
 		log.Println("Cleaning up old resources")
 		org := parseOrganization(*orgFile)
+		pol := loadPolicy(*policyFile)
+		secret := requiredApprovalSecret(pol)
 		mngr := initManager(csp, org)
-		cleanup.PerformCleanup(mngr)
+		cleanup.PerformCleanup(mngr, pol, policyAccounts(org, csp))
+		requestApprovals(approvals, pol, org, csp, secret)
 	case cmdReset:
-		log.Println("Resetting all tags")
+		log.Println("Resetting cleanup tags")
+		scope := resetScope()
 		org := parseOrganization(*orgFile)
 		mngr := initManager(csp, org)
-		cleanup.ResetHousekeeper(mngr)
+		cleanup.ResetHousekeeper(mngr, scope, *dryRun)
 	case cmdMark:
 		log.Println("Marking old resources for cleanup")
 		org := parseOrganization(*orgFile)
+		pol := loadPolicy(*policyFile)
 		mngr := initManager(csp, org)
-		cleanup.MarkForCleanup(mngr)
+		cleanup.MarkForCleanup(mngr, pol, policyAccounts(org, csp))
 	case cmdReview:
 		log.Println("Sending out old resource review")
 		org := parseOrganization(*orgFile)
@@ -107,8 +188,119 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
+		mngr = audit.Wrap(mngr)
 		mapping := map[string]string{sharedDevAWSAccount: "cloud-dev", prodAWSAccount: "prod", sharedQAAccount: "qa"}
 		notify.UntaggedResourcesReview(mngr, mapping)
+	case cmdSecurity:
+		log.Println("Sending out public resource review")
+		org := parseOrganization(*orgFile)
+		mngr := initManager(csp, org)
+		notify.PublicResourceReview(mngr, org.AccountToUserMapping(csp), *remediate)
+	case cmdEncrypt:
+		log.Println("Sending out encryption review")
+		org := parseOrganization(*orgFile)
+		mngr := initManager(csp, org)
+		notify.EncryptionReview(mngr, org, csp)
+	case cmdEnforce:
+		log.Println("Marking unencrypted resources for cleanup")
+		org := parseOrganization(*orgFile)
+		accounts := org.EnabledAccountsInEnvironments(csp, strings.Split(*enforceEnvs, ",")...)
+		mngr, err := cloud.NewManager(csp, accounts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mngr = audit.Wrap(mngr)
+		cleanup.MarkUnencryptedForCleanup(mngr, *unencryptedDays)
+	case cmdOrphans:
+		log.Println("Sending out orphaned resource review")
+		org := parseOrganization(*orgFile)
+		mngr := initManager(csp, org)
+		notify.OrphanReview(mngr, org.AccountToUserMapping(csp))
+	case cmdMarkOrph:
+		log.Println("Marking orphaned resources for cleanup")
+		org := parseOrganization(*orgFile)
+		mngr := initManager(csp, org)
+		cleanup.MarkOrphansForCleanup(mngr, *orphanGrace)
+	case cmdWLReview:
+		log.Println("Sending out whitelist review")
+		org := parseOrganization(*orgFile)
+		mngr := initManager(csp, org)
+		notify.WhitelistReview(mngr, org.AccountToUserMapping(csp))
+	case cmdTagCheck:
+		log.Println("Sending out malformed tag report")
+		org := parseOrganization(*orgFile)
+		mngr := initManager(csp, org)
+		notify.MalformedTagsReport(mngr, org.AccountToUserMapping(csp))
+	case cmdSchedule:
+		log.Println("Enforcing instance schedules")
+		org := parseOrganization(*orgFile)
+		mngr := initManager(csp, org)
+		schedule.EnforceSchedules(mngr, *dryRun)
+	case cmdMigrate:
+		log.Println("Migrating legacy tag keys")
+		org := parseOrganization(*orgFile)
+		mngr := initManager(csp, org)
+		cleanup.MigrateTags(mngr, *dryRun)
+	case cmdPlanMark:
+		log.Println("Planning which resources to mark for cleanup")
+		org := parseOrganization(*orgFile)
+		pol := loadPolicy(*policyFile)
+		mngr := initManager(csp, org)
+		writePlan(mngr, csp, cleanup.PlanMark, pol, policyAccounts(org, csp))
+	case cmdPlanDel:
+		log.Println("Planning which resources to clean up")
+		org := parseOrganization(*orgFile)
+		pol := loadPolicy(*policyFile)
+		mngr := initManager(csp, org)
+		writePlan(mngr, csp, cleanup.PlanCleanup, pol, policyAccounts(org, csp))
+	case cmdApply:
+		log.Println("Applying plan from", *planFile)
+		plan, err := cleanup.ReadPlan(*planFile)
+		if err != nil {
+			log.Fatalf("Failed to read plan: %s\n", err)
+		}
+		if plan.CSP != csp {
+			log.Fatalf("The plan was made for %s, not %s\n", plan.CSP, csp)
+		}
+		overrideLimits(plan.Policy)
+		secret := requiredApprovalSecret(plan.Policy)
+		org := parseOrganization(*orgFile)
+		mngr := initManager(csp, org)
+		cleanup.ApplyPlan(mngr, plan, policyAccounts(org, csp))
+		requestApprovals(approvals, plan.Policy, org, csp, secret)
+	case cmdAudit:
+		log.Println("Searching the audit journal in", *auditFile)
+		entries, err := audit.Search(*auditFile, auditQuery())
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, e := range entries {
+			fmt.Println(e)
+		}
+		log.Printf("Found %d audit entries\n", len(entries))
+	case cmdOffboard:
+		log.Println("Offboarding disabled employees")
+		org := parseOrganization(*orgFile)
+		accounts := []string{}
+		for _, employee := range org.DisabledEmployees() {
+			accounts = append(accounts, employee.EnabledAccounts(csp)...)
+		}
+		mngr, err := cloud.NewManager(csp, accounts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mngr = audit.Wrap(mngr)
+		handovers := cleanup.Offboard(mngr, org, csp, *handoverDays)
+		notify.OffboardingReport(handovers)
+	case cmdApprove:
+		log.Println("Serving deletion approvals on", *approvalAddr)
+		server := approval.NewServer(approvals, approvalSecret())
+		log.Fatal(http.ListenAndServe(*approvalAddr, server))
+	case cmdPolicy:
+		log.Println("Checking cleanup policy")
+		pol := loadPolicy(*policyFile)
+		fmt.Println(pol.Describe())
+		fmt.Println("The policy is valid")
 	case cmdSetup:
 		log.Println("Running housekeeper setup")
 		setup.PerformSetup()
@@ -125,7 +317,101 @@ func initManager(csp cloud.CSP, org *hk.Organization) cloud.ResourceManager {
 		log.Fatal(err)
 		return nil
 	}
-	return manager
+	return audit.Wrap(manager)
+}
+
+// closeJournal closes the audit journal once the command is done, and
+// uploads the entries of this run if requested
+func closeJournal(journal *audit.Journal) {
+	if err := journal.Close(); err != nil {
+		log.Printf("Could not close audit journal: %s\n", err)
+	}
+	if *auditUpload != "" {
+		if err := journal.Upload(*auditUpload); err != nil {
+			log.Printf("Could not upload audit journal: %s\n", err)
+		}
+	}
+}
+
+// requestApprovals emails managers the deletions awaiting their approval,
+// if the policy requires approval
+func requestApprovals(store *approval.Store, pol *policy.Policy, org *hk.Organization, csp cloud.CSP, secret []byte) {
+	if pol.Approval == nil {
+		return
+	}
+	notify.ApprovalRequests(store, org, csp, *approvalURL, secret)
+}
+
+// requiredApprovalSecret returns the secret approval links are signed
+// with if the policy requires approval, so that a missing secret is found
+// before anything is deleted or requested
+func requiredApprovalSecret(pol *policy.Policy) []byte {
+	if pol.Approval == nil {
+		return nil
+	}
+	return approvalSecret()
+}
+
+// approvalSecret returns the secret approval links are signed with
+func approvalSecret() []byte {
+	secret, exist := os.LookupEnv(approvalSecretKey)
+	if !exist || secret == "" {
+		log.Fatalf("%s is required to sign and verify approval links\n", approvalSecretKey)
+	}
+	return []byte(secret)
+}
+
+func auditQuery() audit.Query {
+	q := audit.Query{Account: *account, ResourceID: *resourceID}
+	var err error
+	if *since != "" {
+		if q.Since, err = filter.ParseTagTime(*since); err != nil {
+			log.Fatalf("Invalid since date: %s\n", err)
+		}
+	}
+	if *until != "" {
+		if q.Until, err = filter.ParseTagTime(*until); err != nil {
+			log.Fatalf("Invalid until date: %s\n", err)
+		}
+	}
+	return q
+}
+
+func resetScope() cleanup.ResetScope {
+	scope := cleanup.ResetScope{
+		Accounts:      splitList(*resetAccounts),
+		ResourceIDs:   splitList(*resetIDs),
+		Kinds:         splitList(*resetKinds),
+		ClearLifetime: *clearLifetime,
+	}
+	if *markedAfter != "" {
+		var err error
+		if scope.MarkedAfter, err = filter.ParseTagTime(*markedAfter); err != nil {
+			log.Fatalf("Invalid marked-after date: %s\n", err)
+		}
+	}
+	if err := scope.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	return scope
+}
+
+// splitList splits a comma separated flag value, skipping empty items
+func splitList(value string) []string {
+	result := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func defaultActor() string {
+	if user, exist := os.LookupEnv("USER"); exist {
+		return user
+	}
+	return "housekeeper"
 }
 
 func parseOrganization(inputFile string) *hk.Organization {
@@ -140,6 +426,66 @@ func parseOrganization(inputFile string) *hk.Organization {
 	return org
 }
 
+func loadPolicy(inputFile string) *policy.Policy {
+	pol, err := policy.Load(inputFile)
+	if err != nil {
+		log.Fatalf("Failed to load policy: %s\n", err)
+	}
+	overrideLimits(pol)
+	return pol
+}
+
+// overrideLimits removes the safety limits from a policy, if requested
+func overrideLimits(pol *policy.Policy) {
+	if *noLimits && pol.Limits != nil {
+		log.Println("Overriding the safety limits of the policy")
+		pol.Limits = nil
+	}
+}
+
+// policyAccounts describes every account in the organization, so that
+// policy overrides can be resolved for them
+func policyAccounts(org *hk.Organization, csp cloud.CSP) map[string]policy.Account {
+	departments := org.AccountToDepartmentMapping(csp)
+	environments := org.AccountToEnvironmentMapping(csp)
+	accounts := make(map[string]policy.Account)
+	for id := range departments {
+		accounts[id] = policy.Account{
+			ID:          id,
+			Department:  departments[id],
+			Environment: environments[id],
+		}
+	}
+	return accounts
+}
+
+func loadTagKeys(inputFile string) {
+	keys, err := filter.LoadTagKeys(inputFile)
+	if err != nil {
+		log.Fatalf("Failed to load tag keys: %s\n", err)
+	}
+	filter.SetTagKeys(keys)
+}
+
+func loadFreezeCalendar(inputFile string) {
+	calendar, err := freeze.Load(inputFile)
+	if err != nil {
+		log.Fatalf("Failed to load freeze calendar: %s\n", err)
+	}
+	freeze.SetCalendar(calendar)
+}
+
+func writePlan(mngr cloud.ResourceManager, csp cloud.CSP, command string, pol *policy.Policy, accounts map[string]policy.Account) {
+	plan, err := cleanup.MakePlan(mngr, csp, command, pol, accounts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = plan.Write(*planFile); err != nil {
+		log.Fatalf("Failed to write plan: %s\n", err)
+	}
+	log.Println("Wrote plan to", *planFile)
+}
+
 func getPositional() string {
 	n := len(os.Args)
 	if n <= 1 {
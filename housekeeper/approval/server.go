@@ -0,0 +1,146 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package approval
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const decidePath = "/decide"
+
+// Sign returns the token of a link for a decision on a request. The token
+// proves that the link was sent by housekeeper to the specified manager.
+func Sign(secret []byte, key, decision, by string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{key, decision, by}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the token of a link for a decision on a request
+func Verify(secret []byte, key, decision, by, token string) bool {
+	return hmac.Equal([]byte(Sign(secret, key, decision, by)), []byte(token))
+}
+
+// Link returns the link a manager follows to make a decision on a
+// request, served by the server at baseURL
+func Link(baseURL string, secret []byte, key, decision, by string) string {
+	params := url.Values{}
+	params.Set("key", key)
+	params.Set("decision", decision)
+	params.Set("by", by)
+	params.Set("token", Sign(secret, key, decision, by))
+	return strings.TrimSuffix(baseURL, "/") + decidePath + "?" + params.Encode()
+}
+
+// Server serves the links in the approval emails. Following a link shows
+// the request and asks the manager to confirm the decision, so that mail
+// scanners following links don't make decisions. The decision is recorded
+// once it's confirmed.
+type Server struct {
+	store  *Store
+	secret []byte
+}
+
+// NewServer returns a server recording decisions in the store. The secret
+// must be the one the links were signed with.
+func NewServer(store *Store, secret []byte) *Server {
+	return &Server{store: store, secret: secret}
+}
+
+type pageData struct {
+	Request  *Request
+	Decision string
+	By       string
+	Token    string
+	Message  string
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != decidePath {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	data := pageData{
+		Decision: r.Form.Get("decision"),
+		By:       r.Form.Get("by"),
+		Token:    r.Form.Get("token"),
+	}
+	key := r.Form.Get("key")
+	if !Verify(s.secret, key, data.Decision, data.By, data.Token) {
+		http.Error(w, "Invalid or tampered link", http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		requests, err := s.store.Requests()
+		if err != nil {
+			log.Printf("Could not read approvals: %s\n", err)
+			http.Error(w, "Could not read approvals", http.StatusInternalServerError)
+			return
+		}
+		request, exist := requests[key]
+		if !exist {
+			http.Error(w, "This deletion no longer awaits approval", http.StatusNotFound)
+			return
+		}
+		data.Request = request
+	case http.MethodPost:
+		request, err := s.store.Decide(key, data.Decision, data.By)
+		if err != nil {
+			log.Printf("Could not record decision on %s: %s\n", key, err)
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("%s decided to %s the deletion of %s\n", data.By, data.Decision, key)
+		data.Request = request
+		data.Message = "Your decision has been recorded."
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := pageTemplate.Execute(w, data); err != nil {
+		log.Printf("Could not render approval page: %s\n", err)
+	}
+}
+
+var pageTemplate = template.Must(template.New("approval").Parse(`<!DOCTYPE html>
+<html>
+<head><title>HouseKeeper deletion approval</title></head>
+<body>
+<h1>{{ if eq .Decision "approve" }}Approve{{ else }}Decline{{ end }} deletion</h1>
+<table>
+	<tr><th style="text-align:left;">Account</th><td>{{ .Request.Account }}</td></tr>
+	<tr><th style="text-align:left;">Kind</th><td>{{ .Request.Kind }}</td></tr>
+	<tr><th style="text-align:left;">ID</th><td>{{ .Request.ID }}</td></tr>
+	<tr><th style="text-align:left;">Location</th><td>{{ .Request.Location }}</td></tr>
+	<tr><th style="text-align:left;">Reason</th><td>{{ .Request.Reason }}</td></tr>
+	<tr><th style="text-align:left;">Monthly cost</th><td>${{ printf "%.2f" .Request.MonthlyCost }}</td></tr>
+	<tr><th style="text-align:left;">Status</th><td>{{ .Request.Status }}{{ if .Request.DecidedBy }} by {{ .Request.DecidedBy }}{{ end }}</td></tr>
+</table>
+{{ if .Message }}
+<p>{{ .Message }}</p>
+{{ else }}
+<form method="post" action="decide">
+	<input type="hidden" name="key" value="{{ .Request.Key }}">
+	<input type="hidden" name="decision" value="{{ .Decision }}">
+	<input type="hidden" name="by" value="{{ .By }}">
+	<input type="hidden" name="token" value="{{ .Token }}">
+	<button type="submit">{{ if eq .Decision "approve" }}Approve{{ else }}Decline{{ end }} deletion</button>
+</form>
+{{ end }}
+</body>
+</html>
+`))
@@ -0,0 +1,66 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package approval
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	store, cleanup := tempStore(t)
+	defer cleanup()
+	if _, err := store.Request([]*Request{{Account: "111", Kind: "volume", Location: "us-west-2", ID: "vol-1"}}); err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("s3cret")
+	server := httptest.NewServer(NewServer(store, secret))
+	defer server.Close()
+
+	link := Link(server.URL, secret, "111/volume/us-west-2/vol-1", DecisionDecline, "boss")
+	resp, err := http.Get(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the confirmation page, got %s", resp.Status)
+	}
+	requests, _ := store.Requests()
+	if requests["111/volume/us-west-2/vol-1"].Status != StatusPending {
+		t.Error("Following a link should not decide anything")
+	}
+
+	parsed, _ := url.Parse(link)
+	form := parsed.Query()
+	tampered := url.Values{}
+	for k, v := range form {
+		tampered[k] = v
+	}
+	tampered.Set("decision", DecisionApprove)
+	resp, err = http.PostForm(server.URL+decidePath, tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("A tampered link should be rejected, got %s", resp.Status)
+	}
+
+	resp, err = http.Post(server.URL+decidePath, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the decision to be recorded, got %s", resp.Status)
+	}
+	requests, _ = store.Requests()
+	if r := requests["111/volume/us-west-2/vol-1"]; r.Status != StatusDeclined || r.DecidedBy != "boss" {
+		t.Errorf("Expected the deletion to be declined by boss, got %+v", r)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package approval keeps track of deletions that need the approval of the
+// manager of an account's owner. Requests are kept in a local JSON file,
+// which is shared by cleanup runs, that request approval and act on the
+// decisions, and the server that records the decisions managers make by
+// following the links in the approval emails.
+package approval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The status of a request
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusDeclined = "declined"
+)
+
+// The decisions a manager can make on a request
+const (
+	DecisionApprove = "approve"
+	DecisionDecline = "decline"
+)
+
+// Request is a deletion that needs approval, and the decision made on it
+type Request struct {
+	Account     string    `json:"account"`
+	Kind        string    `json:"kind"`
+	ID          string    `json:"id"`
+	Location    string    `json:"location,omitempty"`
+	Reason      string    `json:"reason"`
+	MonthlyCost float64   `json:"monthly_cost"`
+	Requested   time.Time `json:"requested"`
+	// Notified is when the manager was last emailed about the request
+	Notified  time.Time `json:"notified"`
+	Status    string    `json:"status"`
+	DecidedBy string    `json:"decided_by,omitempty"`
+	Decided   time.Time `json:"decided"`
+}
+
+// Key identifies the request for deleting a resource. The location is
+// part of the key, since GCP disks and instances are only unique within
+// a zone.
+func Key(account, kind, location, id string) string {
+	return strings.Join([]string{account, kind, location, id}, "/")
+}
+
+// Key identifies the request
+func (r *Request) Key() string {
+	return Key(r.Account, r.Kind, r.Location, r.ID)
+}
+
+// Store keeps requests in a JSON file. Every change reads the file, makes
+// the change and writes the file back, so that a cleanup run and the
+// server can share the file. Changes hold a lock on a lock file next to
+// it, so that changes made by the other process at the same time aren't
+// lost.
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewStore returns a store keeping requests in the specified file. The
+// file is created once the first request is added.
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Requests returns all requests in the store, by key
+func (s *Store) Requests() (map[string]*Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read()
+}
+
+// Request adds the requests that are not already in the store, and
+// returns all requests in the store for the same deletions, by key
+func (s *Store) Request(needed []*Request) (map[string]*Request, error) {
+	result := make(map[string]*Request)
+	err := s.update(func(requests map[string]*Request) error {
+		for _, r := range needed {
+			if _, exist := requests[r.Key()]; !exist {
+				r.Status = StatusPending
+				requests[r.Key()] = r
+			}
+			result[r.Key()] = requests[r.Key()]
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Prune removes the requests in the specified accounts that are no
+// longer needed, e.g. because the resource has been deleted or no longer
+// expires. Only the keys of the requests to keep are needed. The requests
+// of other accounts are left as they are.
+func (s *Store) Prune(accounts []string, keep []string) error {
+	return s.update(func(requests map[string]*Request) error {
+		checked := make(map[string]bool)
+		for _, account := range accounts {
+			checked[account] = true
+		}
+		kept := make(map[string]bool)
+		for _, key := range keep {
+			kept[key] = true
+		}
+		for key, r := range requests {
+			if checked[r.Account] && !kept[key] {
+				delete(requests, key)
+			}
+		}
+		return nil
+	})
+}
+
+// Decide records a manager's decision on a request
+func (s *Store) Decide(key, decision, by string) (*Request, error) {
+	var decided *Request
+	err := s.update(func(requests map[string]*Request) error {
+		r, exist := requests[key]
+		if !exist {
+			return fmt.Errorf("No deletion of %s awaits approval", key)
+		}
+		switch decision {
+		case DecisionApprove:
+			r.Status = StatusApproved
+		case DecisionDecline:
+			r.Status = StatusDeclined
+		default:
+			return fmt.Errorf("Invalid decision \"%s\"", decision)
+		}
+		r.DecidedBy = by
+		r.Decided = time.Now()
+		decided = r
+		return nil
+	})
+	return decided, err
+}
+
+// MarkNotified records that the manager was emailed about the requests
+func (s *Store) MarkNotified(keys ...string) error {
+	return s.update(func(requests map[string]*Request) error {
+		for _, key := range keys {
+			if r, exist := requests[key]; exist {
+				r.Notified = time.Now()
+			}
+		}
+		return nil
+	})
+}
+
+// Pending returns the pending requests, sorted by key
+func Pending(requests map[string]*Request) []*Request {
+	pending := []*Request{}
+	for _, r := range requests {
+		if r.Status == StatusPending {
+			pending = append(pending, r)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Key() < pending[j].Key()
+	})
+	return pending
+}
+
+func (s *Store) update(change func(map[string]*Request) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	requests, err := s.read()
+	if err != nil {
+		return err
+	}
+	if err = change(requests); err != nil {
+		return err
+	}
+	return s.write(requests)
+}
+
+// lock takes an exclusive lock shared with other processes. The file
+// itself can't be locked, since every write replaces it.
+func (s *Store) lock() (func(), error) {
+	f, err := os.OpenFile(s.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Could not lock approvals: %s", err)
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Could not lock approvals: %s", err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+func (s *Store) read() (map[string]*Request, error) {
+	requests := make(map[string]*Request)
+	raw, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return requests, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read approvals: %s", err)
+	}
+	list := []*Request{}
+	if err = json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("Could not parse approvals: %s", err)
+	}
+	for _, r := range list {
+		requests[r.Key()] = r
+	}
+	return requests, nil
+}
+
+// write replaces the file, so that readers never see a partial file
+func (s *Store) write(requests map[string]*Request) error {
+	list := []*Request{}
+	for _, r := range requests {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key() < list[j].Key()
+	})
+	raw, err := json.MarshalIndent(list, "", "    ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".")
+	if err != nil {
+		return fmt.Errorf("Could not write approvals: %s", err)
+	}
+	if _, err = tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Could not write approvals: %s", err)
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Could not write approvals: %s", err)
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package approval
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func tempStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "approval")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewStore(filepath.Join(dir, "approvals.json")), func() { os.RemoveAll(dir) }
+}
+
+func TestStore(t *testing.T) {
+	store, cleanup := tempStore(t)
+	defer cleanup()
+
+	needed := []*Request{
+		{Account: "111", Kind: "volume", Location: "us-west-2", ID: "vol-1", MonthlyCost: 600},
+		{Account: "111", Kind: "image", Location: "us-west-2", ID: "ami-1", MonthlyCost: 50},
+		{Account: "222", Kind: "volume", Location: "us-west-2", ID: "vol-2", MonthlyCost: 900},
+	}
+	requests, err := store.Request(needed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 3 || len(Pending(requests)) != 3 {
+		t.Fatalf("Expected 3 pending requests, got %v", requests)
+	}
+
+	if _, err = store.Decide("111/volume/us-west-2/vol-1", DecisionApprove, "boss"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Decide("111/volume/us-west-2/vol-9", DecisionApprove, "boss"); err == nil {
+		t.Error("Deciding on an unknown request should fail")
+	}
+	// Requesting again keeps the decision
+	requests, err = store.Request(needed[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := requests["111/volume/us-west-2/vol-1"]; r.Status != StatusApproved || r.DecidedBy != "boss" {
+		t.Errorf("The decision should be kept, got %+v", r)
+	}
+
+	if err = store.Prune([]string{"111"}, []string{"111/volume/us-west-2/vol-1"}); err != nil {
+		t.Fatal(err)
+	}
+	requests, err = store.Requests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exist := requests["111/image/us-west-2/ami-1"]; exist || len(requests) != 2 {
+		t.Errorf("Only requests no longer needed in the checked accounts should be pruned, got %v", requests)
+	}
+}
+
+func TestStoreSharedFile(t *testing.T) {
+	store, cleanup := tempStore(t)
+	defer cleanup()
+	// Another process, such as the server, using the same file
+	other := NewStore(store.path)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		for _, s := range []*Store{store, other} {
+			wg.Add(1)
+			go func(s *Store, id string) {
+				defer wg.Done()
+				if _, err := s.Request([]*Request{{Account: "111", Kind: "volume", ID: id}}); err != nil {
+					t.Error(err)
+				}
+			}(s, fmt.Sprintf("vol-%p-%d", s, i))
+		}
+	}
+	wg.Wait()
+	requests, err := store.Requests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 40 {
+		t.Errorf("Expected 40 requests, got %d", len(requests))
+	}
+}
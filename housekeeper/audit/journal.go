@@ -0,0 +1,205 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package audit keeps an append-only journal of every change housekeeper
+// makes to resources, so it's possible to find out afterwards what was
+// deleted, when, by whom and why. The journal is a JSON lines file, where
+// every line is an Entry.
+package audit
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The actions recorded in the journal
+const (
+	ActionTag         = "tag"
+	ActionUntag       = "untag"
+	ActionMakePrivate = "make-private"
+	ActionDeprecate   = "deprecate"
+	ActionDelete      = "delete"
+)
+
+// Entry is a single change to a resource
+type Entry struct {
+	Time         time.Time         `json:"time"`
+	Actor        string            `json:"actor"`
+	Command      string            `json:"command"`
+	Action       string            `json:"action"`
+	CSP          cloud.CSP         `json:"csp"`
+	Account      string            `json:"account"`
+	Kind         string            `json:"kind"`
+	ResourceID   string            `json:"resource_id"`
+	Location     string            `json:"location,omitempty"`
+	CreationTime time.Time         `json:"creation_time"`
+	Public       bool              `json:"public,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	// TagKey and TagValue are set for tag and untag actions
+	TagKey   string `json:"tag_key,omitempty"`
+	TagValue string `json:"tag_value,omitempty"`
+	// The cost of the resource so far, and per month, in USD
+	AccumulatedCost float64 `json:"accumulated_cost"`
+	MonthlyCost     float64 `json:"monthly_cost"`
+	Reason          string  `json:"reason,omitempty"`
+	// Error is set if the action failed
+	Error string `json:"error,omitempty"`
+}
+
+func (e *Entry) String() string {
+	s := fmt.Sprintf("%s  %-12s %s %s %s (%s)", e.Time.Format(time.RFC3339), e.Action, e.Account, e.Kind, e.ResourceID, e.Actor)
+	if e.TagKey != "" {
+		s += fmt.Sprintf(" %s=%s", e.TagKey, e.TagValue)
+	}
+	if e.Reason != "" {
+		s += fmt.Sprintf(" reason: %s", e.Reason)
+	}
+	if e.Error != "" {
+		s += fmt.Sprintf(" FAILED: %s", e.Error)
+	}
+	return s
+}
+
+// Journal appends entries to a journal file. The file is only created
+// once the first entry is recorded. All entries recorded by the same
+// journal are kept, so they can be uploaded when the command is done.
+type Journal struct {
+	path    string
+	actor   string
+	command string
+	started time.Time
+	file    *os.File
+	mu      sync.Mutex
+	entries []*Entry
+}
+
+// New returns a journal appending to the specified file. The actor and
+// command are recorded in every entry.
+func New(filePath, actor, command string) *Journal {
+	return &Journal{
+		path:    filePath,
+		actor:   actor,
+		command: command,
+		started: time.Now(),
+	}
+}
+
+// Record appends an entry to the journal, setting its time, actor and
+// command. The journal must never stop housekeeper from working, so a
+// failure to write is only logged.
+func (j *Journal) Record(e *Entry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e.Time = time.Now()
+	e.Actor = j.actor
+	e.Command = j.command
+	j.entries = append(j.entries, e)
+	raw, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Could not encode audit entry for %s: %s\n", e.ResourceID, err)
+		return
+	}
+	if j.file == nil {
+		j.file, err = os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Printf("Could not open audit journal: %s\n", err)
+			return
+		}
+	}
+	if _, err = j.file.Write(append(raw, '\n')); err != nil {
+		log.Printf("Could not write audit entry for %s: %s\n", e.ResourceID, err)
+	}
+}
+
+// Upload uploads the entries recorded by this journal to S3 or GCS, as a
+// new object under the specified prefix, e.g. s3://bucket/audit. Every
+// run is uploaded as its own object, so uploaded entries are never
+// overwritten. Nothing is uploaded if no entries were recorded.
+func (j *Journal) Upload(prefix string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.entries) == 0 {
+		return nil
+	}
+	b := new(bytes.Buffer)
+	encoder := json.NewEncoder(b)
+	for _, e := range j.entries {
+		if err := encoder.Encode(e); err != nil {
+			return err
+		}
+	}
+	name := fmt.Sprintf("%s-%s.jsonl", j.started.UTC().Format("20060102T150405Z"), j.command)
+	return cloud.UploadObject(strings.TrimSuffix(prefix, "/")+"/"+name, b.Bytes())
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	return j.file.Close()
+}
+
+// Query selects entries in a journal. Empty fields match everything.
+type Query struct {
+	Account    string
+	ResourceID string
+	Since      time.Time
+	Until      time.Time
+}
+
+// Matches checks if an entry is selected by the query
+func (q Query) Matches(e *Entry) bool {
+	if q.Account != "" && e.Account != q.Account {
+		return false
+	}
+	if q.ResourceID != "" && e.ResourceID != q.ResourceID {
+		return false
+	}
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !e.Time.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// Search reads a journal file and returns the entries matching the query,
+// in the order they were recorded
+func Search(filePath string, q Query) ([]*Entry, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open audit journal: %s", err)
+	}
+	defer f.Close()
+	result := []*Entry{}
+	scanner := bufio.NewScanner(f)
+	// Tags can make entries longer than the default limit
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		e := new(Entry)
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("Invalid audit entry on line %d: %s", line, err)
+		}
+		if q.Matches(e) {
+			result = append(result, e)
+		}
+	}
+	return result, scanner.Err()
+}
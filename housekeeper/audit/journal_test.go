@@ -0,0 +1,141 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package audit
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testVolume struct {
+	id      string
+	owner   string
+	tags    map[string]string
+	failing bool
+}
+
+func (v *testVolume) CSP() cloud.CSP          { return cloud.AWS }
+func (v *testVolume) Owner() string           { return v.owner }
+func (v *testVolume) ID() string              { return v.id }
+func (v *testVolume) Tags() map[string]string { return v.tags }
+func (v *testVolume) Location() string        { return "us-west-2" }
+func (v *testVolume) Public() bool            { return false }
+func (v *testVolume) CreationTime() time.Time { return time.Now().AddDate(0, 0, -30) }
+func (v *testVolume) SizeGB() int64           { return 100 }
+func (v *testVolume) Attached() bool          { return false }
+func (v *testVolume) Encrypted() bool         { return true }
+func (v *testVolume) VolumeType() string      { return "gp2" }
+
+func (v *testVolume) SetTag(key, value string, overwrite bool) error {
+	v.tags[key] = value
+	return nil
+}
+
+func (v *testVolume) RemoveTag(key string) error {
+	delete(v.tags, key)
+	return nil
+}
+
+func (v *testVolume) Cleanup() error {
+	if v.failing {
+		return errors.New("volume is in use")
+	}
+	return nil
+}
+
+// unpricedVolume is a volume of a type there is no price for
+type unpricedVolume struct {
+	testVolume
+}
+
+func (v *unpricedVolume) VolumeType() string { return "gp3" }
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	journalFile := filepath.Join(dir, "audit.jsonl")
+	j := New(journalFile, "alice", "cleanup")
+
+	first := &volume{&testVolume{"vol-1", "111", map[string]string{}, false}, j}
+	second := &volume{&testVolume{"vol-2", "222", map[string]string{filter.DeleteReasonTagKey: "unattached"}, true}, j}
+	if err := first.SetTag("env", "ci", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.RemoveTag("env"); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Cleanup(); err == nil {
+		t.Error("The error of a failed action should be returned")
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := Search(journalFile, Query{})
+	if err != nil {
+		t.Fatalf("Could not search journal: %s", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(all))
+	}
+	untag := all[1]
+	if untag.Action != ActionUntag || untag.TagKey != "env" || untag.TagValue != "ci" || untag.Actor != "alice" || untag.Command != "cleanup" {
+		t.Errorf("Untag entry is wrong: %+v", untag)
+	}
+	deleted := all[2]
+	if deleted.Action != ActionDelete || deleted.Kind != "volume" || deleted.Reason != "unattached" || deleted.Error == "" {
+		t.Errorf("Delete entry is wrong: %+v", deleted)
+	}
+	if deleted.MonthlyCost <= 0 || deleted.Tags[filter.DeleteReasonTagKey] != "unattached" {
+		t.Errorf("Delete entry should describe the resource: %+v", deleted)
+	}
+
+	byAccount, _ := Search(journalFile, Query{Account: "111"})
+	if len(byAccount) != 2 {
+		t.Errorf("Expected 2 entries for account 111, got %d", len(byAccount))
+	}
+	byID, _ := Search(journalFile, Query{ResourceID: "vol-2"})
+	if len(byID) != 1 {
+		t.Errorf("Expected 1 entry for vol-2, got %d", len(byID))
+	}
+	future, _ := Search(journalFile, Query{Since: time.Now().Add(time.Hour)})
+	past, _ := Search(journalFile, Query{Until: time.Now().Add(-time.Hour)})
+	if len(future) != 0 || len(past) != 0 {
+		t.Error("Entries outside of the date range should not be included")
+	}
+}
+
+func TestUnknownPrice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	journalFile := filepath.Join(dir, "audit.jsonl")
+	j := New(journalFile, "alice", "cleanup")
+
+	v := &volume{&unpricedVolume{testVolume{"vol-1", "111", map[string]string{}, false}}, j}
+	if err := v.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	all, err := Search(journalFile, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Action != ActionDelete || all[0].MonthlyCost != 0 {
+		t.Errorf("Resources without a price should be recorded without a cost, got %+v", all)
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package audit
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/billing"
+	"brkt/cloudsweeper/cloud/filter"
+	"brkt/cloudsweeper/housekeeper/policy"
+	"strings"
+)
+
+// journal is the journal resource managers are wrapped with
+var journal *Journal
+
+// SetJournal sets the journal used by Wrap
+func SetJournal(j *Journal) {
+	journal = j
+}
+
+// Wrap returns a resource manager that records every tag, untag,
+// make-private, deprecate and delete action on its resources in the journal set with
+// SetJournal. If no journal is set, the manager is returned as is.
+func Wrap(mngr cloud.ResourceManager) cloud.ResourceManager {
+	if journal == nil {
+		return mngr
+	}
+	return &manager{ResourceManager: mngr, journal: journal}
+}
+
+type manager struct {
+	cloud.ResourceManager
+	journal *Journal
+}
+
+func (m *manager) BucketsPerAccount() map[string][]cloud.Bucket {
+	result := m.ResourceManager.BucketsPerAccount()
+	for owner, buckets := range result {
+		result[owner] = m.buckets(buckets)
+	}
+	return result
+}
+
+func (m *manager) InstancesPerAccount() map[string][]cloud.Instance {
+	result := m.ResourceManager.InstancesPerAccount()
+	for owner, instances := range result {
+		result[owner] = m.instances(instances)
+	}
+	return result
+}
+
+func (m *manager) ImagesPerAccount() map[string][]cloud.Image {
+	result := m.ResourceManager.ImagesPerAccount()
+	for owner, images := range result {
+		result[owner] = m.images(images)
+	}
+	return result
+}
+
+func (m *manager) VolumesPerAccount() map[string][]cloud.Volume {
+	result := m.ResourceManager.VolumesPerAccount()
+	for owner, volumes := range result {
+		result[owner] = m.volumes(volumes)
+	}
+	return result
+}
+
+func (m *manager) SnapshotsPerAccount() map[string][]cloud.Snapshot {
+	result := m.ResourceManager.SnapshotsPerAccount()
+	for owner, snapshots := range result {
+		result[owner] = m.snapshots(snapshots)
+	}
+	return result
+}
+
+func (m *manager) AllResourcesPerAccount() map[string]*cloud.ResourceCollection {
+	result := m.ResourceManager.AllResourcesPerAccount()
+	for _, res := range result {
+		res.Instances = m.instances(res.Instances)
+		res.Images = m.images(res.Images)
+		res.Volumes = m.volumes(res.Volumes)
+		res.Snapshots = m.snapshots(res.Snapshots)
+	}
+	return result
+}
+
+func (m *manager) instances(instances []cloud.Instance) []cloud.Instance {
+	result := make([]cloud.Instance, len(instances))
+	for i := range instances {
+		result[i] = &instance{instances[i], m.journal}
+	}
+	return result
+}
+
+func (m *manager) images(images []cloud.Image) []cloud.Image {
+	result := make([]cloud.Image, len(images))
+	for i := range images {
+		result[i] = &image{images[i], m.journal}
+	}
+	return result
+}
+
+func (m *manager) volumes(volumes []cloud.Volume) []cloud.Volume {
+	result := make([]cloud.Volume, len(volumes))
+	for i := range volumes {
+		result[i] = &volume{volumes[i], m.journal}
+	}
+	return result
+}
+
+func (m *manager) snapshots(snapshots []cloud.Snapshot) []cloud.Snapshot {
+	result := make([]cloud.Snapshot, len(snapshots))
+	for i := range snapshots {
+		result[i] = &snapshot{snapshots[i], m.journal}
+	}
+	return result
+}
+
+func (m *manager) buckets(buckets []cloud.Bucket) []cloud.Bucket {
+	result := make([]cloud.Bucket, len(buckets))
+	for i := range buckets {
+		result[i] = &bucket{buckets[i], m.journal}
+	}
+	return result
+}
+
+type instance struct {
+	cloud.Instance
+	journal *Journal
+}
+
+func (i *instance) SetTag(key, value string, overwrite bool) error {
+	return setTag(i.journal, i, i.Instance.SetTag, key, value, overwrite)
+}
+
+func (i *instance) RemoveTag(key string) error {
+	return removeTag(i.journal, i, i.Instance.RemoveTag, key)
+}
+
+func (i *instance) Cleanup() error {
+	return cleanup(i.journal, i, i.Instance.Cleanup)
+}
+
+type image struct {
+	cloud.Image
+	journal *Journal
+}
+
+func (i *image) SetTag(key, value string, overwrite bool) error {
+	return setTag(i.journal, i, i.Image.SetTag, key, value, overwrite)
+}
+
+func (i *image) RemoveTag(key string) error {
+	return removeTag(i.journal, i, i.Image.RemoveTag, key)
+}
+
+func (i *image) Cleanup() error {
+	return cleanup(i.journal, i, i.Image.Cleanup)
+}
+
+func (i *image) MakePrivate() error {
+	return makePrivate(i.journal, i, i.Image.MakePrivate)
+}
+
+func (i *image) Deprecate(state string) error {
+	e := newEntry(ActionDeprecate, i)
+	e.Reason = "active"
+	if state != cloud.ImageStateActive {
+		e.Reason = strings.ToLower(state)
+	}
+	return i.journal.recordResult(e, i.Image.Deprecate(state))
+}
+
+type volume struct {
+	cloud.Volume
+	journal *Journal
+}
+
+func (v *volume) SetTag(key, value string, overwrite bool) error {
+	return setTag(v.journal, v, v.Volume.SetTag, key, value, overwrite)
+}
+
+func (v *volume) RemoveTag(key string) error {
+	return removeTag(v.journal, v, v.Volume.RemoveTag, key)
+}
+
+func (v *volume) Cleanup() error {
+	return cleanup(v.journal, v, v.Volume.Cleanup)
+}
+
+type snapshot struct {
+	cloud.Snapshot
+	journal *Journal
+}
+
+func (s *snapshot) SetTag(key, value string, overwrite bool) error {
+	return setTag(s.journal, s, s.Snapshot.SetTag, key, value, overwrite)
+}
+
+func (s *snapshot) RemoveTag(key string) error {
+	return removeTag(s.journal, s, s.Snapshot.RemoveTag, key)
+}
+
+func (s *snapshot) Cleanup() error {
+	return cleanup(s.journal, s, s.Snapshot.Cleanup)
+}
+
+func (s *snapshot) MakePrivate() error {
+	return makePrivate(s.journal, s, s.Snapshot.MakePrivate)
+}
+
+type bucket struct {
+	cloud.Bucket
+	journal *Journal
+}
+
+func (b *bucket) SetTag(key, value string, overwrite bool) error {
+	return setTag(b.journal, b, b.Bucket.SetTag, key, value, overwrite)
+}
+
+func (b *bucket) RemoveTag(key string) error {
+	return removeTag(b.journal, b, b.Bucket.RemoveTag, key)
+}
+
+func (b *bucket) Cleanup() error {
+	return cleanup(b.journal, b, b.Bucket.Cleanup)
+}
+
+func (b *bucket) MakePrivate() error {
+	return makePrivate(b.journal, b, b.Bucket.MakePrivate)
+}
+
+func setTag(j *Journal, r cloud.Resource, set func(string, string, bool) error, key, value string, overwrite bool) error {
+	e := newEntry(ActionTag, r)
+	e.TagKey, e.TagValue = key, value
+	if key == filter.DeleteTagKey {
+		e.Reason = "marked for deletion"
+	}
+	return j.recordResult(e, set(key, value, overwrite))
+}
+
+func removeTag(j *Journal, r cloud.Resource, remove func(string) error, key string) error {
+	e := newEntry(ActionUntag, r)
+	e.TagKey = key
+	e.TagValue = e.Tags[key]
+	return j.recordResult(e, remove(key))
+}
+
+func makePrivate(j *Journal, r cloud.Resource, private func() error) error {
+	e := newEntry(ActionMakePrivate, r)
+	e.Reason = "public"
+	return j.recordResult(e, private())
+}
+
+func cleanup(j *Journal, r cloud.Resource, del func() error) error {
+	e := newEntry(ActionDelete, r)
+	e.Reason = deleteReason(r)
+	return j.recordResult(e, del())
+}
+
+// newEntry describes a resource before the action is taken on it
+func newEntry(action string, r cloud.Resource) *Entry {
+	tags := make(map[string]string, len(r.Tags()))
+	for key, value := range r.Tags() {
+		tags[key] = value
+	}
+	// An unknown price must not stop housekeeper, so the cost is left
+	// out of the entry instead
+	perDay, accumulated, _ := billing.LookupCost(r)
+	return &Entry{
+		Action:          action,
+		CSP:             r.CSP(),
+		Account:         r.Owner(),
+		Kind:            policy.KindOf(r),
+		ResourceID:      r.ID(),
+		Location:        r.Location(),
+		CreationTime:    r.CreationTime(),
+		Public:          r.Public(),
+		Tags:            tags,
+		AccumulatedCost: accumulated,
+		MonthlyCost:     perDay * 30.0,
+	}
+}
+
+func (j *Journal) recordResult(e *Entry, err error) error {
+	if err != nil {
+		e.Error = err.Error()
+	}
+	j.Record(e)
+	return err
+}
+
+// deleteReason works out why a resource is deleted from its tags. The
+// reason saved when it was marked for deletion is preferred.
+func deleteReason(r cloud.Resource) string {
+	if reason, exist := filter.TagValue(r, filter.DeleteReasonTagKey); exist {
+		return reason
+	}
+	switch {
+	case filter.LifetimeExceeded()(r):
+		return "lifetime exceeded"
+	case filter.ExpiryDatePassed()(r):
+		return "expiry passed"
+	case filter.DeleteAtPassed()(r):
+		return "delete-at passed"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/housekeeper/approval"
+	"brkt/cloudsweeper/housekeeper/policy"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// approvals is where deletions that need approval are requested
+var approvals *approval.Store
+
+// SetApprovalStore sets the store where deletions that need the approval
+// of a manager are requested, and their decisions are looked up
+func SetApprovalStore(s *approval.Store) {
+	approvals = s
+}
+
+// requireApproval holds back the planned deletions that need approval,
+// until the manager of the account's owner has approved them. Approval is
+// requested for every such deletion that hasn't been requested already.
+// Deletions that need approval are held back if no store is set.
+func requireApproval(a *policy.Approval, changes map[string][]*PlannedChange) (map[string][]*PlannedChange, []heldBack) {
+	needed := approvalsNeeded(a, changes)
+	if len(needed) == 0 {
+		return changes, nil
+	}
+	var requests map[string]*approval.Request
+	if approvals == nil {
+		log.Println("No approval store is set, deletions that need approval are held back")
+	} else {
+		var err error
+		if requests, err = approvals.Request(needed); err != nil {
+			log.Printf("Could not request approval, deletions that need approval are held back: %s\n", err)
+			requests = nil
+		}
+	}
+
+	needsApproval := make(map[string]bool)
+	for _, r := range needed {
+		needsApproval[r.Key()] = true
+	}
+	owners := []string{}
+	for owner := range changes {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+	allowed := make(map[string][]*PlannedChange)
+	held := []heldBack{}
+	for _, owner := range owners {
+		for _, c := range changes[owner] {
+			key := approval.Key(c.Account, c.Kind, c.Location, c.ID)
+			if !needsApproval[key] {
+				allowed[owner] = append(allowed[owner], c)
+				continue
+			}
+			request, exist := requests[key]
+			switch {
+			case !exist:
+				held = append(held, heldBack{c, "approval could not be requested"})
+			case request.Status == approval.StatusApproved:
+				log.Printf("%s: Deletion of %s was approved by %s\n", owner, c.ID, request.DecidedBy)
+				allowed[owner] = append(allowed[owner], c)
+			case request.Status == approval.StatusDeclined:
+				held = append(held, heldBack{c, fmt.Sprintf("declined by %s", request.DecidedBy)})
+			default:
+				held = append(held, heldBack{c, fmt.Sprintf("awaiting approval since %s", request.Requested.Format("2006-01-02"))})
+			}
+		}
+	}
+	return allowed, held
+}
+
+// approvalsNeeded returns a request for every planned deletion that
+// needs approval
+func approvalsNeeded(a *policy.Approval, changes map[string][]*PlannedChange) []*approval.Request {
+	needed := []*approval.Request{}
+	if a == nil {
+		return needed
+	}
+	for _, ownerChanges := range changes {
+		for _, c := range ownerChanges {
+			if c.Action == ActionDelete && a.Requires(c.resource, c.EstimatedSavings) {
+				needed = append(needed, approvalRequest(c))
+			}
+		}
+	}
+	return needed
+}
+
+// pruneApprovals removes the requests that are no longer needed from the
+// store, once every deletion in the accounts has been planned. Decisions
+// are kept for as long as the resource would otherwise be deleted.
+func pruneApprovals(a *policy.Approval, changes map[string][]*PlannedChange) {
+	if a == nil || approvals == nil {
+		return
+	}
+	accounts := []string{}
+	for owner := range changes {
+		accounts = append(accounts, owner)
+	}
+	keep := []string{}
+	for _, r := range approvalsNeeded(a, changes) {
+		keep = append(keep, r.Key())
+	}
+	if err := approvals.Prune(accounts, keep); err != nil {
+		log.Printf("Could not remove approvals that are no longer needed: %s\n", err)
+	}
+}
+
+func approvalRequest(c *PlannedChange) *approval.Request {
+	return &approval.Request{
+		Account:     c.Account,
+		Kind:        c.Kind,
+		ID:          c.ID,
+		Location:    c.Location,
+		Reason:      c.Reason,
+		MonthlyCost: c.EstimatedSavings,
+		Requested:   time.Now(),
+	}
+}
+
+// logAwaitingApproval summarizes the deletions held back because they
+// need approval
+func logAwaitingApproval(held []heldBack) {
+	if len(held) == 0 {
+		return
+	}
+	log.Printf("Held back %d deletions that need the approval of a manager:\n", len(held))
+	for _, h := range held {
+		log.Printf("  %s: %s %s (%s), %s\n", h.change.Account, h.change.Kind, h.change.ID, h.change.Reason, h.reason)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/housekeeper/approval"
+	"brkt/cloudsweeper/housekeeper/policy"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRequireApproval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "approval")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := approval.NewStore(filepath.Join(dir, "approvals.json"))
+	SetApprovalStore(store)
+	defer SetApprovalStore(nil)
+
+	expensive := newChange("111", &testVolume{"vol-1", "111", map[string]string{}}, ActionDelete, "delete-at passed")
+	expensive.EstimatedSavings = 600
+	cheap := newChange("111", &testVolume{"vol-2", "111", map[string]string{}}, ActionDelete, "delete-at passed")
+	cheap.EstimatedSavings = 5
+	changes := map[string][]*PlannedChange{"111": {expensive, cheap}}
+	a := &policy.Approval{MinMonthlyCost: 500}
+
+	allowed, held := requireApproval(a, changes)
+	if len(allowed["111"]) != 1 || allowed["111"][0].ID != "vol-2" || len(held) != 1 {
+		t.Fatalf("Only the expensive deletion should be held back, got %v and %v", allowed, held)
+	}
+	if allowed, _ := requireApproval(nil, changes); len(allowed["111"]) != 2 {
+		t.Error("Nothing should be held back without approval thresholds")
+	}
+
+	if _, err = store.Decide("111/volume/us-west-2/vol-1", approval.DecisionApprove, "boss"); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, held = requireApproval(a, changes); len(allowed["111"]) != 2 || len(held) != 0 {
+		t.Errorf("Approved deletions should be allowed, got %v and %v", allowed, held)
+	}
+
+	// Requests for deletions that are no longer planned are removed
+	pruneApprovals(a, map[string][]*PlannedChange{"111": {cheap}})
+	if requests, _ := store.Requests(); len(requests) != 0 {
+		t.Errorf("Expected no requests, got %v", requests)
+	}
+
+	// Disks with the same name in different zones are approved separately
+	zoneA := newChange("111", &zonedVolume{testVolume{"disk-1", "111", map[string]string{}}, "us-central1-a"}, ActionDelete, "delete-at passed")
+	zoneB := newChange("111", &zonedVolume{testVolume{"disk-1", "111", map[string]string{}}, "us-central1-b"}, ActionDelete, "delete-at passed")
+	zoneA.EstimatedSavings, zoneB.EstimatedSavings = 600, 600
+	disks := map[string][]*PlannedChange{"111": {zoneA, zoneB}}
+	requireApproval(a, disks)
+	if _, err = store.Decide("111/volume/us-central1-a/disk-1", approval.DecisionApprove, "boss"); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, held = requireApproval(a, disks); len(allowed["111"]) != 1 || allowed["111"][0] != zoneA || len(held) != 1 {
+		t.Errorf("Only the approved disk should be allowed, got %v and %v", allowed, held)
+	}
+}
@@ -5,279 +5,278 @@ package cleanup
 
 import (
 	"brkt/cloudsweeper/cloud"
-	"brkt/cloudsweeper/cloud/billing"
 	"brkt/cloudsweeper/cloud/filter"
+	"brkt/cloudsweeper/housekeeper/freeze"
+	"brkt/cloudsweeper/housekeeper/policy"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 )
 
 const (
-	releaseTag          = "Release"
-	sharedDevAWSAccount = "164337164081"
-	totalCostThreshold  = 10.0
+	// The maximum length of an AWS tag value
+	maxReasonLength = 255
+	// The number of days resources are kept after they're marked for
+	// deletion, when neither the policy nor a flag sets the grace period
+	defaultGracePeriodDays = 4
 )
 
 // MarkForCleanup will look for resources that should be automatically
-// cleaned up. These resources are not deleted directly, but are given
-// a tag that will delete the resources 4 days from now. The rules
-// for marking a resource for cleanup are the following:
-// 		- unattached volumes > 30 days old
-//		- unused/unaccessed buckets > 120 days old
-// 		- non-whitelisted AMIs > 6 months
-// 		- non-whitelisted snapshots > 6 months
-// 		- non-whitelisted volumes > 6 months
-//		- untagged resources > 30 days (this should take care of instances)
-func MarkForCleanup(mngr cloud.ResourceManager) {
+// cleaned up, using the rules of the specified policy. Resources are not
+// deleted directly, but resources matching a delete rule are given a tag
+// that will delete them once the grace period of the rule has passed. If
+// several delete rules match a resource, the shortest grace period is
+// used. See policy.Default for the rules used when no policy file is
+// specified. The policy is resolved for every account, using the
+// accounts' departments and environments. Resources already marked to be
+// deleted within a change freeze are postponed until it's over.
+func MarkForCleanup(mngr cloud.ResourceManager, pol *policy.Policy, accounts map[string]policy.Account) {
 	allResources := mngr.AllResourcesPerAccount()
 	allBuckets := mngr.BucketsPerAccount()
 
 	for owner, res := range allResources {
 		log.Println("Marking resources for cleanup in", owner)
-		untaggedFilter := filter.New()
-		untaggedFilter.AddGeneralRule(func(r cloud.Resource) bool {
-			return len(r.Tags()) == 0
-		})
-		untaggedFilter.AddGeneralRule(filter.OlderThanXDays(30))
-		untaggedFilter.AddSnapshotRule(filter.IsNotInUse())
-		untaggedFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
-
-		oldFilter := filter.New()
-		oldFilter.AddGeneralRule(filter.OlderThanXMonths(6))
-		// Don't cleanup resources tagged for release
-		oldFilter.AddGeneralRule(filter.Negate(filter.HasTag(releaseTag)))
-		oldFilter.AddSnapshotRule(filter.IsNotInUse())
-		oldFilter.AddVolumeRule(filter.IsUnattached())
-		oldFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
-
-		unattachedFilter := filter.New()
-		unattachedFilter.AddVolumeRule(filter.IsUnattached())
-		unattachedFilter.AddGeneralRule(filter.OlderThanXDays(30))
-		unattachedFilter.AddGeneralRule(filter.Negate(filter.HasTag(releaseTag)))
-		unattachedFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
-
-		bucketFilter := filter.New()
-		bucketFilter.AddBucketRule(filter.NotModifiedInXDays(120))
-		bucketFilter.AddGeneralRule(filter.OlderThanXDays(7))
-		bucketFilter.AddGeneralRule(filter.Negate(filter.HasTag(releaseTag)))
-		bucketFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
-
-		timeToDelete := time.Now().AddDate(0, 0, 4)
+		accountPolicy := resolvePolicy(pol, accounts, owner)
+		applyChanges(mngr, owner, planMarks(owner, res, allBuckets[owner], accountPolicy))
+		postponeFrozenDeletions(owner, allOf(res, allBuckets[owner]))
+	}
+}
 
-		resourcesToTag := []cloud.Resource{}
-		totalCost := 0.0
+// resolvePolicy returns the policy to use for an account. Accounts that
+// are not known are only matched by their ID.
+func resolvePolicy(pol *policy.Policy, accounts map[string]policy.Account, owner string) *policy.Policy {
+	account, ok := accounts[owner]
+	if !ok {
+		account = policy.Account{ID: owner}
+	}
+	return pol.For(account)
+}
 
-		// Tag instances
-		for _, res := range filter.Instances(res.Instances, untaggedFilter) {
-			resourcesToTag = append(resourcesToTag, res)
-			days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-			costPerDay := billing.ResourceCostPerDay(res)
-			totalCost += days * costPerDay
+// matchingResources returns all resources of the kinds a policy rule
+// applies to, that also match the rule's filter. The evaluation trace
+// of every matching resource is returned as well.
+func matchingResources(rule *policy.Rule, res *cloud.ResourceCollection, buckets []cloud.Bucket) ([]cloud.Resource, map[cloud.Resource]*filter.Trace) {
+	candidates := []cloud.Resource{}
+	if rule.AppliesTo(policy.KindInstance) {
+		for _, r := range res.Instances {
+			candidates = append(candidates, r)
 		}
-
-		// Tag volumes
-		for _, res := range filter.Volumes(res.Volumes, oldFilter, unattachedFilter) {
-			resourcesToTag = append(resourcesToTag, res)
-			days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-			costPerDay := billing.ResourceCostPerDay(res)
-			totalCost += days * costPerDay
+	}
+	if rule.AppliesTo(policy.KindVolume) {
+		for _, r := range res.Volumes {
+			candidates = append(candidates, r)
 		}
-
-		// Tag snapshots
-		for _, res := range filter.Snapshots(res.Snapshots, oldFilter, untaggedFilter) {
-			resourcesToTag = append(resourcesToTag, res)
-			days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-			costPerDay := billing.ResourceCostPerDay(res)
-			totalCost += days * costPerDay
+	}
+	if rule.AppliesTo(policy.KindSnapshot) {
+		for _, r := range res.Snapshots {
+			candidates = append(candidates, r)
 		}
-
-		// Tag images
-		for _, res := range filter.Images(res.Images, oldFilter, untaggedFilter) {
-			resourcesToTag = append(resourcesToTag, res)
-			days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-			costPerDay := billing.ResourceCostPerDay(res)
-			totalCost += days * costPerDay
+	}
+	if rule.AppliesTo(policy.KindImage) {
+		for _, r := range res.Images {
+			candidates = append(candidates, r)
 		}
-
-		if buck, ok := allBuckets[owner]; ok {
-			for _, res := range filter.Buckets(buck, bucketFilter) {
-				resourcesToTag = append(resourcesToTag, res)
-				totalCost += billing.BucketPricePerMonth(res)
-			}
+	}
+	if rule.AppliesTo(policy.KindBucket) {
+		for _, r := range buckets {
+			candidates = append(candidates, r)
 		}
-
-		if totalCost >= totalCostThreshold {
-			for _, res := range resourcesToTag {
-				err := res.SetTag(filter.DeleteTagKey, timeToDelete.Format(time.RFC3339), true)
-				if err != nil {
-					log.Printf("%s: Failed to tag %s for deletion: %s\n", owner, res.ID(), err)
-				} else {
-					log.Printf("%s: Marked %s for deletion at %s\n", owner, res.ID(), timeToDelete)
-				}
-			}
-		} else {
-			log.Printf("%s: Skipping the tagging of resources, total cost $%.2f is less than $%.2f", owner, totalCost, totalCostThreshold)
+	}
+	matching := []cloud.Resource{}
+	traces := make(map[cloud.Resource]*filter.Trace)
+	for _, r := range candidates {
+		if included, trace := rule.Filter().Explain(r); included {
+			matching = append(matching, r)
+			traces[r] = trace
 		}
 	}
+	return matching, traces
 }
 
-// PerformCleanup will run different cleanup functions which all
-// do some sort of rule based cleanup
-func PerformCleanup(mngr cloud.ResourceManager) {
-	// Cleanup all resources with a lifetime tag that has passed. This
-	// includes both the lifetime and the expiry tag
-	cleanupLifetimePassed(mngr)
+// markForDeletion tags a resource to be deleted at the specified time,
+// together with the reason for deleting it and when it was marked. Tag
+// values are limited in length, so long reasons are truncated. GCP labels
+// are too short to hold the conditions that matched once they're escaped,
+// so only the names of the rules are kept as the reason there. Deletions
+// that would fall within a change freeze are postponed until it's over,
+// so the time the resource will be deleted at is returned. If the resource
+// can't be fully marked, the delete tag is removed again, so that it's
+// never deleted without a reason being given.
+func markForDeletion(res cloud.Resource, timeToDelete time.Time, reason string) (time.Time, error) {
+	timeToDelete, err := postponeDeletion(res, timeToDelete)
+	if err != nil {
+		return timeToDelete, err
+	}
+	err = res.SetTag(filter.DeleteTagKey, timeToDelete.Format(time.RFC3339), true)
+	if err != nil {
+		return timeToDelete, err
+	}
+	if res.CSP() == cloud.GCP {
+		reason = ruleNames(reason)
+	}
+	if len(reason) > maxReasonLength {
+		reason = reason[:maxReasonLength-3] + "..."
+	}
+	err = res.SetTag(filter.MarkedAtTagKey, time.Now().Format(time.RFC3339), true)
+	if err == nil {
+		err = res.SetTag(filter.DeleteReasonTagKey, reason, true)
+	}
+	if err != nil {
+		if rollbackErr := res.RemoveTag(filter.DeleteTagKey); rollbackErr != nil {
+			return timeToDelete, fmt.Errorf("marked for deletion at %s without a reason, since tagging failed (%s) and the delete tag could not be removed (%s)", timeToDelete, err, rollbackErr)
+		}
+		return timeToDelete, err
+	}
+	return timeToDelete, nil
+}
 
-	// This will cleanup old released AMIs if they're older than a year
-	cleanupReleaseImagesAWS()
+// ruleNames shortens a reason given by filter.Trace.Reason, such as
+// "old: older_than_days(days=30), unattached; public", to the names of
+// the rules that matched, "old; public"
+func ruleNames(reason string) string {
+	names := []string{}
+	for _, part := range strings.Split(reason, "; ") {
+		names = append(names, strings.SplitN(part, ": ", 2)[0])
+	}
+	return strings.Join(names, "; ")
 }
 
-func cleanupLifetimePassed(mngr cloud.ResourceManager) {
+// MarkUnencryptedForCleanup will mark volumes, snapshots, images and buckets
+// that are not encrypted and older than the specified amount of days for
+// cleanup. Just like MarkForCleanup, the resources are given a tag that will
+// delete them 4 days from now. This is meant to be run against accounts
+// where encryption is required, such as production accounts.
+func MarkUnencryptedForCleanup(mngr cloud.ResourceManager, days int) {
 	allResources := mngr.AllResourcesPerAccount()
 	allBuckets := mngr.BucketsPerAccount()
-	for owner, resources := range allResources {
-		log.Println("Performing lifetime check in", owner)
-		lifetimeFilter := filter.New()
-		lifetimeFilter.AddGeneralRule(filter.LifetimeExceeded())
 
-		expiryFilter := filter.New()
-		expiryFilter.AddGeneralRule(filter.ExpiryDatePassed())
+	for owner, res := range allResources {
+		log.Println("Marking unencrypted resources for cleanup in", owner)
+		unencryptedFilter := filter.New()
+		unencryptedFilter.AddGeneralRule(filter.IsUnencrypted())
+		unencryptedFilter.AddGeneralRule(filter.OlderThanXDays(days))
+		unencryptedFilter.AddGeneralRule(filter.Negate(filter.HasTag(filter.ReleaseTagKey)))
+		unencryptedFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+		unencryptedFilter.AddSnapshotRule(filter.IsNotInUse())
 
-		deleteAtFilter := filter.New()
-		deleteAtFilter.AddGeneralRule(filter.DeleteAtPassed())
+		timeToDelete := time.Now().AddDate(0, 0, defaultGracePeriodDays)
+		reason := fmt.Sprintf("unencrypted for more than %d days", days)
 
-		err := mngr.CleanupInstances(filter.Instances(resources.Instances, lifetimeFilter, expiryFilter, deleteAtFilter))
-		if err != nil {
-			log.Printf("Could not cleanup instances in %s, err:\n%s", owner, err)
+		resourcesToTag := []cloud.Resource{}
+		for _, res := range filter.Volumes(res.Volumes, unencryptedFilter) {
+			resourcesToTag = append(resourcesToTag, res)
 		}
-		err = mngr.CleanupImages(filter.Images(resources.Images, lifetimeFilter, expiryFilter, deleteAtFilter))
-		if err != nil {
-			log.Printf("Could not cleanup images in %s, err:\n%s", owner, err)
+		for _, res := range filter.Snapshots(res.Snapshots, unencryptedFilter) {
+			resourcesToTag = append(resourcesToTag, res)
 		}
-		err = mngr.CleanupVolumes(filter.Volumes(resources.Volumes, lifetimeFilter, expiryFilter, deleteAtFilter))
-		if err != nil {
-			log.Printf("Could not cleanup volumes in %s, err:\n%s", owner, err)
+		for _, res := range filter.Images(res.Images, unencryptedFilter) {
+			resourcesToTag = append(resourcesToTag, res)
 		}
-		err = mngr.CleanupSnapshots(filter.Snapshots(resources.Snapshots, lifetimeFilter, expiryFilter, deleteAtFilter))
-		if err != nil {
-			log.Printf("Could not cleanup snapshots in %s, err:\n%s", owner, err)
+		if buck, ok := allBuckets[owner]; ok {
+			for _, res := range filter.Buckets(buck, unencryptedFilter) {
+				resourcesToTag = append(resourcesToTag, res)
+			}
 		}
-		if bucks, ok := allBuckets[owner]; ok {
-			err = mngr.CleanupBuckets(filter.Buckets(bucks, lifetimeFilter, expiryFilter, deleteAtFilter))
+
+		for _, res := range resourcesToTag {
+			deleteAt, err := markForDeletion(res, timeToDelete, reason)
 			if err != nil {
-				log.Printf("Could not cleanup buckets in %s, err:\n%s", owner, err)
+				log.Printf("%s: Failed to tag unencrypted %s for deletion: %s\n", owner, res.ID(), err)
+			} else {
+				log.Printf("%s: Marked unencrypted %s for deletion at %s\n", owner, res.ID(), deleteAt)
 			}
 		}
 	}
 }
 
-// This function will look for released images. If the image is older
-// than 6 months they will be made private and set to be de-registered
-// after another 6 months have passed
-func cleanupReleaseImagesAWS() {
-	mngr, err := cloud.NewManager(cloud.AWS, sharedDevAWSAccount)
-	if err != nil {
-		log.Printf("Could not initalize resource manager for release image cleanup: %s", err)
-		return
-	}
-	allImages := mngr.ImagesPerAccount()
-	for owner, images := range allImages {
-		log.Println("Performing release image cleanup in", owner)
-		err := cleanupReleaseImagesHelper(mngr, images)
-		if err != nil {
-			log.Printf("Release cleanup for \"%s\" failed:\n%s\n", owner, err)
+// PerformCleanup will run different cleanup functions which all
+// do some sort of rule based cleanup. The policy is used for the default
+// lifetime of resources, resolved for every account, for its limits and
+// for the release lifecycle. Nothing is cleaned up during a change
+// freeze, instead every deletion due within the freeze is postponed until
+// it's over.
+func PerformCleanup(mngr cloud.ResourceManager, pol *policy.Policy, accounts map[string]policy.Account) {
+	if w, frozen := freeze.At(time.Now()); frozen {
+		log.Printf("Not cleaning up anything during the %s freeze\n", w)
+		allResources := mngr.AllResourcesPerAccount()
+		allBuckets := mngr.BucketsPerAccount()
+		for owner, res := range allResources {
+			postponeFrozenDeletions(owner, allOf(res, allBuckets[owner]))
 		}
+		return
 	}
-}
 
-func cleanupReleaseImagesHelper(mngr cloud.ResourceManager, images []cloud.Image) error {
-	// First find public images older than 6 months. Make these images
-	// private and add an expiry to them.
-	filPub := filter.New()
-	filPub.AddGeneralRule(filter.HasTag(releaseTag))
-	filPub.AddGeneralRule(filter.IsPublic())
-	filPub.AddGeneralRule(filter.OlderThanXMonths(6))
-	// Images shoudln't have an expiry tag already
-	filPub.AddGeneralRule(filter.Negate(filter.HasTag(filter.ExpiryTagKey)))
-	imagesToMakePrivate := filter.Images(images, filPub)
-	// Make images private and add expiry tag
-	for i := range imagesToMakePrivate {
-		err := imagesToMakePrivate[i].MakePrivate()
+	// Move release images through the release lifecycle, such as making
+	// them private. Release images due to be deleted are deleted together
+	// with the other resources, so the limits and approval apply to them
+	// as well.
+	releaseDeletions := advanceReleaseImages(pol.ReleaseLifecycle())
 
-		if err != nil {
-			log.Printf("Failed to make release image '%s' private\n", imagesToMakePrivate[i].ID())
-			return err
-		}
-		expiryDateString := time.Now().AddDate(0, 6, 0).Format(filter.ExpiryTagValueFormat)
-		err = imagesToMakePrivate[i].SetTag(filter.ExpiryTagKey, expiryDateString, true)
-		if err != nil {
-			log.Println("Failed to set expiry tag on image", imagesToMakePrivate[i].ID())
-			return err
-		}
-	}
-
-	// Then check for private images that are expired
-	filPriv := filter.New()
-	filPriv.AddGeneralRule(filter.HasTag(releaseTag))
-	filPriv.AddGeneralRule(filter.Negate(filter.IsPublic()))
-	filPriv.AddGeneralRule(filter.ExpiryDatePassed())
-	imagesToCleanup := filter.Images(images, filPriv)
-	// Cleanup expired images
-	err := mngr.CleanupImages(imagesToCleanup)
-	if err != nil {
-		log.Println("Failed to cleanup expired release images")
-		return err
-	}
-	return nil
+	// Cleanup all resources with a lifetime tag that has passed. This
+	// includes both the lifetime and the expiry tag
+	cleanupLifetimePassed(mngr, pol, accounts, releaseDeletions...)
 }
 
-// ResetHousekeeper will remove any cleanup tags existing in the accounts
-// associated with the provided resource manager
-func ResetHousekeeper(mngr cloud.ResourceManager) {
-	allResources := mngr.AllResourcesPerAccount()
+// managedChanges are the planned changes to the resources of a resource
+// manager, and the number of resources in each of its accounts
+type managedChanges struct {
+	mngr    cloud.ResourceManager
+	changes map[string][]*PlannedChange
+	totals  map[string]int
+}
 
-	for owner, res := range allResources {
-		log.Println("Resetting housekeeper tags in", owner)
-		taggedFilter := filter.New()
-		taggedFilter.AddGeneralRule(filter.HasTag(filter.DeleteTagKey))
+// cleanupLifetimePassed deletes resources whose lifetime, expiry or
+// delete-at time has passed, as well as any other deletions planned by
+// other resource managers. The deletions in all accounts are worked out
+// first, so that the safety limits of the policy can be enforced across
+// the whole run. Deletions that need the approval of a manager are only
+// made once they've been approved.
+func cleanupLifetimePassed(mngr cloud.ResourceManager, pol *policy.Policy, accounts map[string]policy.Account, others ...*managedChanges) {
+	log.Println("Performing lifetime check")
+	plan := &Plan{Command: PlanCleanup, Policy: pol}
+	changes, totals := planChanges(mngr, plan, accounts)
+	applyAllowedChanges(pol, append([]*managedChanges{{mngr, changes, totals}}, others...))
+}
 
-		// Un-Tag instances
-		for _, res := range filter.Instances(res.Instances, taggedFilter) {
-			err := res.RemoveTag(filter.DeleteTagKey)
-			if err != nil {
-				log.Printf("Failed to remove tag on %s: %s\n", res.ID(), err)
-			} else {
-				log.Printf("Removed cleanup tag on %s\n", res.ID())
+// applyAllowedChanges makes the planned changes of several resource managers
+// that are allowed by the approval and safety limits of a policy. The
+// changes are checked together, as if they were all made by one manager.
+func applyAllowedChanges(pol *policy.Policy, planned []*managedChanges) {
+	changes := make(map[string][]*PlannedChange)
+	totals := make(map[string]int)
+	managers := make(map[*PlannedChange]cloud.ResourceManager)
+	for _, m := range planned {
+		for owner, ownerChanges := range m.changes {
+			changes[owner] = append(changes[owner], ownerChanges...)
+			for _, c := range ownerChanges {
+				managers[c] = m.mngr
 			}
 		}
-
-		// Un-Tag volumes
-		for _, res := range filter.Volumes(res.Volumes, taggedFilter) {
-			err := res.RemoveTag(filter.DeleteTagKey)
-			if err != nil {
-				log.Printf("Failed to remove tag on %s: %s\n", res.ID(), err)
-			} else {
-				log.Printf("Removed cleanup tag on %s\n", res.ID())
+		// An account can be listed by more than one manager
+		for owner, total := range m.totals {
+			if total > totals[owner] {
+				totals[owner] = total
 			}
 		}
-
-		// Un-Tag snapshots
-		for _, res := range filter.Snapshots(res.Snapshots, taggedFilter) {
-			err := res.RemoveTag(filter.DeleteTagKey)
-			if err != nil {
-				log.Printf("Failed to remove tag on %s: %s\n", res.ID(), err)
-			} else {
-				log.Printf("Removed cleanup tag on %s\n", res.ID())
+	}
+	pruneApprovals(pol.Approval, changes)
+	changes, awaiting := requireApproval(pol.Approval, changes)
+	allowed, held := enforceLimits(pol.Limits, changes, totals)
+	for owner, ownerChanges := range allowed {
+		log.Println("Cleaning up expired resources in", owner)
+		for _, m := range planned {
+			managed := []*PlannedChange{}
+			for _, c := range ownerChanges {
+				if managers[c] == m.mngr {
+					managed = append(managed, c)
+				}
 			}
-		}
-
-		// Un-Tag images
-		for _, res := range filter.Images(res.Images, taggedFilter) {
-			err := res.RemoveTag(filter.DeleteTagKey)
-			if err != nil {
-				log.Printf("Failed to remove tag on %s: %s\n", res.ID(), err)
-			} else {
-				log.Printf("Removed cleanup tag on %s\n", res.ID())
+			if len(managed) > 0 {
+				applyChanges(m.mngr, owner, managed)
 			}
 		}
 	}
+	logAwaitingApproval(awaiting)
+	logHeldBack(held)
 }
@@ -0,0 +1,78 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingVolume fails to set one of its tags, and optionally to remove
+// tags as well
+type failingVolume struct {
+	testVolume
+	failKey    string
+	failRemove bool
+}
+
+func (v *failingVolume) SetTag(key, value string, overwrite bool) error {
+	if key == v.failKey {
+		return errors.New("throttled")
+	}
+	return v.testVolume.SetTag(key, value, overwrite)
+}
+
+func (v *failingVolume) RemoveTag(key string) error {
+	if v.failRemove {
+		return errors.New("throttled")
+	}
+	return v.testVolume.RemoveTag(key)
+}
+
+// gcpDisk is a volume in GCP
+type gcpDisk struct {
+	testVolume
+}
+
+func (d *gcpDisk) CSP() cloud.CSP { return cloud.GCP }
+
+func TestMarkForDeletion(t *testing.T) {
+	deleteAt := time.Now().AddDate(0, 0, 4)
+	vol := &testVolume{"vol-1", "111", map[string]string{}}
+	if _, err := markForDeletion(vol, deleteAt, "unattached"); err != nil {
+		t.Fatal(err)
+	}
+	if len(vol.tags) != 3 || vol.tags[filter.DeleteReasonTagKey] != "unattached" {
+		t.Errorf("Expected the volume to be marked, got %v", vol.tags)
+	}
+
+	// GCP labels only have room for the names of the rules
+	disk := &gcpDisk{testVolume{"disk-1", "111", map[string]string{}}}
+	if _, err := markForDeletion(disk, deleteAt, "old: older_than_days(days=30), unattached; public"); err != nil {
+		t.Fatal(err)
+	}
+	if reason := disk.tags[filter.DeleteReasonTagKey]; reason != "old; public" {
+		t.Errorf("Expected only the rule names as the reason on GCP, got \"%s\"", reason)
+	}
+
+	// The delete tag is removed if the reason can't be set
+	failing := &failingVolume{testVolume{"vol-2", "111", map[string]string{}}, filter.DeleteReasonTagKey, false}
+	if _, err := markForDeletion(failing, deleteAt, "unattached"); err == nil {
+		t.Error("Expected an error when the reason can't be set")
+	}
+	if _, marked := failing.tags[filter.DeleteTagKey]; marked {
+		t.Error("The delete tag should be removed when the reason can't be set")
+	}
+
+	// If the delete tag can't be removed either, the error says so
+	failing = &failingVolume{testVolume{"vol-3", "111", map[string]string{}}, filter.MarkedAtTagKey, true}
+	_, err := markForDeletion(failing, deleteAt, "unattached")
+	if err == nil || !strings.Contains(err.Error(), "without a reason") {
+		t.Errorf("Expected the error to say the volume is marked without a reason, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	"brkt/cloudsweeper/housekeeper/freeze"
+	"log"
+	"time"
+)
+
+// postponeDeletion moves the time a resource is to be deleted out of any
+// change freeze. When the deletion is postponed, the original time and
+// the name of the freeze are recorded in the postponed tag.
+func postponeDeletion(r cloud.Resource, timeToDelete time.Time) (time.Time, error) {
+	until, w, frozen := freeze.Postpone(timeToDelete)
+	if !frozen {
+		return timeToDelete, nil
+	}
+	err := r.SetTag(filter.PostponedTagKey, filter.FormatPostponement(timeToDelete, w.Name), true)
+	if err != nil {
+		return timeToDelete, err
+	}
+	log.Printf("Postponed the deletion of %s from %s to %s, because of the %s freeze\n", r.ID(), timeToDelete, until, w.Name)
+	return until, nil
+}
+
+// postponeFrozenDeletions postpones the deletion of resources that are
+// marked to be deleted within a change freeze, until it's over. Resources
+// that are only deleted because of their lifetime or expiry tags are not
+// deleted during a freeze either, but their tags are left as they are.
+func postponeFrozenDeletions(owner string, resources []cloud.Resource) {
+	if !freeze.Upcoming(time.Now()) {
+		return
+	}
+	for _, r := range resources {
+		deleteAt, marked, err := filter.DeleteTime(r)
+		if !marked || err != nil {
+			continue
+		}
+		postponed, err := postponeDeletion(r, deleteAt)
+		if err != nil {
+			log.Printf("%s: Failed to postpone the deletion of %s: %s\n", owner, r.ID(), err)
+			continue
+		}
+		if postponed.Equal(deleteAt) {
+			continue
+		}
+		if err = r.SetTag(filter.DeleteTagKey, postponed.Format(time.RFC3339), true); err != nil {
+			log.Printf("%s: Failed to postpone the deletion of %s: %s\n", owner, r.ID(), err)
+		}
+	}
+}
+
+// holdFrozenDeletions removes the deletions from the planned changes
+// during a change freeze. Other changes are still made.
+func holdFrozenDeletions(changes map[string][]*PlannedChange, now time.Time) map[string][]*PlannedChange {
+	w, frozen := freeze.At(now)
+	if !frozen {
+		return changes
+	}
+	allowed := make(map[string][]*PlannedChange)
+	held := 0
+	for owner, ownerChanges := range changes {
+		for _, c := range ownerChanges {
+			if c.Action == ActionDelete {
+				held++
+				continue
+			}
+			allowed[owner] = append(allowed[owner], c)
+		}
+	}
+	if held > 0 {
+		log.Printf("Held back %d deletions during the %s freeze\n", held, w)
+	}
+	return allowed
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	"brkt/cloudsweeper/housekeeper/freeze"
+	"testing"
+	"time"
+)
+
+func TestPostponeFrozenDeletions(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	holidays := freeze.Window{Name: "Holidays", Start: now.AddDate(0, 0, 1), End: now.AddDate(0, 0, 10)}
+	freeze.SetCalendar(&freeze.Calendar{Windows: []freeze.Window{holidays}})
+	defer freeze.SetCalendar(&freeze.Calendar{})
+
+	frozen := markedVolume("vol-1", "111", now.AddDate(0, 0, -2))
+	thawed := markedVolume("vol-2", "111", now.AddDate(0, 0, 10))
+	postponeFrozenDeletions("111", []cloud.Resource{frozen, thawed})
+
+	if deleteAt, _, _ := filter.DeleteTime(frozen); !deleteAt.Equal(holidays.End) {
+		t.Errorf("Expected the deletion to be postponed until %s, got %s", holidays.End, deleteAt)
+	}
+	original, name, postponed := filter.Postponement(frozen)
+	if !postponed || name != "Holidays" || !original.Equal(now.AddDate(0, 0, 2)) {
+		t.Errorf("Unexpected postponement %s by %s", original, name)
+	}
+	if _, _, postponed := filter.Postponement(thawed); postponed {
+		t.Error("Deletions outside of the freeze should not be postponed")
+	}
+
+	changes := map[string][]*PlannedChange{"111": {
+		newChange("111", frozen, ActionDelete, "delete-at passed"),
+		newChange("111", thawed, ActionMark, "unattached"),
+	}}
+	if allowed := holdFrozenDeletions(changes, holidays.Start); len(allowed["111"]) != 1 || allowed["111"][0].Action != ActionMark {
+		t.Errorf("Only deletions should be held back during a freeze, got %v", allowed)
+	}
+	if allowed := holdFrozenDeletions(changes, now); len(allowed["111"]) != 2 {
+		t.Errorf("Nothing should be held back outside of a freeze, got %v", allowed)
+	}
+}
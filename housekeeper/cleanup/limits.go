@@ -0,0 +1,107 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/housekeeper/policy"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// heldBack is a deletion that was not made because of the safety limits
+type heldBack struct {
+	change *PlannedChange
+	reason string
+}
+
+// enforceLimits selects the planned deletions that are within the safety
+// limits of a policy. The number of resources in every account is needed
+// to check how much of the account would be deleted. If any account large
+// enough to be checked would lose too much, the run is aborted and every
+// deletion is held back. Other changes than deletions are always allowed.
+func enforceLimits(limits *policy.Limits, changes map[string][]*PlannedChange, totals map[string]int) (map[string][]*PlannedChange, []heldBack) {
+	if limits == nil {
+		return changes, nil
+	}
+	owners := []string{}
+	deletions := make(map[string]int)
+	for owner, ownerChanges := range changes {
+		owners = append(owners, owner)
+		for _, c := range ownerChanges {
+			if c.Action == ActionDelete {
+				deletions[owner]++
+			}
+		}
+	}
+	sort.Strings(owners)
+
+	abort := ""
+	for _, owner := range owners {
+		if !limits.AccountPercentApplies(totals[owner]) {
+			continue
+		}
+		percent := 100.0 * float64(deletions[owner]) / float64(totals[owner])
+		if percent > limits.MaxAccountPercent {
+			abort = fmt.Sprintf("%s would lose %.0f%% of its resources, more than %g%%", owner, percent, limits.MaxAccountPercent)
+			log.Printf("Aborting all deletions: %s\n", abort)
+			break
+		}
+	}
+
+	allowed := make(map[string][]*PlannedChange)
+	held := []heldBack{}
+	total, totalCost := 0, 0.0
+	perKind := make(map[string]int)
+	for _, owner := range owners {
+		ownerChanges := append([]*PlannedChange{}, changes[owner]...)
+		sort.Slice(ownerChanges, func(i, j int) bool {
+			return ownerChanges[i].key() < ownerChanges[j].key()
+		})
+		perAccount := 0
+		for _, c := range ownerChanges {
+			if c.Action != ActionDelete {
+				allowed[owner] = append(allowed[owner], c)
+				continue
+			}
+			reason := abort
+			switch {
+			case reason != "":
+			case limits.MaxDeletions > 0 && total >= limits.MaxDeletions:
+				reason = fmt.Sprintf("more than %d deletions in the run", limits.MaxDeletions)
+			case limits.MaxDeletionsPerAccount > 0 && perAccount >= limits.MaxDeletionsPerAccount:
+				reason = fmt.Sprintf("more than %d deletions in %s", limits.MaxDeletionsPerAccount, owner)
+			case limits.MaxDeletionsPerKind[c.Kind] > 0 && perKind[c.Kind] >= limits.MaxDeletionsPerKind[c.Kind]:
+				reason = fmt.Sprintf("more than %d %s deletions in the run", limits.MaxDeletionsPerKind[c.Kind], c.Kind)
+			case limits.MaxMonthlyCost > 0 && totalCost+c.EstimatedSavings > limits.MaxMonthlyCost:
+				reason = fmt.Sprintf("more than $%.2f per month deleted in the run", limits.MaxMonthlyCost)
+			}
+			if reason != "" {
+				held = append(held, heldBack{c, reason})
+				continue
+			}
+			allowed[owner] = append(allowed[owner], c)
+			total++
+			perAccount++
+			perKind[c.Kind]++
+			totalCost += c.EstimatedSavings
+		}
+	}
+	return allowed, held
+}
+
+// logHeldBack summarizes the deletions held back by the safety limits
+func logHeldBack(held []heldBack) {
+	if len(held) == 0 {
+		return
+	}
+	cost := 0.0
+	for _, h := range held {
+		cost += h.change.EstimatedSavings
+	}
+	log.Printf("Held back %d deletions ($%.2f per month) because of the safety limits, use --override-limits to delete them anyway:\n", len(held), cost)
+	for _, h := range held {
+		log.Printf("  %s: %s %s (%s), held back: %s\n", h.change.Account, h.change.Kind, h.change.ID, h.change.Reason, h.reason)
+	}
+}
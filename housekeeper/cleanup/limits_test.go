@@ -0,0 +1,96 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/housekeeper/policy"
+	"fmt"
+	"testing"
+)
+
+func testDeletions(owner, kind string, n int, cost float64) []*PlannedChange {
+	changes := []*PlannedChange{}
+	for i := 0; i < n; i++ {
+		changes = append(changes, &PlannedChange{
+			Account:          owner,
+			Kind:             kind,
+			ID:               fmt.Sprintf("%s-%d", kind, i),
+			Action:           ActionDelete,
+			EstimatedSavings: cost,
+		})
+	}
+	return changes
+}
+
+func countAllowed(allowed map[string][]*PlannedChange) int {
+	n := 0
+	for _, changes := range allowed {
+		n += len(changes)
+	}
+	return n
+}
+
+func TestEnforceLimits(t *testing.T) {
+	changes := map[string][]*PlannedChange{
+		"111": append(testDeletions("111", policy.KindVolume, 5, 10), testDeletions("111", policy.KindInstance, 5, 10)...),
+		"222": testDeletions("222", policy.KindVolume, 5, 10),
+	}
+	totals := map[string]int{"111": 100, "222": 100}
+
+	allowed, held := enforceLimits(nil, changes, totals)
+	if countAllowed(allowed) != 15 || len(held) != 0 {
+		t.Error("Nothing should be held back without limits")
+	}
+
+	cases := []struct {
+		limits  policy.Limits
+		allowed int
+	}{
+		{policy.Limits{MaxDeletions: 7}, 7},
+		{policy.Limits{MaxDeletionsPerAccount: 3}, 6},
+		{policy.Limits{MaxDeletionsPerKind: map[string]int{policy.KindVolume: 4}}, 9},
+		{policy.Limits{MaxMonthlyCost: 55}, 5},
+		{policy.Limits{MaxAccountPercent: 10}, 15},
+		{policy.Limits{MaxAccountPercent: 5}, 0},
+		{policy.Limits{MaxAccountPercent: 5, MinAccountResources: 200}, 15},
+	}
+	for _, c := range cases {
+		allowed, held := enforceLimits(&c.limits, changes, totals)
+		if countAllowed(allowed) != c.allowed || len(held) != 15-c.allowed {
+			t.Errorf("Limits %+v allowed %d and held back %d deletions, expected %d allowed", c.limits, countAllowed(allowed), len(held), c.allowed)
+		}
+	}
+}
+
+func TestAccountPercentInSmallAccounts(t *testing.T) {
+	// Deleting the only resource of a small account shouldn't stop the
+	// deletions in every other account
+	changes := map[string][]*PlannedChange{
+		"111": testDeletions("111", policy.KindVolume, 1, 10),
+		"222": testDeletions("222", policy.KindVolume, 5, 10),
+	}
+	totals := map[string]int{"111": 1, "222": 100}
+	allowed, held := enforceLimits(&policy.Limits{MaxAccountPercent: 50}, changes, totals)
+	if countAllowed(allowed) != 6 || len(held) != 0 {
+		t.Errorf("Accounts with fewer than %d resources should not be checked, allowed %d and held back %d deletions", policy.DefaultMinAccountResources, countAllowed(allowed), len(held))
+	}
+	totals["111"] = policy.DefaultMinAccountResources
+	changes["111"] = testDeletions("111", policy.KindVolume, 6, 10)
+	allowed, held = enforceLimits(&policy.Limits{MaxAccountPercent: 50}, changes, totals)
+	if countAllowed(allowed) != 0 || len(held) != 11 {
+		t.Errorf("Losing more than half of an account with %d resources should abort every deletion", policy.DefaultMinAccountResources)
+	}
+}
+
+func TestLimitsOnlyApplyToDeletions(t *testing.T) {
+	marks := testDeletions("111", policy.KindVolume, 3, 10)
+	for _, c := range marks {
+		c.Action = ActionMark
+	}
+	changes := map[string][]*PlannedChange{"111": marks}
+	allowed, held := enforceLimits(&policy.Limits{MaxDeletions: 1, MaxAccountPercent: 1}, changes, map[string]int{"111": 3})
+	if countAllowed(allowed) != 3 || len(held) != 0 {
+		t.Error("Limits should not hold back other changes than deletions")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	"log"
+	"sort"
+	"strings"
+)
+
+// MigrateTags will rewrite tags using a legacy key, as configured with
+// filter.SetTagKeys, to use the key that replaced it. If a resource
+// already has a tag with the new key, that tag is kept and the legacy
+// tag is just removed. With dryRun set no tags are changed, the
+// migrations are only logged.
+func MigrateTags(mngr cloud.ResourceManager, dryRun bool) {
+	aliases := filter.Aliases()
+	if len(aliases) == 0 {
+		log.Println("No legacy tag keys are configured, nothing to migrate")
+		return
+	}
+	legacyKeys := []string{}
+	for legacy := range aliases {
+		legacyKeys = append(legacyKeys, legacy)
+	}
+	sort.Strings(legacyKeys)
+
+	allResources := mngr.AllResourcesPerAccount()
+	allBuckets := mngr.BucketsPerAccount()
+	for owner, res := range allResources {
+		log.Println("Migrating legacy tags in", owner)
+		resources := []cloud.Resource{}
+		for _, r := range res.Instances {
+			resources = append(resources, r)
+		}
+		for _, r := range res.Volumes {
+			resources = append(resources, r)
+		}
+		for _, r := range res.Snapshots {
+			resources = append(resources, r)
+		}
+		for _, r := range res.Images {
+			resources = append(resources, r)
+		}
+		for _, r := range allBuckets[owner] {
+			resources = append(resources, r)
+		}
+
+		migrated := 0
+		for _, r := range resources {
+			for _, legacy := range legacyKeys {
+				if migrateTag(r, legacy, aliases[legacy], dryRun) {
+					migrated++
+				}
+			}
+		}
+		if dryRun {
+			log.Printf("%s: Would migrate %d tags\n", owner, migrated)
+		} else {
+			log.Printf("%s: Migrated %d tags\n", owner, migrated)
+		}
+	}
+}
+
+// migrateTag moves the value of a legacy tag to its new key, and reports
+// whether the resource had the legacy tag
+func migrateTag(r cloud.Resource, legacy, key string, dryRun bool) bool {
+	legacyKey, value, exist := findTag(r, legacy)
+	if !exist {
+		return false
+	}
+	_, existing, hasNew := findTag(r, key)
+	if hasNew && existing != value {
+		log.Printf("%s has both %s=%s and %s=%s, keeping %s\n", r.ID(), legacyKey, value, key, existing, key)
+	}
+	if dryRun {
+		log.Printf("Would migrate %s on %s to %s\n", legacyKey, r.ID(), key)
+		return true
+	}
+	if !hasNew {
+		if err := r.SetTag(key, value, false); err != nil {
+			log.Printf("Failed to tag %s with %s: %s\n", r.ID(), key, err)
+			return false
+		}
+	}
+	if err := r.RemoveTag(legacyKey); err != nil {
+		log.Printf("Failed to remove %s from %s: %s\n", legacyKey, r.ID(), err)
+		return false
+	}
+	log.Printf("Migrated %s on %s to %s\n", legacyKey, r.ID(), key)
+	return true
+}
+
+// findTag looks up a tag without considering legacy keys, ignoring the
+// case of the key. The key as set on the resource is returned as well.
+func findTag(r cloud.Resource, tagKey string) (string, string, bool) {
+	for key, val := range r.Tags() {
+		if strings.ToLower(key) == strings.ToLower(tagKey) {
+			return key, val, true
+		}
+	}
+	return "", "", false
+}
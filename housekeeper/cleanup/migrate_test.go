@@ -0,0 +1,37 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"testing"
+)
+
+func TestMigrateTag(t *testing.T) {
+	vol := &testVolume{"vol-1", "111", map[string]string{"Expires": "2018-06-17", "env": "ci"}}
+	if !migrateTag(vol, "expires", "sweeper-expiry", true) {
+		t.Error("A dry run should report the legacy tag")
+	}
+	if _, exist := vol.tags["sweeper-expiry"]; exist {
+		t.Error("A dry run should not change any tags")
+	}
+
+	if !migrateTag(vol, "expires", "sweeper-expiry", false) {
+		t.Fatal("Expected the legacy tag to be migrated")
+	}
+	if len(vol.tags) != 2 || vol.tags["sweeper-expiry"] != "2018-06-17" {
+		t.Errorf("Expected the value to be moved to the new key, got %v", vol.tags)
+	}
+	if migrateTag(vol, "expires", "sweeper-expiry", false) {
+		t.Error("Nothing should be migrated twice")
+	}
+
+	// The new key wins when both are set
+	both := &testVolume{"vol-2", "111", map[string]string{"Expires": "2018-06-17", "sweeper-expiry": "2018-07-01"}}
+	if !migrateTag(both, "expires", "sweeper-expiry", false) {
+		t.Fatal("Expected the legacy tag to be removed")
+	}
+	if len(both.tags) != 1 || both.tags["sweeper-expiry"] != "2018-07-01" {
+		t.Errorf("Expected only the new tag to be kept, got %v", both.tags)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	hk "brkt/cloudsweeper/housekeeper"
+	"brkt/cloudsweeper/housekeeper/policy"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// The status of a resource in a handover
+const (
+	// HandoverPending resources are marked for cleanup once the handover
+	// period is over, unless they're whitelisted or reassigned before then
+	HandoverPending = "pending"
+	// HandoverMarked resources are marked for cleanup
+	HandoverMarked = "marked"
+	// HandoverWhitelisted resources are kept, as they're whitelisted
+	HandoverWhitelisted = "whitelisted"
+	// HandoverReassigned resources are kept, as they've been reassigned
+	// to an active employee
+	HandoverReassigned = "reassigned"
+	// HandoverInUse resources are due to be marked for cleanup, but are
+	// attached or in use, so they can't be deleted. They're marked once
+	// they're no longer in use.
+	HandoverInUse = "in-use"
+)
+
+// Handover is the inventory of the resources a disabled employee left
+// behind, which is reported to their manager
+type Handover struct {
+	Employee *hk.Employee
+	Items    []*HandoverItem
+	// Unmanaged are the employee's accounts where housekeeper isn't
+	// enabled, which can't be inventoried
+	Unmanaged []string
+}
+
+// Count returns the number of resources in the handover with the
+// specified status
+func (h *Handover) Count(status string) int {
+	count := 0
+	for _, item := range h.Items {
+		if item.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// HandoverItem is a resource in a handover, and what happens to it
+type HandoverItem struct {
+	Resource cloud.Resource
+	Kind     string
+	Status   string
+	// NewOwner is the username of the employee the resource was
+	// reassigned to
+	NewOwner string
+	// CleanupAt is when a pending resource is marked for cleanup, or when
+	// a marked resource is deleted
+	CleanupAt time.Time
+}
+
+// Offboard inventories the resources in the accounts of disabled
+// employees, and returns a handover per employee for their manager. The
+// manager must be set up for the housekeeper enabled accounts of the
+// disabled employees. The first time a resource is inventoried it's given
+// a tag recording when its handover started. Resources that are neither
+// whitelisted nor reassigned are marked for cleanup once the handover has
+// lasted the specified number of days, and deleted 4 days later. Volumes
+// and snapshots that are in use are only marked once they're not.
+// Resources are reassigned by tagging them with the username of an active
+// employee, or by moving the whole account to another employee in the
+// organization.
+func Offboard(mngr cloud.ResourceManager, org *hk.Organization, csp cloud.CSP, days int) []*Handover {
+	allResources := mngr.AllResourcesPerAccount()
+	allBuckets := mngr.BucketsPerAccount()
+	employees := org.UsernameToEmployeeMapping()
+	now := time.Now()
+
+	handovers := []*Handover{}
+	for _, employee := range org.DisabledEmployees() {
+		handover := &Handover{Employee: employee, Items: []*HandoverItem{}, Unmanaged: []string{}}
+		enabled := employee.EnabledAccounts(csp)
+		for _, account := range employee.Accounts(csp) {
+			if !containsString(enabled, account) {
+				handover.Unmanaged = append(handover.Unmanaged, account)
+			}
+		}
+		for _, account := range enabled {
+			log.Printf("Inventorying resources of %s in %s\n", employee.Username, account)
+			res, ok := allResources[account]
+			if !ok {
+				res = &cloud.ResourceCollection{}
+			}
+			for _, r := range allOf(res, allBuckets[account]) {
+				item := handoverItem(r, employees, days, now)
+				if err := offboardResource(item, employee, now); err != nil {
+					log.Printf("%s: Failed to offboard %s: %s\n", account, r.ID(), err)
+				}
+				handover.Items = append(handover.Items, item)
+			}
+		}
+		if len(handover.Items) > 0 || len(handover.Unmanaged) > 0 {
+			log.Printf("%s: %d resources, %d pending and %d marked for cleanup\n", employee.Username,
+				len(handover.Items), handover.Count(HandoverPending), handover.Count(HandoverMarked))
+			handovers = append(handovers, handover)
+		}
+	}
+	return handovers
+}
+
+// handoverItem works out the status of a resource in a handover. Pending
+// resources that are due to be marked for cleanup are returned with the
+// marked status and a zero CleanupAt, see offboardResource.
+func handoverItem(r cloud.Resource, employees map[string]*hk.Employee, days int, now time.Time) *HandoverItem {
+	item := &HandoverItem{Resource: r, Kind: policy.KindOf(r)}
+	if owner, exist := filter.TagValue(r, filter.OwnerTagKey); exist {
+		if employee, ok := employees[strings.TrimSpace(owner)]; ok && !employee.Disabled {
+			item.Status = HandoverReassigned
+			item.NewOwner = employee.Username
+			return item
+		}
+	}
+	if filter.IsWhitelisted(r) {
+		item.Status = HandoverWhitelisted
+		return item
+	}
+	if deleteAt, marked, err := filter.DeleteTime(r); marked && err == nil {
+		item.Status = HandoverMarked
+		item.CleanupAt = deleteAt
+		return item
+	}
+	started, exist, err := filter.OffboardedTime(r)
+	if !exist || err != nil {
+		started = now
+	}
+	item.CleanupAt = started.AddDate(0, 0, days)
+	item.Status = HandoverPending
+	if !now.Before(item.CleanupAt) {
+		item.Status = HandoverMarked
+		if inUse(r) {
+			item.Status = HandoverInUse
+		}
+		item.CleanupAt = time.Time{}
+	}
+	return item
+}
+
+// inUse checks if a resource is a volume attached to an instance, or a
+// snapshot in use, neither of which can be deleted
+func inUse(r cloud.Resource) bool {
+	switch r := r.(type) {
+	case cloud.Volume:
+		return r.Attached()
+	case cloud.Snapshot:
+		return r.InUse()
+	}
+	return false
+}
+
+// offboardResource tags a resource according to its status in the
+// handover. The handover of pending resources is started if it hasn't
+// already, and resources due to be marked are marked for cleanup.
+func offboardResource(item *HandoverItem, employee *hk.Employee, now time.Time) error {
+	r := item.Resource
+	switch {
+	case item.Status == HandoverPending:
+		if _, exist, err := filter.OffboardedTime(r); exist && err == nil {
+			return nil
+		}
+		return r.SetTag(filter.OffboardedAtTagKey, now.Format(time.RFC3339), true)
+	case item.Status == HandoverMarked && item.CleanupAt.IsZero():
+		reason := fmt.Sprintf("owner %s has left and the resource was not handed over", employee.Username)
+		timeToDelete, err := markForDeletion(r, now.AddDate(0, 0, defaultGracePeriodDays), reason)
+		if err != nil {
+			return err
+		}
+		item.CleanupAt = timeToDelete
+		log.Printf("Marked %s of %s for deletion at %s\n", r.ID(), employee.Username, timeToDelete)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	hk "brkt/cloudsweeper/housekeeper"
+	"testing"
+	"time"
+)
+
+const testOrganization = `{
+	"managers": [{"username": "boss"}],
+	"departments": [{"number": 1, "id": "eng", "name": "Engineering"}],
+	"employees": [
+		{"username": "boss", "real_name": "The Boss", "manager": "boss", "department": "eng"},
+		{"username": "gone", "real_name": "Gone Person", "manager": "boss", "department": "eng", "disabled": true,
+		 "aws_accounts": [{"id": "111", "housekeeper_enabled": true}, {"id": "222"}]},
+		{"username": "also-gone", "real_name": "Also Gone", "manager": "boss", "department": "eng", "disabled": true}
+	]
+}`
+
+// attachedVolume is a volume attached to an instance
+type attachedVolume struct {
+	testVolume
+}
+
+func (v *attachedVolume) Attached() bool { return true }
+
+func TestHandoverItem(t *testing.T) {
+	org, err := hk.InitOrganization([]byte(testOrganization))
+	if err != nil {
+		t.Fatal(err)
+	}
+	employees := org.UsernameToEmployeeMapping()
+	now := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	offboarded := func(id string, since time.Time) *testVolume {
+		return &testVolume{id, "111", map[string]string{filter.OffboardedAtTagKey: since.Format(time.RFC3339)}}
+	}
+	reassigned := offboarded("vol-3", now.AddDate(0, 0, -60))
+	reassigned.tags[filter.OwnerTagKey] = "boss"
+	reassignedToDisabled := offboarded("vol-4", now.AddDate(0, 0, -60))
+	reassignedToDisabled.tags[filter.OwnerTagKey] = "also-gone"
+	whitelisted := offboarded("vol-5", now.AddDate(0, 0, -60))
+	whitelisted.tags[filter.WhitelistTagKey] = ""
+	marked := markedVolume("vol-6", "111", now.AddDate(0, 0, -1))
+
+	cases := []struct {
+		volume    *testVolume
+		status    string
+		cleanupAt time.Time
+	}{
+		{&testVolume{"vol-1", "111", map[string]string{}}, HandoverPending, now.AddDate(0, 0, 30)},
+		{offboarded("vol-2", now.AddDate(0, 0, -10)), HandoverPending, now.AddDate(0, 0, 20)},
+		{reassigned, HandoverReassigned, time.Time{}},
+		{reassignedToDisabled, HandoverMarked, time.Time{}},
+		{whitelisted, HandoverWhitelisted, time.Time{}},
+		{marked, HandoverMarked, now.AddDate(0, 0, 3)},
+	}
+	for _, c := range cases {
+		item := handoverItem(c.volume, employees, 30, now)
+		if item.Status != c.status || !item.CleanupAt.Equal(c.cleanupAt) {
+			t.Errorf("%s: expected %s at %s, got %s at %s", c.volume.ID(), c.status, c.cleanupAt, item.Status, item.CleanupAt)
+		}
+	}
+	if item := handoverItem(reassigned, employees, 30, now); item.NewOwner != "boss" {
+		t.Errorf("Expected vol-3 to be reassigned to boss, got %s", item.NewOwner)
+	}
+}
+
+func TestOffboardResource(t *testing.T) {
+	org, err := hk.InitOrganization([]byte(testOrganization))
+	if err != nil {
+		t.Fatal(err)
+	}
+	employees := org.UsernameToEmployeeMapping()
+	gone := employees["gone"]
+	if len(org.DisabledEmployees()) != 2 || len(gone.EnabledAccounts(cloud.AWS)) != 1 {
+		t.Fatal("Expected two disabled employees, with one enabled account")
+	}
+	now := time.Now()
+
+	v := &testVolume{"vol-1", "111", map[string]string{}}
+	item := handoverItem(v, employees, 30, now)
+	if err := offboardResource(item, gone, now); err != nil {
+		t.Fatal(err)
+	}
+	if started, exist, _ := filter.OffboardedTime(v); !exist || started.Unix() != now.Unix() {
+		t.Errorf("The handover should have started now, got %v", v.tags)
+	}
+	if filter.TaggedForCleanup()(v) {
+		t.Error("The resource should not be marked before the handover period is over")
+	}
+
+	later := now.AddDate(0, 0, 31)
+	item = handoverItem(v, employees, 30, later)
+	if err := offboardResource(item, gone, later); err != nil {
+		t.Fatal(err)
+	}
+	if !filter.TaggedForCleanup()(v) || !item.CleanupAt.Equal(later.AddDate(0, 0, 4)) {
+		t.Errorf("The resource should be marked for cleanup once the handover period is over, got %v", v.tags)
+	}
+	if started, _, _ := filter.OffboardedTime(v); started.Unix() != now.Unix() {
+		t.Error("The start of the handover should not change")
+	}
+
+	attached := &attachedVolume{testVolume{"vol-2", "111", map[string]string{
+		filter.OffboardedAtTagKey: now.Format(time.RFC3339),
+	}}}
+	item = handoverItem(attached, employees, 30, later)
+	if err := offboardResource(item, gone, later); err != nil {
+		t.Fatal(err)
+	}
+	if item.Status != HandoverInUse || filter.TaggedForCleanup()(attached) {
+		t.Errorf("Attached volumes should not be marked for cleanup, got %s", item.Status)
+	}
+}
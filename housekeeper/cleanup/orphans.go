@@ -0,0 +1,114 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// Orphans are left overs that nothing refers to anymore, so
+	// they are marked much sooner than ordinary old resources
+	orphanMinimumAgeDays = 7
+)
+
+// FindOrphans will look for resources that are left overs rather than
+// old. These are resources that whatever they were created from, or
+// belonged to, has been deleted:
+//   - volumes that are not attached to any instance. When they were
+//     detached isn't known, so they may have been detached just now
+//   - snapshots whose source volume no longer exists
+//   - images whose backing snapshots have been deleted
+//
+// Only orphans older than a week are included. Snapshots are left out if
+// some of the volumes could not be listed, as their source volumes may
+// still exist.
+func FindOrphans(resources *cloud.ResourceCollection) *cloud.ResourceCollection {
+	volumeFilter := filter.New()
+	volumeFilter.AddVolumeRule(filter.IsUnattached())
+	volumeFilter.AddGeneralRule(filter.OlderThanXDays(orphanMinimumAgeDays))
+
+	snapshotFilter := filter.New()
+	snapshotFilter.AddSnapshotRule(filter.SourceVolumeDeleted(resources.Volumes))
+	snapshotFilter.AddSnapshotRule(filter.IsNotInUse())
+	snapshotFilter.AddGeneralRule(filter.OlderThanXDays(orphanMinimumAgeDays))
+
+	imageFilter := filter.New()
+	imageFilter.AddImageRule(filter.BackingSnapshotMissing(resources.Snapshots))
+	imageFilter.AddGeneralRule(filter.OlderThanXDays(orphanMinimumAgeDays))
+
+	snapshots := []cloud.Snapshot{}
+	if resources.VolumesIncomplete {
+		log.Printf("Not all volumes in %s could be listed, skipping orphaned snapshots\n", resources.Owner)
+	} else {
+		snapshots = filter.Snapshots(resources.Snapshots, snapshotFilter)
+	}
+
+	return &cloud.ResourceCollection{
+		Owner:     resources.Owner,
+		Instances: []cloud.Instance{},
+		Volumes:   filter.Volumes(resources.Volumes, volumeFilter),
+		Snapshots: snapshots,
+		Images:    filter.Images(resources.Images, imageFilter),
+	}
+}
+
+// MarkOrphansForCleanup will find orphaned resources, using FindOrphans,
+// and mark them for cleanup. Just like MarkForCleanup the resources are given
+// a tag that will delete them, but after a grace period of the specified
+// number of days, which is usually shorter. Whitelisted and released
+// resources are not marked.
+func MarkOrphansForCleanup(mngr cloud.ResourceManager, graceDays int) {
+	allResources := mngr.AllResourcesPerAccount()
+
+	for owner, res := range allResources {
+		log.Println("Marking orphaned resources for cleanup in", owner)
+		orphans := FindOrphans(res)
+
+		markFilter := filter.New()
+		markFilter.AddGeneralRule(filter.Negate(filter.HasTag(filter.ReleaseTagKey)))
+		markFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+
+		timeToDelete := time.Now().AddDate(0, 0, graceDays)
+
+		resourcesToTag := []cloud.Resource{}
+		for _, res := range filter.Volumes(orphans.Volumes, markFilter) {
+			resourcesToTag = append(resourcesToTag, res)
+		}
+		for _, res := range filter.Snapshots(orphans.Snapshots, markFilter) {
+			resourcesToTag = append(resourcesToTag, res)
+		}
+		for _, res := range filter.Images(orphans.Images, markFilter) {
+			resourcesToTag = append(resourcesToTag, res)
+		}
+
+		for _, res := range resourcesToTag {
+			deleteAt, err := markForDeletion(res, timeToDelete, orphanReason(res))
+			if err != nil {
+				log.Printf("%s: Failed to tag orphaned %s for deletion: %s\n", owner, res.ID(), err)
+			} else {
+				log.Printf("%s: Marked orphaned %s for deletion at %s\n", owner, res.ID(), deleteAt)
+			}
+		}
+	}
+}
+
+// orphanReason explains why a resource returned by FindOrphans is
+// considered orphaned
+func orphanReason(res cloud.Resource) string {
+	switch res.(type) {
+	case cloud.Volume:
+		return fmt.Sprintf("orphaned: unattached, created more than %d days ago", orphanMinimumAgeDays)
+	case cloud.Snapshot:
+		return "orphaned: source volume deleted"
+	case cloud.Image:
+		return "orphaned: backing snapshot missing"
+	default:
+		return "orphaned"
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"testing"
+)
+
+// testSnapshot only embeds the resource methods of a test volume, so that
+// it isn't taken for a volume
+type testSnapshot struct {
+	cloud.Resource
+	sourceVolumeID string
+}
+
+func (s *testSnapshot) Encrypted() bool        { return true }
+func (s *testSnapshot) SizeGB() int64          { return 100 }
+func (s *testSnapshot) InUse() bool            { return false }
+func (s *testSnapshot) MakePrivate() error     { return nil }
+func (s *testSnapshot) SourceVolumeID() string { return s.sourceVolumeID }
+
+func TestFindOrphanedSnapshots(t *testing.T) {
+	res := &cloud.ResourceCollection{
+		Owner:   "111",
+		Volumes: []cloud.Volume{&testVolume{"vol-1", "111", map[string]string{}}},
+		Snapshots: []cloud.Snapshot{
+			&testSnapshot{&testVolume{"snap-1", "111", map[string]string{}}, "vol-1"},
+			&testSnapshot{&testVolume{"snap-2", "111", map[string]string{}}, "vol-2"},
+		},
+	}
+	if orphans := FindOrphans(res); len(orphans.Snapshots) != 1 || orphans.Snapshots[0].ID() != "snap-2" {
+		t.Errorf("Only the snapshot of the deleted volume is an orphan, got %v", orphans.Snapshots)
+	}
+
+	res.VolumesIncomplete = true
+	if orphans := FindOrphans(res); len(orphans.Snapshots) != 0 {
+		t.Errorf("No snapshots are orphans when some volumes could not be listed, got %v", orphans.Snapshots)
+	}
+}
@@ -0,0 +1,420 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/billing"
+	"brkt/cloudsweeper/cloud/filter"
+	"brkt/cloudsweeper/housekeeper/policy"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The commands a plan can be made for
+const (
+	PlanMark    = "mark-for-cleanup"
+	PlanCleanup = "cleanup"
+)
+
+// The actions of a planned change
+const (
+	// ActionWarn only logs that a resource matches a policy rule
+	ActionWarn = "warn"
+	// ActionTag sets a tag on a resource
+	ActionTag = "tag"
+	// ActionMark marks a resource for deletion once a grace period has passed
+	ActionMark = "mark"
+	// ActionDelete deletes a resource
+	ActionDelete = "delete"
+)
+
+// Plan is a machine-readable list of the changes a command would make,
+// so they can be reviewed before they're applied with ApplyPlan.
+type Plan struct {
+	Command string    `json:"command"`
+	CSP     cloud.CSP `json:"csp"`
+	Created time.Time `json:"created"`
+	// Policy is the policy used to make the plan. The same policy is
+	// used to verify the plan when it's applied.
+	Policy  *policy.Policy   `json:"policy"`
+	Changes []*PlannedChange `json:"changes"`
+}
+
+// PlannedChange is a single change to a resource in a Plan
+type PlannedChange struct {
+	Account  string `json:"account"`
+	Kind     string `json:"kind"`
+	ID       string `json:"id"`
+	Location string `json:"location,omitempty"`
+	Action   string `json:"action"`
+	Reason   string `json:"reason"`
+	// TagKey and TagValue are set for tag actions
+	TagKey   string `json:"tag_key,omitempty"`
+	TagValue string `json:"tag_value,omitempty"`
+	// GracePeriodDays is set for mark actions. The grace period starts
+	// when the plan is applied, not when it's made.
+	GracePeriodDays int `json:"grace_period_days,omitempty"`
+	// EstimatedSavings is how much USD is saved per month once the
+	// resource is deleted
+	EstimatedSavings float64 `json:"estimated_monthly_savings"`
+
+	resource cloud.Resource
+}
+
+// key identifies a change when verifying a plan. GCP disk names are only
+// unique within a zone, so the location is part of the key.
+func (c *PlannedChange) key() string {
+	return strings.Join([]string{c.Account, c.Kind, c.Location, c.ID, c.Action, c.TagKey}, "/")
+}
+
+// TotalSavings returns the estimated monthly savings of all changes
+func (p *Plan) TotalSavings() float64 {
+	total := 0.0
+	for _, c := range p.Changes {
+		total += c.EstimatedSavings
+	}
+	return total
+}
+
+// Write writes the plan as JSON to the specified file
+func (p *Plan) Write(path string) error {
+	raw, err := json.MarshalIndent(p, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, raw, 0644)
+}
+
+// ReadPlan reads a plan written by Plan.Write
+func ReadPlan(path string) (*Plan, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plan := new(Plan)
+	if err = json.Unmarshal(raw, plan); err != nil {
+		return nil, fmt.Errorf("Could not parse plan: %s", err)
+	}
+	if plan.Command != PlanMark && plan.Command != PlanCleanup {
+		return nil, fmt.Errorf("Unknown plan command \"%s\"", plan.Command)
+	}
+	if plan.Policy == nil {
+		return nil, fmt.Errorf("Plan for %s has no policy", plan.Command)
+	}
+	// The policy's rules have to be compiled again
+	rawPolicy, err := json.Marshal(plan.Policy)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Policy, err = policy.Parse(rawPolicy); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// MakePlan will work out the changes the specified command would make,
+// without touching any resources. The policy is resolved for every
+// account, just like when running the command directly.
+func MakePlan(mngr cloud.ResourceManager, csp cloud.CSP, command string, pol *policy.Policy, accounts map[string]policy.Account) (*Plan, error) {
+	if command != PlanMark && command != PlanCleanup {
+		return nil, fmt.Errorf("Can't make a plan for \"%s\"", command)
+	}
+	plan := &Plan{
+		Command: command,
+		CSP:     csp,
+		Created: time.Now(),
+		Policy:  pol,
+		Changes: []*PlannedChange{},
+	}
+	changes, totals := planChanges(mngr, plan, accounts)
+	for _, ownerChanges := range changes {
+		plan.Changes = append(plan.Changes, ownerChanges...)
+	}
+	sort.Slice(plan.Changes, func(i, j int) bool {
+		return plan.Changes[i].key() < plan.Changes[j].key()
+	})
+	log.Printf("Planned %d changes, saving an estimated $%.2f per month\n", len(plan.Changes), plan.TotalSavings())
+	// The plan includes everything, but reviewers should know what the
+	// safety limits will hold back when it's applied
+	_, held := enforceLimits(pol.Limits, changes, totals)
+	logHeldBack(held)
+	return plan, nil
+}
+
+// ApplyPlan will make the changes of a plan. Each resource is verified to
+// still need the planned change, using the same rules as when the plan
+// was made, and changes that are no longer needed are skipped. Resources
+// that are not part of the plan are never touched. Deletions are subject
+// to the approval requirements and safety limits of the plan's policy,
+// and are held back during a change freeze.
+func ApplyPlan(mngr cloud.ResourceManager, plan *Plan, accounts map[string]policy.Account) {
+	current, totals := planChanges(mngr, plan, accounts)
+	planned := make(map[string]bool)
+	for _, c := range plan.Changes {
+		planned[c.key()] = true
+	}
+
+	verified := make(map[string][]*PlannedChange)
+	for owner, changes := range current {
+		for _, c := range changes {
+			if planned[c.key()] {
+				verified[owner] = append(verified[owner], c)
+				delete(planned, c.key())
+			}
+		}
+	}
+	for key := range planned {
+		log.Printf("Skipping %s, it no longer matches the plan\n", key)
+	}
+
+	verified = holdFrozenDeletions(verified, time.Now())
+	verified, awaiting := requireApproval(plan.Policy.Approval, verified)
+	allowed, held := enforceLimits(plan.Policy.Limits, verified, totals)
+	for owner, changes := range allowed {
+		log.Println("Applying plan in", owner)
+		applyChanges(mngr, owner, changes)
+	}
+	logAwaitingApproval(awaiting)
+	logHeldBack(held)
+}
+
+// planChanges works out the changes for a plan's command in every
+// account, without making them. The number of resources in every account
+// is returned as well.
+func planChanges(mngr cloud.ResourceManager, plan *Plan, accounts map[string]policy.Account) (map[string][]*PlannedChange, map[string]int) {
+	allResources := mngr.AllResourcesPerAccount()
+	allBuckets := mngr.BucketsPerAccount()
+	changes := make(map[string][]*PlannedChange)
+	totals := make(map[string]int)
+	for owner, res := range allResources {
+		totals[owner] = len(allOf(res, allBuckets[owner]))
+		accountPolicy := resolvePolicy(plan.Policy, accounts, owner)
+		if plan.Command == PlanMark {
+			changes[owner] = planMarks(owner, res, allBuckets[owner], accountPolicy)
+		} else {
+			changes[owner] = planDeletes(owner, res, allBuckets[owner], accountPolicy)
+		}
+	}
+	return changes, totals
+}
+
+// planMarks works out which resources in an account should be warned
+// about, tagged or marked for deletion by the rules of a policy. If
+// several delete rules match a resource, the shortest grace period is
+// used. Resources without a lifetime or expiry tag are marked as well once
+// they're older than the default lifetime of the policy, if it has one.
+// Resources are only marked if the accumulated cost of all of them
+// exceeds the cost threshold of the policy.
+func planMarks(owner string, res *cloud.ResourceCollection, buckets []cloud.Bucket, pol *policy.Policy) []*PlannedChange {
+	changes := []*PlannedChange{}
+	marks := make(map[cloud.Resource]*PlannedChange)
+	reasons := make(map[cloud.Resource][]string)
+	marked := []cloud.Resource{}
+	totalCost := 0.0
+
+	mark := func(r cloud.Resource, gracePeriodDays int, reason string) {
+		m, ok := marks[r]
+		if !ok {
+			m = newChange(owner, r, ActionMark, "")
+			m.GracePeriodDays = gracePeriodDays
+			m.EstimatedSavings = monthlyCost(r)
+			marks[r] = m
+			marked = append(marked, r)
+			totalCost += billing.AccumulatedCost(r)
+		}
+		if gracePeriodDays < m.GracePeriodDays {
+			m.GracePeriodDays = gracePeriodDays
+		}
+		reasons[r] = append(reasons[r], reason)
+	}
+
+	for _, rule := range pol.Rules {
+		matching, traces := matchingResources(rule, res, buckets)
+		for _, r := range matching {
+			switch rule.Action {
+			case policy.ActionWarn:
+				changes = append(changes, newChange(owner, r, ActionWarn, traces[r].Reason()))
+			case policy.ActionTag:
+				c := newChange(owner, r, ActionTag, traces[r].Reason())
+				c.TagKey, c.TagValue = rule.TagKey, rule.TagValue
+				changes = append(changes, c)
+			case policy.ActionDelete:
+				mark(r, rule.GracePeriodDays, traces[r].Reason())
+			}
+		}
+	}
+	if pol.DefaultLifetimeDays > 0 {
+		lifetimeFilter := defaultLifetimeExceeded(pol.DefaultLifetimeDays)
+		for _, r := range allOf(res, buckets) {
+			if included, trace := lifetimeFilter.Explain(r); included {
+				mark(r, defaultGracePeriodDays, trace.Reason())
+			}
+		}
+	}
+
+	if totalCost < pol.CostThreshold {
+		log.Printf("%s: Skipping the tagging of resources, total cost $%.2f is less than $%.2f", owner, totalCost, pol.CostThreshold)
+		return changes
+	}
+	for _, r := range marked {
+		marks[r].Reason = strings.Join(reasons[r], "; ")
+		changes = append(changes, marks[r])
+	}
+	return changes
+}
+
+// planDeletes works out which resources in an account should be deleted,
+// because their lifetime, expiry or delete-at time has passed.
+func planDeletes(owner string, res *cloud.ResourceCollection, buckets []cloud.Bucket, pol *policy.Policy) []*PlannedChange {
+	expiredFilter := filter.Or(
+		filter.Named("lifetime exceeded", filter.LifetimeExceeded()),
+		filter.Named("expiry passed", filter.ExpiryDatePassed()),
+		filter.Named("delete-at passed", filter.DeleteAtPassed()),
+	)
+	changes := []*PlannedChange{}
+	for _, r := range allOf(res, buckets) {
+		included, trace := expiredFilter.Explain(r)
+		if !included {
+			continue
+		}
+		reason := trace.Reason()
+		if deleteReason, exist := filter.TagValue(r, filter.DeleteReasonTagKey); exist {
+			reason = fmt.Sprintf("%s (%s)", reason, deleteReason)
+		}
+		c := newChange(owner, r, ActionDelete, reason)
+		c.EstimatedSavings = monthlyCost(r)
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// defaultLifetimeExceeded matches resources without a lifetime, expiry or
+// release tag that are older than the default lifetime of a policy.
+// Resources that are already marked, attached volumes, running instances
+// and snapshots used by an image are left alone.
+func defaultLifetimeExceeded(days int) *filter.ResourceFilter {
+	name := fmt.Sprintf("default lifetime of %d days exceeded", days)
+	return filter.Named(name, filter.And(
+		filter.Negate(filter.HasTag(filter.LifetimeTagKey)),
+		filter.Negate(filter.HasTag(filter.ExpiryTagKey)),
+		filter.Negate(filter.HasTag(filter.ReleaseTagKey)),
+		filter.Negate(filter.HasTag(filter.DeleteTagKey)),
+		filter.OlderThanXDays(days),
+		filter.IsUnattached(),
+		filter.Not(filter.IsRunning()),
+		filter.IsNotInUse(),
+	))
+}
+
+// applyChanges makes the planned changes in an account. Deletions are
+// made in bulk, one kind of resource at a time.
+func applyChanges(mngr cloud.ResourceManager, owner string, changes []*PlannedChange) {
+	toDelete := &cloud.ResourceCollection{Owner: owner}
+	bucketsToDelete := []cloud.Bucket{}
+	for _, c := range changes {
+		r := c.resource
+		switch c.Action {
+		case ActionWarn:
+			log.Printf("%s: %s matches %s\n", owner, r.ID(), c.Reason)
+		case ActionTag:
+			err := r.SetTag(c.TagKey, c.TagValue, true)
+			if err != nil {
+				log.Printf("%s: Failed to tag %s with %s: %s\n", owner, r.ID(), c.TagKey, err)
+			} else {
+				log.Printf("%s: Tagged %s with %s=%s\n", owner, r.ID(), c.TagKey, c.TagValue)
+			}
+		case ActionMark:
+			timeToDelete, err := markForDeletion(r, time.Now().AddDate(0, 0, c.GracePeriodDays), c.Reason)
+			if err != nil {
+				log.Printf("%s: Failed to tag %s for deletion: %s\n", owner, r.ID(), err)
+			} else {
+				log.Printf("%s: Marked %s for deletion at %s (%s)\n", owner, r.ID(), timeToDelete, c.Reason)
+			}
+		case ActionDelete:
+			switch r := r.(type) {
+			case cloud.Instance:
+				toDelete.Instances = append(toDelete.Instances, r)
+			case cloud.Image:
+				toDelete.Images = append(toDelete.Images, r)
+			case cloud.Volume:
+				toDelete.Volumes = append(toDelete.Volumes, r)
+			case cloud.Snapshot:
+				toDelete.Snapshots = append(toDelete.Snapshots, r)
+			case cloud.Bucket:
+				bucketsToDelete = append(bucketsToDelete, r)
+			}
+		}
+	}
+
+	if len(toDelete.Instances) > 0 {
+		if err := mngr.CleanupInstances(toDelete.Instances); err != nil {
+			log.Printf("Could not cleanup instances in %s, err:\n%s", owner, err)
+		}
+	}
+	if len(toDelete.Images) > 0 {
+		if err := mngr.CleanupImages(toDelete.Images); err != nil {
+			log.Printf("Could not cleanup images in %s, err:\n%s", owner, err)
+		}
+	}
+	if len(toDelete.Volumes) > 0 {
+		if err := mngr.CleanupVolumes(toDelete.Volumes); err != nil {
+			log.Printf("Could not cleanup volumes in %s, err:\n%s", owner, err)
+		}
+	}
+	if len(toDelete.Snapshots) > 0 {
+		if err := mngr.CleanupSnapshots(toDelete.Snapshots); err != nil {
+			log.Printf("Could not cleanup snapshots in %s, err:\n%s", owner, err)
+		}
+	}
+	if len(bucketsToDelete) > 0 {
+		if err := mngr.CleanupBuckets(bucketsToDelete); err != nil {
+			log.Printf("Could not cleanup buckets in %s, err:\n%s", owner, err)
+		}
+	}
+}
+
+func newChange(owner string, r cloud.Resource, action, reason string) *PlannedChange {
+	return &PlannedChange{
+		Account:  owner,
+		Kind:     policy.KindOf(r),
+		ID:       r.ID(),
+		Location: r.Location(),
+		Action:   action,
+		Reason:   reason,
+		resource: r,
+	}
+}
+
+// monthlyCost estimates how much a resource costs per month to keep
+func monthlyCost(r cloud.Resource) float64 {
+	return billing.ResourceCostPerDay(r) * 30.0
+}
+
+// allOf returns all resources in a collection, and the buckets of the
+// same account
+func allOf(res *cloud.ResourceCollection, buckets []cloud.Bucket) []cloud.Resource {
+	all := []cloud.Resource{}
+	for _, r := range res.Instances {
+		all = append(all, r)
+	}
+	for _, r := range res.Volumes {
+		all = append(all, r)
+	}
+	for _, r := range res.Snapshots {
+		all = append(all, r)
+	}
+	for _, r := range res.Images {
+		all = append(all, r)
+	}
+	for _, r := range buckets {
+		all = append(all, r)
+	}
+	return all
+}
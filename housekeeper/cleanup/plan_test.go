@@ -0,0 +1,183 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	"brkt/cloudsweeper/housekeeper/policy"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testManager manages the volumes and images of a single account, and
+// records which of them were deleted
+type testManager struct {
+	owner         string
+	volumes       []cloud.Volume
+	deleted       []cloud.Volume
+	images        []cloud.Image
+	deletedImages []cloud.Image
+}
+
+func (m *testManager) Owners() []string { return []string{m.owner} }
+func (m *testManager) BucketsPerAccount() map[string][]cloud.Bucket {
+	return map[string][]cloud.Bucket{}
+}
+func (m *testManager) InstancesPerAccount() map[string][]cloud.Instance {
+	return map[string][]cloud.Instance{}
+}
+func (m *testManager) ImagesPerAccount() map[string][]cloud.Image {
+	return map[string][]cloud.Image{m.owner: m.images}
+}
+func (m *testManager) VolumesPerAccount() map[string][]cloud.Volume {
+	return map[string][]cloud.Volume{m.owner: m.volumes}
+}
+func (m *testManager) SnapshotsPerAccount() map[string][]cloud.Snapshot {
+	return map[string][]cloud.Snapshot{}
+}
+func (m *testManager) AllResourcesPerAccount() map[string]*cloud.ResourceCollection {
+	return map[string]*cloud.ResourceCollection{m.owner: {Owner: m.owner, Volumes: m.volumes}}
+}
+func (m *testManager) CleanupInstances([]cloud.Instance) error { return nil }
+func (m *testManager) CleanupSnapshots([]cloud.Snapshot) error { return nil }
+func (m *testManager) CleanupBuckets([]cloud.Bucket) error     { return nil }
+func (m *testManager) CleanupImages(images []cloud.Image) error {
+	m.deletedImages = append(m.deletedImages, images...)
+	return nil
+}
+func (m *testManager) CleanupVolumes(volumes []cloud.Volume) error {
+	m.deleted = append(m.deleted, volumes...)
+	return nil
+}
+
+// zonedVolume is a volume in a specific zone, since GCP disk names are
+// only unique within a zone
+type zonedVolume struct {
+	testVolume
+	zone string
+}
+
+func (v *zonedVolume) Location() string { return v.zone }
+
+func testPlanPolicy(t *testing.T) *policy.Policy {
+	pol, err := policy.Parse([]byte(`{
+		"rules": [{
+			"name": "ci",
+			"kinds": ["volume"],
+			"action": "delete",
+			"grace_period_days": 2,
+			"conditions": [{"rule": "tag_equals", "key": "env", "value": "ci"}]
+		}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pol
+}
+
+func TestMakePlan(t *testing.T) {
+	mngr := &testManager{owner: "111", volumes: []cloud.Volume{
+		&testVolume{"vol-1", "111", map[string]string{"env": "ci"}},
+		&testVolume{"vol-2", "111", map[string]string{"env": "prod"}},
+	}}
+	pol := testPlanPolicy(t)
+	if _, err := MakePlan(mngr, cloud.AWS, "reset", pol, nil); err == nil {
+		t.Error("Plans can only be made for marking and cleanup")
+	}
+	plan, err := MakePlan(mngr, cloud.AWS, PlanMark, pol, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 1 {
+		t.Fatalf("Expected 1 planned change, got %d", len(plan.Changes))
+	}
+	c := plan.Changes[0]
+	if c.ID != "vol-1" || c.Action != ActionMark || c.GracePeriodDays != 2 || c.Location != "us-west-2" {
+		t.Errorf("Unexpected planned change %+v", c)
+	}
+	if _, marked := mngr.volumes[0].Tags()[filter.DeleteTagKey]; marked {
+		t.Error("Making a plan should not touch any resources")
+	}
+
+	dir, err := ioutil.TempDir("", "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "plan.json")
+	if err = plan.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadPlan(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Command != PlanMark || len(read.Changes) != 1 || read.Changes[0].key() != c.key() {
+		t.Errorf("Plan was not read back as written: %+v", read)
+	}
+	if read.Policy.Rules[0].Filter() == nil {
+		t.Error("The policy of a plan should be compiled when it's read")
+	}
+}
+
+func TestApplyPlan(t *testing.T) {
+	expired := func() map[string]string {
+		return map[string]string{filter.DeleteTagKey: time.Now().AddDate(0, 0, -1).Format(time.RFC3339)}
+	}
+	zoneA := &zonedVolume{testVolume{"disk-1", "111", expired()}, "us-central1-a"}
+	zoneB := &zonedVolume{testVolume{"disk-1", "111", expired()}, "us-central1-b"}
+	reset := &testVolume{"vol-2", "111", expired()}
+	// The disk in zone b is listed first, so it would be taken for the
+	// planned one if the zone wasn't part of the key
+	mngr := &testManager{owner: "111", volumes: []cloud.Volume{zoneB, zoneA, reset}}
+
+	plan, err := MakePlan(mngr, cloud.GCP, PlanCleanup, testPlanPolicy(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 3 {
+		t.Fatalf("Expected 3 planned deletions, got %d", len(plan.Changes))
+	}
+	// The reviewer keeps the disk in one zone out of the plan
+	kept := []*PlannedChange{}
+	for _, c := range plan.Changes {
+		if c.Location != "us-central1-b" {
+			kept = append(kept, c)
+		}
+	}
+	plan.Changes = kept
+	// and the other volume is reset before the plan is applied
+	delete(reset.tags, filter.DeleteTagKey)
+
+	ApplyPlan(mngr, plan, nil)
+	if len(mngr.deleted) != 1 || mngr.deleted[0] != zoneA {
+		t.Errorf("Only the planned disk that still matches should be deleted, got %v", mngr.deleted)
+	}
+}
+
+func TestDefaultLifetime(t *testing.T) {
+	pol := testPlanPolicy(t)
+	pol.DefaultLifetimeDays = 30
+	untagged := &testVolume{"vol-1", "111", map[string]string{}}
+	attached := &attachedVolume{testVolume{"vol-2", "111", map[string]string{}}}
+	withLifetime := &testVolume{"vol-3", "111", map[string]string{filter.LifetimeTagKey: "lifetime-90days"}}
+	res := &cloud.ResourceCollection{Owner: "111", Volumes: []cloud.Volume{untagged, attached, withLifetime}}
+
+	marks := planMarks("111", res, nil, pol)
+	if len(marks) != 1 {
+		t.Fatalf("Expected only the unattached volume without a lifetime to be marked, got %d changes", len(marks))
+	}
+	c := marks[0]
+	if c.ID != "vol-1" || c.Action != ActionMark || c.GracePeriodDays != defaultGracePeriodDays {
+		t.Errorf("Unexpected planned change %+v", c)
+	}
+
+	if deletes := planDeletes("111", res, nil, pol); len(deletes) != 0 {
+		t.Errorf("Resources past the default lifetime should be marked before they're deleted, got %d deletions", len(deletes))
+	}
+}
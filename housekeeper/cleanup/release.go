@@ -0,0 +1,145 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	"brkt/cloudsweeper/housekeeper/audit"
+	"brkt/cloudsweeper/housekeeper/policy"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// releaseTransition is a release image entering a stage of the lifecycle
+type releaseTransition struct {
+	image cloud.Image
+	stage string
+}
+
+// advanceReleaseImages moves release images through the release
+// lifecycle, in all accounts and projects it lists. The images due to be
+// deleted are not deleted, but returned as planned deletions.
+func advanceReleaseImages(release *policy.Release) []*managedChanges {
+	deletions := []*managedChanges{}
+	if len(release.Stages) == 0 {
+		return deletions
+	}
+	if len(release.AWSAccounts) > 0 {
+		if d := advanceReleaseImagesIn(cloud.AWS, release.AWSAccounts, release); d != nil {
+			deletions = append(deletions, d)
+		}
+	}
+	if len(release.GCPProjects) > 0 {
+		if d := advanceReleaseImagesIn(cloud.GCP, release.GCPProjects, release); d != nil {
+			deletions = append(deletions, d)
+		}
+	}
+	return deletions
+}
+
+func advanceReleaseImagesIn(csp cloud.CSP, accounts []string, release *policy.Release) *managedChanges {
+	mngr, err := cloud.NewManager(csp, accounts...)
+	if err != nil {
+		log.Printf("Could not initalize resource manager for release image cleanup: %s", err)
+		return nil
+	}
+	return planReleaseDeletions(audit.Wrap(mngr), release, time.Now())
+}
+
+// planReleaseDeletions moves the release images of a resource manager
+// into their next stage, and plans the deletion of those that enter the
+// deleted stage
+func planReleaseDeletions(mngr cloud.ResourceManager, release *policy.Release, now time.Time) *managedChanges {
+	deletions := &managedChanges{mngr, make(map[string][]*PlannedChange), make(map[string]int)}
+	for owner, images := range mngr.ImagesPerAccount() {
+		log.Println("Performing release image cleanup in", owner)
+		deletions.totals[owner] = len(images)
+		for _, t := range releaseTransitions(release, images, now) {
+			if t.stage == policy.StageDeleted {
+				c := newChange(owner, t.image, ActionDelete, "release image in the deleted stage")
+				c.EstimatedSavings = monthlyCost(t.image)
+				deletions.changes[owner] = append(deletions.changes[owner], c)
+				continue
+			}
+			if err := enterReleaseStage(t.image, t.stage, now); err != nil {
+				log.Printf("Failed to move release image %s to the %s stage: %s\n", t.image.ID(), t.stage, err)
+			} else {
+				log.Printf("Moved release image %s to the %s stage\n", t.image.ID(), t.stage)
+			}
+		}
+	}
+	return deletions
+}
+
+// releaseTransitions works out which release images should enter their
+// next stage. Images only move one stage at a time, so that every stage
+// lasts at least as long as configured. Private images don't enter the
+// lifecycle if it's only for public images.
+func releaseTransitions(release *policy.Release, images []cloud.Image, now time.Time) []releaseTransition {
+	transitions := []releaseTransition{}
+	for _, img := range images {
+		if !release.Selects(img) {
+			continue
+		}
+		stage, since := releaseStage(img)
+		if stage == "" && release.PublicOnly && !img.Public() {
+			continue
+		}
+		next := release.Next(stage)
+		if next == nil || now.Before(since.AddDate(0, 0, next.AfterDays)) {
+			continue
+		}
+		transitions = append(transitions, releaseTransition{img, next.Stage})
+	}
+	return transitions
+}
+
+// enterReleaseStage makes the changes to an image that a stage requires,
+// and records the stage in its release stage tag
+func enterReleaseStage(img cloud.Image, stage string, now time.Time) error {
+	var err error
+	switch stage {
+	case policy.StagePrivate:
+		err = img.MakePrivate()
+	case policy.StageDeprecated:
+		err = img.Deprecate(cloud.ImageStateDeprecated)
+	case policy.StageObsolete:
+		err = img.Deprecate(cloud.ImageStateObsolete)
+	default:
+		err = fmt.Errorf("unknown stage \"%s\"", stage)
+	}
+	if err != nil {
+		return err
+	}
+	return img.SetTag(filter.ReleaseStageTagKey, formatReleaseStage(stage, now), true)
+}
+
+// releaseStage returns the stage of the release lifecycle an image is in,
+// and when it entered that stage. Images without a valid release stage
+// tag haven't entered any stage, and are treated as if they entered the
+// lifecycle when they were created.
+func releaseStage(img cloud.Image) (string, time.Time) {
+	value, exist := filter.TagValue(img, filter.ReleaseStageTagKey)
+	if !exist {
+		return "", img.CreationTime()
+	}
+	parts := strings.SplitN(value, ";", 2)
+	if len(parts) != 2 {
+		return "", img.CreationTime()
+	}
+	since, err := time.Parse(time.RFC3339, parts[1])
+	if err != nil {
+		return "", img.CreationTime()
+	}
+	return parts[0], since
+}
+
+// formatReleaseStage formats the value of a release stage tag, such as
+// "private;2018-01-29T12:00:00Z"
+func formatReleaseStage(stage string, since time.Time) string {
+	return fmt.Sprintf("%s;%s", stage, since.UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	"brkt/cloudsweeper/housekeeper/policy"
+	"testing"
+	"time"
+)
+
+type testImage struct {
+	testVolume
+	created time.Time
+	public  bool
+}
+
+func (i *testImage) CreationTime() time.Time      { return i.created }
+func (i *testImage) Public() bool                 { return i.public }
+func (i *testImage) Encryptable() bool            { return true }
+func (i *testImage) Name() string                 { return i.id }
+func (i *testImage) BackingSnapshotIDs() []string { return nil }
+func (i *testImage) DeprecationState() string     { return cloud.ImageStateActive }
+func (i *testImage) MakePrivate() error           { return nil }
+func (i *testImage) Deprecate(state string) error { return nil }
+
+func releaseImage(id string, created time.Time, stage string, since time.Time) *testImage {
+	img := &testImage{testVolume{id, "111", map[string]string{filter.ReleaseTagKey: "2018.1"}}, created, false}
+	if stage != "" {
+		img.tags[filter.ReleaseStageTagKey] = formatReleaseStage(stage, since)
+	}
+	return img
+}
+
+func TestReleaseTransitions(t *testing.T) {
+	now := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	release := &policy.Release{Stages: []*policy.Stage{
+		{Stage: policy.StagePrivate, AfterDays: 90},
+		{Stage: policy.StageDeprecated, AfterDays: 30},
+		{Stage: policy.StageDeleted, AfterDays: 60},
+	}}
+	notReleased := releaseImage("img-0", now.AddDate(-1, 0, 0), "", now)
+	delete(notReleased.tags, filter.ReleaseTagKey)
+	images := []cloud.Image{
+		notReleased,
+		releaseImage("img-1", now.AddDate(0, 0, -10), "", now),
+		// Images move one stage at a time, however old they are
+		releaseImage("img-2", now.AddDate(-2, 0, 0), "", now),
+		releaseImage("img-3", now.AddDate(-1, 0, 0), policy.StagePrivate, now.AddDate(0, 0, -10)),
+		releaseImage("img-4", now.AddDate(-1, 0, 0), policy.StagePrivate, now.AddDate(0, 0, -31)),
+		releaseImage("img-5", now.AddDate(-1, 0, 0), policy.StageDeprecated, now.AddDate(0, 0, -61)),
+		// Stages no longer in the lifecycle are followed by the next one
+		releaseImage("img-6", now.AddDate(-1, 0, 0), policy.StageObsolete, now.AddDate(0, 0, -61)),
+	}
+	expected := map[string]string{
+		"img-2": policy.StagePrivate,
+		"img-4": policy.StageDeprecated,
+		"img-5": policy.StageDeleted,
+		"img-6": policy.StageDeleted,
+	}
+
+	transitions := releaseTransitions(release, images, now)
+	if len(transitions) != len(expected) {
+		t.Errorf("Expected %d transitions, got %d", len(expected), len(transitions))
+	}
+	for _, tr := range transitions {
+		if expected[tr.image.ID()] != tr.stage {
+			t.Errorf("%s should not enter the %s stage", tr.image.ID(), tr.stage)
+		}
+	}
+
+	release.TagValue = "2017.4"
+	if transitions := releaseTransitions(release, images, now); len(transitions) != 0 {
+		t.Error("Only images with the release tag value should be selected")
+	}
+}
+
+func TestDefaultReleaseOnlyPublic(t *testing.T) {
+	now := time.Now()
+	private := releaseImage("img-1", now.AddDate(-1, 0, 0), "", now)
+	public := releaseImage("img-2", now.AddDate(-1, 0, 0), "", now)
+	public.public = true
+	// Images made private by the lifecycle still go through the rest of it
+	madePrivate := releaseImage("img-3", now.AddDate(-2, 0, 0), policy.StagePrivate, now.AddDate(0, 0, -181))
+
+	transitions := releaseTransitions(policy.DefaultRelease(), []cloud.Image{private, public, madePrivate}, now)
+	if len(transitions) != 2 {
+		t.Fatalf("Expected 2 transitions, got %d", len(transitions))
+	}
+	for _, tr := range transitions {
+		if tr.image == private {
+			t.Error("Images that were always private should not enter the default lifecycle")
+		}
+	}
+}
+
+func TestReleaseDeletionsWithinLimits(t *testing.T) {
+	now := time.Now()
+	old := now.AddDate(0, 0, -400)
+	mngr := &testManager{owner: "111", images: []cloud.Image{
+		releaseImage("img-1", old, policy.StagePrivate, now.AddDate(0, 0, -200)),
+		releaseImage("img-2", old, policy.StagePrivate, now.AddDate(0, 0, -200)),
+		releaseImage("img-3", old, "", now),
+	}}
+	release := &policy.Release{Stages: []*policy.Stage{
+		{Stage: policy.StagePrivate, AfterDays: 180},
+		{Stage: policy.StageDeleted, AfterDays: 180},
+	}}
+
+	deletions := planReleaseDeletions(mngr, release, now)
+	if len(mngr.deletedImages) != 0 {
+		t.Fatal("Release images should only be deleted once the deletions are allowed")
+	}
+	if stage, _ := releaseStage(mngr.images[2]); stage != policy.StagePrivate {
+		t.Errorf("Expected img-3 to enter the private stage, got %q", stage)
+	}
+	if len(deletions.changes["111"]) != 2 || deletions.totals["111"] != 3 {
+		t.Fatalf("Expected 2 of 3 images to be planned for deletion, got %v", deletions.changes)
+	}
+
+	pol := &policy.Policy{Limits: &policy.Limits{MaxDeletions: 1}}
+	applyAllowedChanges(pol, []*managedChanges{deletions})
+	if len(mngr.deletedImages) != 1 {
+		t.Errorf("Expected the limits to allow 1 release image deletion, got %d", len(mngr.deletedImages))
+	}
+
+	mngr.deletedImages = nil
+	pol = &policy.Policy{Approval: &policy.Approval{MinAgeDays: 30}}
+	applyAllowedChanges(pol, []*managedChanges{planReleaseDeletions(mngr, release, now)})
+	if len(mngr.deletedImages) != 0 {
+		t.Error("Release image deletions that need approval should be held back")
+	}
+}
+
+func TestEnterReleaseStage(t *testing.T) {
+	now := time.Now()
+	img := releaseImage("img-1", now.AddDate(-1, 0, 0), "", now)
+	if err := enterReleaseStage(img, policy.StageDeprecated, now); err != nil {
+		t.Fatal(err)
+	}
+	stage, since := releaseStage(img)
+	if stage != policy.StageDeprecated || since.Unix() != now.Unix() {
+		t.Errorf("Expected the deprecated stage since %s, got %s since %s", now, stage, since)
+	}
+
+	img.tags[filter.ReleaseStageTagKey] = "private"
+	if stage, since := releaseStage(img); stage != "" || !since.Equal(img.CreationTime()) {
+		t.Error("A malformed release stage tag should be ignored")
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	"brkt/cloudsweeper/housekeeper/policy"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ResetScope selects the resources ResetHousekeeper removes tags from.
+// Fields that are left empty select everything, so the zero value resets
+// every resource marked for deletion.
+type ResetScope struct {
+	Accounts    []string
+	ResourceIDs []string
+	Kinds       []string
+	// MarkedAfter only selects resources marked for deletion after this
+	// time. Resources marked before housekeeper started recording when
+	// they were marked are never selected.
+	MarkedAfter time.Time
+	// ClearLifetime also removes lifetime and expiry tags, from the
+	// selected resources and from resources that only have those tags
+	ClearLifetime bool
+}
+
+// Validate checks that the kinds of the scope are valid
+func (s ResetScope) Validate() error {
+	for _, kind := range s.Kinds {
+		if !policy.IsKind(kind) {
+			return fmt.Errorf("Invalid resource kind \"%s\"", kind)
+		}
+	}
+	return nil
+}
+
+func (s ResetScope) selects(r cloud.Resource) bool {
+	if len(s.Accounts) > 0 && !containsString(s.Accounts, r.Owner()) {
+		return false
+	}
+	if len(s.ResourceIDs) > 0 && !containsString(s.ResourceIDs, r.ID()) {
+		return false
+	}
+	if len(s.Kinds) > 0 && !containsString(s.Kinds, policy.KindOf(r)) {
+		return false
+	}
+	marked := filter.HasTag(filter.DeleteTagKey)(r)
+	if !s.MarkedAfter.IsZero() {
+		markedAt, exist, err := filter.MarkedTime(r)
+		return marked && exist && err == nil && markedAt.After(s.MarkedAfter)
+	}
+	if marked {
+		return true
+	}
+	return s.ClearLifetime && (filter.HasTag(filter.LifetimeTagKey)(r) || filter.HasTag(filter.ExpiryTagKey)(r))
+}
+
+// tagKeys returns the keys of the tags a reset removes
+func (s ResetScope) tagKeys() []string {
+	keys := []string{filter.DeleteTagKey, filter.DeleteReasonTagKey, filter.MarkedAtTagKey, filter.PostponedTagKey}
+	if s.ClearLifetime {
+		keys = append(keys, filter.LifetimeTagKey, filter.ExpiryTagKey)
+	}
+	return keys
+}
+
+// ResetHousekeeper will remove the tags marking resources for deletion
+// from all resources selected by the scope, so that a bad marking run can
+// be rolled back. Buckets are reset as well. With dryRun set no tags are
+// removed, the resources that would be reset are only logged.
+func ResetHousekeeper(mngr cloud.ResourceManager, scope ResetScope, dryRun bool) {
+	allResources := mngr.AllResourcesPerAccount()
+	allBuckets := map[string][]cloud.Bucket{}
+	if len(scope.Kinds) == 0 || containsString(scope.Kinds, policy.KindBucket) {
+		allBuckets = mngr.BucketsPerAccount()
+	}
+	owners := []string{}
+	for owner := range allResources {
+		owners = append(owners, owner)
+	}
+	for owner := range allBuckets {
+		if _, ok := allResources[owner]; !ok {
+			owners = append(owners, owner)
+		}
+	}
+
+	for _, owner := range owners {
+		if len(scope.Accounts) > 0 && !containsString(scope.Accounts, owner) {
+			continue
+		}
+		log.Println("Resetting housekeeper tags in", owner)
+		res, ok := allResources[owner]
+		if !ok {
+			res = &cloud.ResourceCollection{}
+		}
+		reset := 0
+		for _, r := range allOf(res, allBuckets[owner]) {
+			if !scope.selects(r) {
+				continue
+			}
+			if dryRun {
+				log.Printf("Would remove housekeeper tags on %s\n", r.ID())
+				reset++
+				continue
+			}
+			if err := removeTags(r, scope.tagKeys()...); err != nil {
+				log.Printf("Failed to remove tags on %s: %s\n", r.ID(), err)
+			} else {
+				log.Printf("Removed housekeeper tags on %s\n", r.ID())
+				reset++
+			}
+		}
+		if dryRun {
+			log.Printf("%s: Would reset %d resources\n", owner, reset)
+		} else {
+			log.Printf("%s: Reset %d resources\n", owner, reset)
+		}
+	}
+}
+
+// removeTags removes tags from a resource, ignoring the case of the keys.
+// Legacy keys of the tags are removed as well.
+func removeTags(r cloud.Resource, tagKeys ...string) error {
+	remove := map[string]bool{}
+	for _, tagKey := range tagKeys {
+		remove[strings.ToLower(tagKey)] = true
+		for _, legacy := range filter.LegacyKeys(tagKey) {
+			remove[strings.ToLower(legacy)] = true
+		}
+	}
+	keys := []string{}
+	for key := range r.Tags() {
+		if remove[strings.ToLower(key)] {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		if err := r.RemoveTag(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	"brkt/cloudsweeper/housekeeper/policy"
+	"testing"
+	"time"
+)
+
+type testVolume struct {
+	id    string
+	owner string
+	tags  map[string]string
+}
+
+func (v *testVolume) CSP() cloud.CSP          { return cloud.AWS }
+func (v *testVolume) Owner() string           { return v.owner }
+func (v *testVolume) ID() string              { return v.id }
+func (v *testVolume) Tags() map[string]string { return v.tags }
+func (v *testVolume) Location() string        { return "us-west-2" }
+func (v *testVolume) Public() bool            { return false }
+func (v *testVolume) CreationTime() time.Time { return time.Now().AddDate(0, 0, -60) }
+func (v *testVolume) SizeGB() int64           { return 100 }
+func (v *testVolume) Attached() bool          { return false }
+func (v *testVolume) Encrypted() bool         { return true }
+func (v *testVolume) VolumeType() string      { return "gp2" }
+func (v *testVolume) Cleanup() error          { return nil }
+
+func (v *testVolume) SetTag(key, value string, overwrite bool) error {
+	v.tags[key] = value
+	return nil
+}
+
+func (v *testVolume) RemoveTag(key string) error {
+	delete(v.tags, key)
+	return nil
+}
+
+func markedVolume(id, owner string, markedAt time.Time) *testVolume {
+	return &testVolume{id, owner, map[string]string{
+		filter.DeleteTagKey:       markedAt.AddDate(0, 0, 4).Format(time.RFC3339),
+		filter.DeleteReasonTagKey: "unattached",
+		filter.MarkedAtTagKey:     markedAt.Format(time.RFC3339),
+	}}
+}
+
+func TestResetScope(t *testing.T) {
+	badRun := time.Date(2018, 1, 29, 12, 0, 0, 0, time.UTC)
+	early := markedVolume("vol-1", "111", badRun.AddDate(0, 0, -7))
+	late := markedVolume("vol-2", "111", badRun.Add(time.Hour))
+	other := markedVolume("vol-3", "222", badRun.Add(time.Hour))
+	unknown := &testVolume{"vol-4", "111", map[string]string{filter.DeleteTagKey: "2018-02-02T00:00:00Z"}}
+	lifetime := &testVolume{"vol-5", "111", map[string]string{filter.LifetimeTagKey: "days-10"}}
+	all := []*testVolume{early, late, other, unknown, lifetime}
+
+	cases := []struct {
+		scope    ResetScope
+		selected []string
+	}{
+		{ResetScope{}, []string{"vol-1", "vol-2", "vol-3", "vol-4"}},
+		{ResetScope{Accounts: []string{"222"}}, []string{"vol-3"}},
+		{ResetScope{ResourceIDs: []string{"vol-1", "vol-5"}}, []string{"vol-1"}},
+		{ResetScope{Kinds: []string{policy.KindSnapshot}}, []string{}},
+		{ResetScope{MarkedAfter: badRun}, []string{"vol-2", "vol-3"}},
+		{ResetScope{MarkedAfter: badRun, Accounts: []string{"111"}}, []string{"vol-2"}},
+		{ResetScope{ClearLifetime: true}, []string{"vol-1", "vol-2", "vol-3", "vol-4", "vol-5"}},
+	}
+	for _, c := range cases {
+		selected := []string{}
+		for _, v := range all {
+			if c.scope.selects(v) {
+				selected = append(selected, v.ID())
+			}
+		}
+		if len(selected) != len(c.selected) {
+			t.Errorf("Scope %+v selected %v, expected %v", c.scope, selected, c.selected)
+			continue
+		}
+		for i := range selected {
+			if selected[i] != c.selected[i] {
+				t.Errorf("Scope %+v selected %v, expected %v", c.scope, selected, c.selected)
+				break
+			}
+		}
+	}
+
+	if err := (ResetScope{Kinds: []string{"volumes"}}).Validate(); err == nil {
+		t.Error("Invalid kinds should not be accepted")
+	}
+}
+
+func TestRemoveTags(t *testing.T) {
+	v := markedVolume("vol-1", "111", time.Now())
+	v.tags["Housekeeper-Expiry"] = "2018-01-29"
+	v.tags["env"] = "ci"
+
+	scope := ResetScope{}
+	if err := removeTags(v, scope.tagKeys()...); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.tags) != 2 {
+		t.Errorf("Only the cleanup tags should be removed, got %v", v.tags)
+	}
+
+	scope.ClearLifetime = true
+	if err := removeTags(v, scope.tagKeys()...); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.tags) != 1 || v.tags["env"] != "ci" {
+		t.Errorf("Expiry tags should be removed regardless of case, got %v", v.tags)
+	}
+}
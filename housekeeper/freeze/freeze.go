@@ -0,0 +1,255 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package freeze keeps the change-freeze calendar, the windows such as
+// release weeks and company holidays when housekeeper must not delete or
+// stop anything. The calendar is read from an iCalendar (.ics) file, where
+// every event is a freeze window, so it can be exported from any shared
+// calendar.
+package freeze
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Window is a period when nothing may be deleted or stopped. The end is
+// not part of the window.
+type Window struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+}
+
+// Contains checks if a time is within the window
+func (w Window) Contains(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("%s (%s - %s)", w.Name, w.Start.Format(time.RFC3339), w.End.Format(time.RFC3339))
+}
+
+// Calendar is a list of freeze windows, sorted by when they start
+type Calendar struct {
+	Windows []Window
+}
+
+// calendar is the calendar consulted by At and Postpone
+var calendar = &Calendar{}
+
+// SetCalendar sets the calendar consulted by At and Postpone
+func SetCalendar(c *Calendar) {
+	calendar = c
+}
+
+// At returns the freeze window the specified time is within, if any
+func At(t time.Time) (Window, bool) {
+	return calendar.At(t)
+}
+
+// Postpone moves a time out of any freeze, see Calendar.Postpone
+func Postpone(t time.Time) (time.Time, Window, bool) {
+	return calendar.Postpone(t)
+}
+
+// Upcoming checks if there are any freeze windows that haven't ended
+func Upcoming(now time.Time) bool {
+	for _, w := range calendar.Windows {
+		if w.End.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// At returns the freeze window the specified time is within, if any. If
+// windows overlap, the one that started first is returned.
+func (c *Calendar) At(t time.Time) (Window, bool) {
+	for _, w := range c.Windows {
+		if w.Contains(t) {
+			return w, true
+		}
+	}
+	return Window{}, false
+}
+
+// Postpone returns the first time at or after t that isn't within any
+// freeze, and the window t was within. Windows that overlap or follow
+// right after each other are skipped together. If t isn't within any
+// freeze, it's returned as is.
+func (c *Calendar) Postpone(t time.Time) (time.Time, Window, bool) {
+	first, frozen := c.At(t)
+	if !frozen {
+		return t, Window{}, false
+	}
+	until := first.End
+	for {
+		w, frozen := c.At(until)
+		if !frozen {
+			return until, first, true
+		}
+		until = w.End
+	}
+}
+
+// Load reads a calendar from an iCalendar file. If no file is specified
+// an empty calendar is returned, which never freezes anything.
+func Load(path string) (*Calendar, error) {
+	if path == "" {
+		return &Calendar{}, nil
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read freeze calendar: %s", err)
+	}
+	return Parse(raw)
+}
+
+// Parse parses a calendar in the iCalendar format. Every event is a
+// window from its DTSTART to its DTEND, named by its SUMMARY. All-day
+// events without a DTEND last one day. Times without a time zone, and
+// dates, are in UTC. Recurring events are not supported, every window
+// must be an event of its own.
+func Parse(data []byte) (*Calendar, error) {
+	c := &Calendar{Windows: []Window{}}
+	var event map[string]property
+	for i, line := range unfold(data) {
+		if line == "" {
+			continue
+		}
+		p, err := parseProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid freeze calendar on line %d: %s", i+1, err)
+		}
+		switch {
+		case p.name == "BEGIN" && p.value == "VEVENT":
+			event = make(map[string]property)
+		case p.name == "END" && p.value == "VEVENT":
+			if event == nil {
+				return nil, fmt.Errorf("Invalid freeze calendar: END:VEVENT without BEGIN:VEVENT")
+			}
+			w, err := eventWindow(event)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid freeze calendar event ending on line %d: %s", i+1, err)
+			}
+			c.Windows = append(c.Windows, w)
+			event = nil
+		case event != nil:
+			event[p.name] = p
+		}
+	}
+	sort.SliceStable(c.Windows, func(i, j int) bool {
+		return c.Windows[i].Start.Before(c.Windows[j].Start)
+	})
+	return c, nil
+}
+
+// property is a content line of an iCalendar file
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// unfold joins lines that have been folded, i.e. continued on lines
+// starting with a space or tab
+func unfold(data []byte) []string {
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// parseProperty parses a content line such as
+// "DTSTART;TZID=Europe/Stockholm:20181224T090000"
+func parseProperty(line string) (property, error) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return property{}, fmt.Errorf("missing : in \"%s\"", line)
+	}
+	parts := strings.Split(line[:colon], ";")
+	p := property{
+		name:   strings.ToUpper(parts[0]),
+		params: make(map[string]string),
+		value:  line[colon+1:],
+	}
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) == 2 {
+			p.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], "\"")
+		}
+	}
+	return p, nil
+}
+
+func eventWindow(event map[string]property) (Window, error) {
+	if _, recurring := event["RRULE"]; recurring {
+		return Window{}, fmt.Errorf("recurring events are not supported")
+	}
+	start, ok := event["DTSTART"]
+	if !ok {
+		return Window{}, fmt.Errorf("event has no DTSTART")
+	}
+	w := Window{Name: unescape(event["SUMMARY"].value)}
+	if w.Name == "" {
+		w.Name = "unnamed freeze"
+	}
+	var allDay bool
+	var err error
+	if w.Start, allDay, err = parseTime(start); err != nil {
+		return Window{}, fmt.Errorf("invalid DTSTART: %s", err)
+	}
+	if end, ok := event["DTEND"]; ok {
+		if w.End, _, err = parseTime(end); err != nil {
+			return Window{}, fmt.Errorf("invalid DTEND: %s", err)
+		}
+	} else if allDay {
+		w.End = w.Start.AddDate(0, 0, 1)
+	} else {
+		return Window{}, fmt.Errorf("event has no DTEND")
+	}
+	if !w.End.After(w.Start) {
+		return Window{}, fmt.Errorf("%s ends before it starts", w.Name)
+	}
+	return w, nil
+}
+
+// parseTime parses the value of a DTSTART or DTEND property, and whether
+// it's a date rather than a time
+func parseTime(p property) (time.Time, bool, error) {
+	loc := time.UTC
+	if tzid, ok := p.params["TZID"]; ok {
+		var err error
+		if loc, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, false, err
+		}
+	}
+	if p.params["VALUE"] == "DATE" || len(p.value) == len("20060102") {
+		t, err := time.ParseInLocation("20060102", p.value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(p.value, "Z") {
+		t, err := time.Parse("20060102T150405Z", p.value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", p.value, loc)
+	return t, false, err
+}
+
+// unescape reverses the escaping of iCalendar text values
+func unescape(s string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
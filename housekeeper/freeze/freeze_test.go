@@ -0,0 +1,87 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package freeze
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+SUMMARY:Release 5.2
+DTSTART;TZID=America/Los_Angeles:20181105T090000
+DTEND;TZID=America/Los_Angeles:20181109T170000
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Company holidays\, part 2
+DTSTART;VALUE=DATE:20181231
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Company holidays
+DTSTART:20181222T000000Z
+DTEND:20181231T000000Z
+DESCRIPTION:Nothing is deleted during the
+  holidays
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(strings.Replace(testCalendar, "\n", "\r\n", -1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Windows) != 3 {
+		t.Fatalf("Expected 3 windows, got %d", len(c.Windows))
+	}
+	release, holidays, allDay := c.Windows[0], c.Windows[1], c.Windows[2]
+	if release.Name != "Release 5.2" || !release.Start.Equal(time.Date(2018, 11, 5, 17, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected release window %s", release)
+	}
+	if holidays.Name != "Company holidays" || !holidays.End.Equal(time.Date(2018, 12, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected holiday window %s", holidays)
+	}
+	if allDay.Name != "Company holidays, part 2" || !allDay.End.Equal(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("All-day events should last one day, got %s", allDay)
+	}
+
+	invalid := []string{
+		"BEGIN:VEVENT\nSUMMARY:Weekly\nDTSTART:20181105T090000Z\nDTEND:20181105T170000Z\nRRULE:FREQ=WEEKLY\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nSUMMARY:No end\nDTSTART:20181105T090000Z\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nSUMMARY:Backwards\nDTSTART:20181105T090000Z\nDTEND:20181104T090000Z\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nSUMMARY:Bad date\nDTSTART:2018-11-05\nEND:VEVENT\n",
+	}
+	for _, raw := range invalid {
+		if _, err := Parse([]byte(raw)); err == nil {
+			t.Errorf("Expected an error parsing %q", raw)
+		}
+	}
+}
+
+func TestPostpone(t *testing.T) {
+	c, err := Parse([]byte(testCalendar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	christmas := time.Date(2018, 12, 24, 10, 0, 0, 0, time.UTC)
+	until, w, frozen := c.Postpone(christmas)
+	if !frozen || w.Name != "Company holidays" {
+		t.Fatalf("Expected %s to be frozen by the holidays, got %s", christmas, w)
+	}
+	// The windows follow right after each other, so both are skipped
+	if !until.Equal(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the deletion to be postponed until 2019-01-01, got %s", until)
+	}
+
+	spring := time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC)
+	if until, _, frozen := c.Postpone(spring); frozen || !until.Equal(spring) {
+		t.Errorf("Expected %s not to be postponed, got %s", spring, until)
+	}
+	if _, frozen := (&Calendar{}).At(christmas); frozen {
+		t.Error("An empty calendar should never freeze anything")
+	}
+}
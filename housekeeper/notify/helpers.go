@@ -13,7 +13,6 @@ import (
 	"html/template"
 	"log"
 	"os"
-	"strings"
 	"time"
 )
 
@@ -79,17 +78,45 @@ func extraTemplateFunctions() template.FuncMap {
 			return "No"
 		},
 		"whitelisted": func(res cloud.Resource) bool {
-			for key := range res.Tags() {
-				if strings.ToLower(key) == strings.ToLower(filter.WhitelistTagKey) {
-					return true
-				}
+			return filter.IsWhitelisted(res)
+		},
+		"whitelistuntil": func(res cloud.Resource) string {
+			wl, _, err := filter.GetWhitelist(res)
+			if err != nil {
+				return "Malformed"
+			} else if wl.Permanent() {
+				return "Never"
+			}
+			return wl.Until.Format("2006-01-02")
+		},
+		"whitelistreason": func(res cloud.Resource) string {
+			wl, _, err := filter.GetWhitelist(res)
+			if err != nil {
+				return err.Error()
+			} else if wl.Reason == "" {
+				return "None given"
+			}
+			return wl.Reason
+		},
+		"tagproblems": func(res cloud.Resource) []string {
+			problems := []string{}
+			for _, problem := range filter.MalformedTags(res) {
+				problems = append(problems, problem.String())
+			}
+			return problems
+		},
+		"deletereason": func(res cloud.Resource) string {
+			reason, exist := filter.TagValue(res, filter.DeleteReasonTagKey)
+			if !exist || reason == "" {
+				reason = "Unknown"
+			}
+			if original, freeze, postponed := filter.Postponement(res); postponed {
+				reason += fmt.Sprintf(" (postponed from %s by the %s freeze)", original.Format("2006-01-02"), freeze)
 			}
-			return false
+			return reason
 		},
 		"accucost": func(res cloud.Resource) string {
-			days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-			costPerDay := billing.ResourceCostPerDay(res)
-			return fmt.Sprintf("$%.2f", days*costPerDay)
+			return fmt.Sprintf("$%.2f", billing.AccumulatedCost(res))
 		},
 		"bucketcost": func(res cloud.Bucket) float64 {
 			return billing.BucketPricePerMonth(res)
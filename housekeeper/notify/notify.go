@@ -8,8 +8,11 @@ import (
 	"brkt/cloudsweeper/cloud/billing"
 	"brkt/cloudsweeper/cloud/filter"
 	hk "brkt/cloudsweeper/housekeeper"
+	"brkt/cloudsweeper/housekeeper/approval"
+	"brkt/cloudsweeper/housekeeper/cleanup"
 	"fmt"
 	"log"
+	"sort"
 	"time"
 )
 
@@ -25,6 +28,13 @@ const (
 	mailDisplayName      = "HouseKeeper"
 	monthToDateAddressee = "eng@example.com"
 	totalSumAddressee    = "ben"
+
+	// Owners are reminded about whitelists this many days before they lapse
+	whitelistWarningDays = 14
+
+	// Managers are reminded about deletions awaiting their approval this
+	// often, in days
+	approvalReminderDays = 3
 )
 
 type resourceMailData struct {
@@ -42,6 +52,22 @@ func (d *resourceMailData) ResourceCount() int {
 	return len(d.Images) + len(d.Instances) + len(d.Snapshots) + len(d.Volumes) + len(d.Buckets)
 }
 
+// WhitelistTagKey is the configured whitelist key, so that emails tell
+// users which tags to actually set
+func (d *resourceMailData) WhitelistTagKey() string {
+	return filter.WhitelistTagKey
+}
+
+// LifetimeTagKey is the configured lifetime key
+func (d *resourceMailData) LifetimeTagKey() string {
+	return filter.LifetimeTagKey
+}
+
+// ExpiryTagKey is the configured expiry key
+func (d *resourceMailData) ExpiryTagKey() string {
+	return filter.ExpiryTagKey
+}
+
 func (d *resourceMailData) SendEmail(mailTemplate, title string, debugAddressees ...string) {
 	mailClient := getMailClient()
 	mailContent, err := generateMail(d, mailTemplate)
@@ -69,6 +95,46 @@ type monthToDateData struct {
 	AccountToUser    map[string]string
 }
 
+type encryptionSummaryData struct {
+	Owner       string
+	CSP         cloud.CSP
+	Departments []*departmentEncryptionSummary
+}
+
+func (d *encryptionSummaryData) ResourceCount() int {
+	count := 0
+	for _, department := range d.Departments {
+		count += department.ResourceCount()
+	}
+	return count
+}
+
+type departmentEncryptionSummary struct {
+	Name     string
+	Accounts []*accountEncryptionSummary
+}
+
+func (d *departmentEncryptionSummary) ResourceCount() int {
+	count := 0
+	for _, account := range d.Accounts {
+		count += account.ResourceCount()
+	}
+	return count
+}
+
+type accountEncryptionSummary struct {
+	Account   string
+	Owner     string
+	Volumes   int
+	Snapshots int
+	Images    int
+	Buckets   int
+}
+
+func (a *accountEncryptionSummary) ResourceCount() int {
+	return a.Volumes + a.Snapshots + a.Images + a.Buckets
+}
+
 func initTotalSummaryMailData() *resourceMailData {
 	return &resourceMailData{
 		Owner:     totalSumAddressee,
@@ -102,6 +168,7 @@ func initManagerToMailDataMapping(managers hk.Employees) map[string]*resourceMai
 //		- Resource is older than 30 days
 //		- A whitelisted resource is older than 6 months
 //		- An instance marked with do-not-delete is older than a week
+//		- An instance has been stopped for more than two weeks
 func OldResourceReview(mngr cloud.ResourceManager, org *hk.Organization, csp cloud.CSP) {
 	allCompute := mngr.AllResourcesPerAccount()
 	allBuckets := mngr.BucketsPerAccount()
@@ -127,6 +194,9 @@ func OldResourceReview(mngr cloud.ResourceManager, org *hk.Organization, csp clo
 	dndFilter2.AddGeneralRule(filter.NameContains("do-not-delete"))
 	dndFilter2.AddGeneralRule(filter.OlderThanXDays(7))
 
+	stoppedFilter := filter.New()
+	stoppedFilter.AddInstanceRule(filter.StoppedForXDays(14))
+
 	for account, resources := range allCompute {
 		log.Println("Performing old resource review in", account)
 		username := accountUserMapping[account]
@@ -135,7 +205,7 @@ func OldResourceReview(mngr cloud.ResourceManager, org *hk.Organization, csp clo
 		// Apply filters
 		userMailData := resourceMailData{
 			Owner:     username,
-			Instances: filter.Instances(resources.Instances, generalFilter, whitelistFilter, dndFilter, dndFilter2),
+			Instances: filter.Instances(resources.Instances, generalFilter, whitelistFilter, dndFilter, dndFilter2, stoppedFilter),
 			Images:    filter.Images(resources.Images, generalFilter, whitelistFilter),
 			Volumes:   filter.Volumes(resources.Volumes, generalFilter, whitelistFilter),
 			Snapshots: filter.Snapshots(resources.Snapshots, generalFilter, whitelistFilter),
@@ -219,6 +289,239 @@ func UntaggedResourcesReview(mngr cloud.ResourceManager, accountUserMapping map[
 	}
 }
 
+// PublicResourceReview will look for resources that are exposed to the
+// public, and send the owner a report with the findings. This includes
+// public images, snapshots and buckets, as well as instances with an
+// external IP that are reachable through an open security group or
+// firewall. If remediate is true, public images, snapshots and buckets
+// will also be made private, unless they are whitelisted or released.
+func PublicResourceReview(mngr cloud.ResourceManager, accountUserMapping map[string]string, remediate bool) {
+	allCompute := mngr.AllResourcesPerAccount()
+	allBuckets := mngr.BucketsPerAccount()
+	for account, resources := range allCompute {
+		log.Println("Performing public resource review in", account)
+		publicFilter := filter.New()
+		publicFilter.AddGeneralRule(filter.IsPublic())
+		// Whitelisted resources can still be a security risk
+		publicFilter.OverrideWhitelist = true
+
+		mailData := resourceMailData{
+			Owner:     convertEmailExceptions(accountUserMapping[account]),
+			OwnerID:   account,
+			Instances: filter.Instances(resources.Instances, publicFilter),
+			Images:    filter.Images(resources.Images, publicFilter),
+			Snapshots: filter.Snapshots(resources.Snapshots, publicFilter),
+			Volumes:   []cloud.Volume{},
+			Buckets:   []cloud.Bucket{},
+		}
+		if buckets, ok := allBuckets[account]; ok {
+			mailData.Buckets = filter.Buckets(buckets, publicFilter)
+		}
+
+		if remediate {
+			remediateFilter := filter.New()
+			remediateFilter.AddGeneralRule(filter.IsPublic())
+			remediateFilter.AddGeneralRule(filter.Negate(filter.HasTag(filter.ReleaseTagKey)))
+			for _, img := range filter.Images(mailData.Images, remediateFilter) {
+				if err := img.MakePrivate(); err != nil {
+					log.Printf("%s: Failed to make image %s private: %s\n", account, img.ID(), err)
+				}
+			}
+			for _, snap := range filter.Snapshots(mailData.Snapshots, remediateFilter) {
+				if err := snap.MakePrivate(); err != nil {
+					log.Printf("%s: Failed to make snapshot %s private: %s\n", account, snap.ID(), err)
+				}
+			}
+			for _, buck := range filter.Buckets(mailData.Buckets, remediateFilter) {
+				if err := buck.MakePrivate(); err != nil {
+					log.Printf("%s: Failed to make bucket %s private: %s\n", account, buck.ID(), err)
+				}
+			}
+		}
+
+		if mailData.ResourceCount() > 0 {
+			title := fmt.Sprintf("You have %d publicly exposed resources to review (%s)", mailData.ResourceCount(), time.Now().Format("2006-01-02"))
+			mailData.SendEmail(publicResourcesMailTemplate, title)
+		}
+	}
+}
+
+// EncryptionReview will look for volumes, snapshots, images and buckets
+// that are not encrypted. Every owner is sent an email with a list of their
+// unencrypted resources, and an org-wide summary grouped by department is
+// sent out as well. Whitelisted resources are included in the review.
+func EncryptionReview(mngr cloud.ResourceManager, org *hk.Organization, csp cloud.CSP) {
+	allCompute := mngr.AllResourcesPerAccount()
+	allBuckets := mngr.BucketsPerAccount()
+	accountUserMapping := org.AccountToUserMapping(csp)
+	userEmployeeMapping := org.UsernameToEmployeeMapping()
+	departments := make(map[string]*departmentEncryptionSummary)
+
+	unencryptedFilter := filter.New()
+	unencryptedFilter.AddGeneralRule(filter.IsUnencrypted())
+	unencryptedFilter.OverrideWhitelist = true
+
+	for account, resources := range allCompute {
+		log.Println("Performing encryption review in", account)
+		username := accountUserMapping[account]
+		mailData := resourceMailData{
+			Owner:     username,
+			OwnerID:   account,
+			Instances: []cloud.Instance{},
+			Images:    filter.Images(resources.Images, unencryptedFilter),
+			Volumes:   filter.Volumes(resources.Volumes, unencryptedFilter),
+			Snapshots: filter.Snapshots(resources.Snapshots, unencryptedFilter),
+			Buckets:   []cloud.Bucket{},
+		}
+		if buckets, ok := allBuckets[account]; ok {
+			mailData.Buckets = filter.Buckets(buckets, unencryptedFilter)
+		}
+
+		departmentName := "Unknown"
+		if employee, ok := userEmployeeMapping[username]; ok && employee.Department != nil {
+			departmentName = employee.Department.Name
+		}
+		department, ok := departments[departmentName]
+		if !ok {
+			department = &departmentEncryptionSummary{Name: departmentName}
+			departments[departmentName] = department
+		}
+		department.Accounts = append(department.Accounts, &accountEncryptionSummary{
+			Account:   account,
+			Owner:     username,
+			Volumes:   len(mailData.Volumes),
+			Snapshots: len(mailData.Snapshots),
+			Images:    len(mailData.Images),
+			Buckets:   len(mailData.Buckets),
+		})
+
+		if mailData.ResourceCount() > 0 {
+			title := fmt.Sprintf("You have %d unencrypted resources to review (%s)", mailData.ResourceCount(), time.Now().Format("2006-01-02"))
+			mailData.SendEmail(unencryptedMailTemplate, title)
+		}
+	}
+
+	// Send out an org-wide summary
+	log.Println("Collecting encryption review for the org")
+	summary := encryptionSummaryData{
+		Owner:       totalSumAddressee,
+		CSP:         csp,
+		Departments: []*departmentEncryptionSummary{},
+	}
+	for _, department := range departments {
+		sort.Slice(department.Accounts, func(i, j int) bool {
+			return department.Accounts[i].ResourceCount() > department.Accounts[j].ResourceCount()
+		})
+		summary.Departments = append(summary.Departments, department)
+	}
+	sort.Slice(summary.Departments, func(i, j int) bool {
+		return summary.Departments[i].Name < summary.Departments[j].Name
+	})
+	mailClient := getMailClient()
+	mailContent, err := generateMail(summary, encryptionSummaryTemplate)
+	if err != nil {
+		log.Fatalln("Could not generate email:", err)
+	}
+	summaryMail := fmt.Sprintf("%s@.example.com", totalSumAddressee)
+	log.Printf("Sending the encryption summary to %s\n", summaryMail)
+	title := fmt.Sprintf("Your org has %d unencrypted %s resources (%s)", summary.ResourceCount(), csp, time.Now().Format("2006-01-02"))
+	err = mailClient.SendEmail(title, mailContent, summaryMail)
+	if err != nil {
+		log.Printf("Failed to email %s: %s\n", summaryMail, err)
+	}
+}
+
+// OrphanReview will look for orphaned resources, i.e. volumes, snapshots and
+// images that whatever they belonged to or were created from no longer exists.
+// The owner is sent an email with a list of these resources.
+func OrphanReview(mngr cloud.ResourceManager, accountUserMapping map[string]string) {
+	allCompute := mngr.AllResourcesPerAccount()
+	for account, resources := range allCompute {
+		log.Println("Performing orphaned resource review in", account)
+		orphans := cleanup.FindOrphans(resources)
+		mailData := resourceMailData{
+			Owner:     convertEmailExceptions(accountUserMapping[account]),
+			OwnerID:   account,
+			Instances: []cloud.Instance{},
+			Images:    orphans.Images,
+			Snapshots: orphans.Snapshots,
+			Volumes:   orphans.Volumes,
+			Buckets:   []cloud.Bucket{},
+		}
+		if mailData.ResourceCount() > 0 {
+			title := fmt.Sprintf("You have %d orphaned resources to review (%s)", mailData.ResourceCount(), time.Now().Format("2006-01-02"))
+			mailData.SendEmail(orphanMailTemplate, title)
+		}
+	}
+}
+
+// WhitelistReview will send an email to the owner of every account with
+// whitelisted resources that need attention. These are resources where the
+// whitelisting lapses within the next two weeks (or already has), and
+// resources that are whitelisted without a stated reason.
+func WhitelistReview(mngr cloud.ResourceManager, accountUserMapping map[string]string) {
+	allCompute := mngr.AllResourcesPerAccount()
+	allBuckets := mngr.BucketsPerAccount()
+
+	reviewFilter := filter.Or(filter.WhitelistExpiresWithinXDays(whitelistWarningDays), filter.WhitelistUnjustified())
+	reviewFilter.OverrideWhitelist = true
+
+	for account, resources := range allCompute {
+		log.Println("Performing whitelist review in", account)
+		mailData := resourceMailData{
+			Owner:     convertEmailExceptions(accountUserMapping[account]),
+			OwnerID:   account,
+			Instances: filter.Instances(resources.Instances, reviewFilter),
+			Images:    filter.Images(resources.Images, reviewFilter),
+			Snapshots: filter.Snapshots(resources.Snapshots, reviewFilter),
+			Volumes:   filter.Volumes(resources.Volumes, reviewFilter),
+			Buckets:   []cloud.Bucket{},
+		}
+		if buckets, ok := allBuckets[account]; ok {
+			mailData.Buckets = filter.Buckets(buckets, reviewFilter)
+		}
+		if mailData.ResourceCount() > 0 {
+			title := fmt.Sprintf("You have %d whitelisted resources to review (%s)", mailData.ResourceCount(), time.Now().Format("2006-01-02"))
+			mailData.SendEmail(whitelistMailTemplate, title)
+		}
+	}
+}
+
+// MalformedTagsReport will find resources with housekeeper tags that
+// can't be parsed, such as a lifetime or expiry on an unknown format, and
+// email the owner of those resources a list of them. These tags are
+// otherwise silently ignored when marking resources for cleanup.
+func MalformedTagsReport(mngr cloud.ResourceManager, accountUserMapping map[string]string) {
+	allCompute := mngr.AllResourcesPerAccount()
+	allBuckets := mngr.BucketsPerAccount()
+
+	fil := filter.New()
+	fil.AddGeneralRule(filter.HasMalformedTags())
+	// Malformed whitelist tags must be reported as well
+	fil.OverrideWhitelist = true
+
+	for account, resources := range allCompute {
+		log.Println("Looking for malformed housekeeper tags in", account)
+		mailData := resourceMailData{
+			Owner:     convertEmailExceptions(accountUserMapping[account]),
+			OwnerID:   account,
+			Instances: filter.Instances(resources.Instances, fil),
+			Images:    filter.Images(resources.Images, fil),
+			Snapshots: filter.Snapshots(resources.Snapshots, fil),
+			Volumes:   filter.Volumes(resources.Volumes, fil),
+			Buckets:   []cloud.Bucket{},
+		}
+		if buckets, ok := allBuckets[account]; ok {
+			mailData.Buckets = filter.Buckets(buckets, fil)
+		}
+		if mailData.ResourceCount() > 0 {
+			log.Printf("%s: Found %d resources with malformed housekeeper tags\n", account, mailData.ResourceCount())
+			title := fmt.Sprintf("You have %d resources with malformed housekeeper tags (%s)", mailData.ResourceCount(), time.Now().Format("2006-01-02"))
+			mailData.SendEmail(malformedTagsTemplate, title)
+		}
+	}
+}
+
 // DeletionWarning will find resources which are about to be deleted within
 // `hoursInAdvance` hours, and send an email to the owner of those resources
 // with a warning. Resources explicitly tagged to be deleted are not included
@@ -269,3 +572,119 @@ func MonthToDateReport(report billing.Report, accountUserMapping map[string]stri
 		log.Printf("Failed to email %s: %s\n", monthToDateAddressee, err)
 	}
 }
+
+type handoverMailData struct {
+	Owner           string
+	Handover        *cleanup.Handover
+	OwnerTagKey     string
+	WhitelistTagKey string
+}
+
+// OffboardingReport sends the manager of every disabled employee a
+// handover report, listing the resources the employee left behind and
+// when the ones that haven't been handed over are cleaned up
+func OffboardingReport(handovers []*cleanup.Handover) {
+	for _, handover := range handovers {
+		employee := handover.Employee
+		if employee.Manager == nil {
+			log.Printf("%s has no manager, not sending a handover report\n", employee.Username)
+			continue
+		}
+		mailData := handoverMailData{
+			Owner:           convertEmailExceptions(employee.Manager.Username),
+			Handover:        handover,
+			OwnerTagKey:     filter.OwnerTagKey,
+			WhitelistTagKey: filter.WhitelistTagKey,
+		}
+		sendHandoverEmail(mailData)
+	}
+}
+
+func sendHandoverEmail(d handoverMailData) {
+	mailClient := getMailClient()
+	mailContent, err := generateMail(d, handoverMailTemplate)
+	if err != nil {
+		log.Fatalln("Could not generate email:", err)
+	}
+	managerMail := fmt.Sprintf("%s@.example.com", d.Owner)
+	log.Printf("Sending the handover report for %s to %s\n", d.Handover.Employee.Username, managerMail)
+	title := fmt.Sprintf("%s has left, %d resources to hand over (%s)", d.Handover.Employee.Username,
+		d.Handover.Count(cleanup.HandoverPending)+d.Handover.Count(cleanup.HandoverInUse), time.Now().Format("2006-01-02"))
+	err = mailClient.SendEmail(title, mailContent, managerMail)
+	if err != nil {
+		log.Printf("Failed to email %s: %s\n", managerMail, err)
+	}
+}
+
+type approvalMailData struct {
+	Owner     string
+	Employees map[string]string
+	Requests  []*approvalLinks
+}
+
+type approvalLinks struct {
+	*approval.Request
+	ApproveLink string
+	DeclineLink string
+}
+
+// ApprovalRequests sends the managers of account owners the deletions in
+// their team's accounts that await their approval, with links to approve
+// or decline every deletion. Managers are reminded about the deletions
+// they haven't decided on every few days.
+func ApprovalRequests(store *approval.Store, org *hk.Organization, csp cloud.CSP, baseURL string, secret []byte) {
+	requests, err := store.Requests()
+	if err != nil {
+		log.Printf("Could not read approvals: %s\n", err)
+		return
+	}
+	accountUserMapping := org.AccountToUserMapping(csp)
+	userEmployeeMapping := org.UsernameToEmployeeMapping()
+	managerToMailData := make(map[string]*approvalMailData)
+	managerToKeys := make(map[string][]string)
+	for _, r := range approval.Pending(requests) {
+		if time.Since(r.Notified) < approvalReminderDays*24*time.Hour {
+			continue
+		}
+		username, ok := accountUserMapping[r.Account]
+		if !ok {
+			continue
+		}
+		employee := userEmployeeMapping[username]
+		if employee == nil || employee.Manager == nil {
+			log.Printf("%s has no manager to approve the deletion of %s\n", username, r.ID)
+			continue
+		}
+		manager := employee.Manager.Username
+		mailData, ok := managerToMailData[manager]
+		if !ok {
+			mailData = &approvalMailData{Owner: convertEmailExceptions(manager), Employees: make(map[string]string)}
+			managerToMailData[manager] = mailData
+		}
+		mailData.Employees[r.Account] = username
+		mailData.Requests = append(mailData.Requests, &approvalLinks{
+			Request:     r,
+			ApproveLink: approval.Link(baseURL, secret, r.Key(), approval.DecisionApprove, manager),
+			DeclineLink: approval.Link(baseURL, secret, r.Key(), approval.DecisionDecline, manager),
+		})
+		managerToKeys[manager] = append(managerToKeys[manager], r.Key())
+	}
+
+	for manager, mailData := range managerToMailData {
+		mailClient := getMailClient()
+		mailContent, err := generateMail(mailData, approvalMailTemplate)
+		if err != nil {
+			log.Fatalln("Could not generate email:", err)
+		}
+		managerMail := fmt.Sprintf("%s@.example.com", mailData.Owner)
+		log.Printf("Sending %d deletions to approve to %s\n", len(mailData.Requests), managerMail)
+		title := fmt.Sprintf("Your team has %d deletions awaiting your approval (%s)", len(mailData.Requests), time.Now().Format("2006-01-02"))
+		if err = mailClient.SendEmail(title, mailContent, managerMail); err != nil {
+			log.Printf("Failed to email %s: %s\n", managerMail, err)
+			continue
+		}
+		if err = store.MarkNotified(managerToKeys[manager]...); err != nil {
+			log.Printf("Could not record that %s was notified: %s\n", manager, err)
+		}
+	}
+}
@@ -27,15 +27,15 @@ be deleted. <b>Please review them in case they no longer should be whitelisted</
 
 <p>
 Conversely, if you see a resource here that you know that you want to keep for a longer time, then please
-whitelist it: add a tag with the key "whitelisted" to it.
+whitelist it: add a tag with the key "{{ .WhitelistTagKey }}" to it.
 </p>
 
 <p>
 To schedule automated clean up, please add one of the following two types of tags (key: value) to your resource: 
 <br />
-"<b>housekeeper-lifetime</b>: days-x", where x is the amount of days to keep the resource
+"<b>{{ .LifetimeTagKey }}</b>: days-x", where x is the amount of days to keep the resource. Durations such as 36h, 2w or P10D work too
 <br />
-"<b>housekeeper-expiry</b>: YYYY-MM-DD", to clean a resource up after the specified date, e.g. 2018-01-30
+"<b>{{ .ExpiryTagKey }}</b>: YYYY-MM-DD", to clean a resource up after the specified date, e.g. 2018-01-30. This can also be a timestamp with a time zone, or a duration after the resource was created such as +2w
 </p>
 
 <p>
@@ -56,6 +56,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>ID</strong></th>
 			<th><strong>Name</strong></th>
 			<th><strong>Instance type</strong></th>
+			<th><strong>State</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
 		</tr>
@@ -66,6 +67,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<td>{{ $instance.ID }}</td>
 			<td>{{ instname $instance }}</td>
 			<td>{{ $instance.InstanceType }}</td>
+			<td>{{ $instance.State }}</td>
 			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
 			<td>{{ accucost $instance }}</td>
 		</tr>
@@ -198,6 +200,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>ID</strong></th>
 			<th><strong>Name</strong></th>
 			<th><strong>Instance type</strong></th>
+			<th><strong>State</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
 		</tr>
@@ -208,6 +211,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<td>{{ $instance.ID }}</td>
 			<td>{{ instname $instance }}</td>
 			<td>{{ $instance.InstanceType }}</td>
+			<td>{{ $instance.State }}</td>
 			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
 			<td>{{ accucost $instance }}</td>
 		</tr>
@@ -340,6 +344,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>ID</strong></th>
 			<th><strong>Name</strong></th>
 			<th><strong>Instance type</strong></th>
+			<th><strong>State</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
 		</tr>
@@ -350,6 +355,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<td>{{ $instance.ID }}</td>
 			<td>{{ instname $instance }}</td>
 			<td>{{ $instance.InstanceType }}</td>
+			<td>{{ $instance.State }}</td>
 			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
 			<td>{{ accucost $instance }}</td>
 		</tr>
@@ -473,7 +479,7 @@ you don't need to keep any of these resources</b>
 </p>
 
 <p>
-If you want to save any of these resources, add a tag with the key <b>whitelisted</b>
+If you want to save any of these resources, add a tag with the key <b>{{ .WhitelistTagKey }}</b>
 </p>
 
 <p>
@@ -491,8 +497,10 @@ Read more about how HouseKeeper works and how to better tag your resources at
 			<th><strong>ID</strong></th>
 			<th><strong>Name</strong></th>
 			<th><strong>Instance type</strong></th>
+			<th><strong>State</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Reason</strong></th>
 		</tr>
 	{{ range $i, $instance := .Instances }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
@@ -501,8 +509,10 @@ Read more about how HouseKeeper works and how to better tag your resources at
 			<td>{{ $instance.ID }}</td>
 			<td>{{ instname $instance }}</td>
 			<td>{{ $instance.InstanceType }}</td>
+			<td>{{ $instance.State }}</td>
 			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
 			<td>{{ accucost $instance }}</td>
+			<td>{{ deletereason $instance }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -518,6 +528,7 @@ Read more about how HouseKeeper works and how to better tag your resources at
 			<th><strong>Name</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Reason</strong></th>
 		</tr>
 	{{ range $i, $image := .Images }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
@@ -527,6 +538,7 @@ Read more about how HouseKeeper works and how to better tag your resources at
 			<td>{{ $image.Name }}</td>
 			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
 			<td>{{ accucost $image }}</td>
+			<td>{{ deletereason $image }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -544,6 +556,7 @@ Read more about how HouseKeeper works and how to better tag your resources at
 			<th><strong>Created</strong></th>
 			<th><strong>Volume type</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Reason</strong></th>
 		</tr>
 	{{ range $i, $volume := .Volumes }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
@@ -555,6 +568,7 @@ Read more about how HouseKeeper works and how to better tag your resources at
 			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
 			<td>{{ $volume.VolumeType }}</td>
 			<td>{{ accucost $volume }}</td>
+			<td>{{ deletereason $volume }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -570,6 +584,7 @@ Read more about how HouseKeeper works and how to better tag your resources at
 			<th><strong>Size (GB)</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Reason</strong></th>
 		</tr>
 	{{ range $i, $snapshot := .Snapshots }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
@@ -579,6 +594,7 @@ Read more about how HouseKeeper works and how to better tag your resources at
 			<td>{{ $snapshot.SizeGB }} GB</td>
 			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
 			<td>{{ accucost $snapshot }}</td>
+			<td>{{ deletereason $snapshot }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -594,6 +610,7 @@ Read more about how HouseKeeper works and how to better tag your resources at
 			<th><strong>Files</strong></th>
 			<th><strong>Last modified</strong></th>
 			<th><strong>Monthly cost</strong></th>
+			<th><strong>Reason</strong></th>
 		</tr>
 	{{ range $i, $bucket := .Buckets }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
@@ -603,6 +620,7 @@ Read more about how HouseKeeper works and how to better tag your resources at
 			<td>{{ $bucket.ObjectCount }}</td>
 			<td>{{ fdate $bucket.LastModified "2006-01-02" }} ({{ daysrunning $bucket.LastModified }})</td>
 			<td>{{ printf "$%.3f" (bucketcost $bucket) }}</td>
+			<td>{{ deletereason $bucket }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -759,57 +777,759 @@ Your loyal housekeeper
 </p>
 `
 
+const publicResourcesMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>Publicly exposed resources</h2>
+<p>
+HouseKeeper has found resources in your account that are exposed to the public. This
+includes images, snapshots and buckets that anyone can access, and instances with an
+external IP that allow traffic from any address through a security group or firewall rule.
+<b>Please make sure that these resources are meant to be public</b>.
+</p>
+
+<p>
+Resources listed as no longer public have been made private by HouseKeeper. Whitelisted
+resources and resources tagged with <b>Release</b> are never made private automatically.
+Instances are never changed, please review their security groups and firewall rules.
+</p>
+
+<p>
+Read more about how HouseKeeper works and how to better tag your resources at
+<a href="https://wiki.int.brkt.com/display/eng/HouseKeeper+-+Automated+Cleanup+of+cloud+resources">this Wiki page</a>.
+</p>
+
+<h2>Public resources:</h2>
+{{ if gt (len .Instances) 0 }}
+	<h3>Instances</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Instance type</strong></th>
+			<th><strong>State</strong></th>
+			<th><strong>Created</strong></th>
+		</tr>
+	{{ range $i, $instance := .Instances }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ $instance.Owner }}</td>
+			<td>{{ $instance.Location }}</td>
+			<td>{{ $instance.ID }}</td>
+			<td>{{ instname $instance }}</td>
+			<td>{{ $instance.InstanceType }}</td>
+			<td>{{ $instance.State }}</td>
+			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Images) 0 }}
+	<h3>Images</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Still public</strong></th>
+		</tr>
+	{{ range $i, $image := .Images }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ $image.Owner }}</td>
+			<td>{{ $image.Location }}</td>
+			<td>{{ $image.ID }}</td>
+			<td>{{ $image.Name }}</td>
+			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
+			<td>{{ yesno $image.Public }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Snapshots) 0 }}
+	<h3>Snapshots</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Still public</strong></th>
+		</tr>
+	{{ range $i, $snapshot := .Snapshots }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ $snapshot.Owner }}</td>
+			<td>{{ $snapshot.Location }}</td>
+			<td>{{ $snapshot.ID }}</td>
+			<td>{{ $snapshot.SizeGB }} GB</td>
+			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
+			<td>{{ yesno $snapshot.Public }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Buckets) 0 }}
+	<h3>Buckets</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Files</strong></th>
+			<th><strong>Last modified</strong></th>
+			<th><strong>Still public</strong></th>
+		</tr>
+	{{ range $i, $bucket := .Buckets }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ $bucket.Owner }}</td>
+			<td>{{ $bucket.ID }}</td>
+			<td>{{ printf "%.3f GB" $bucket.TotalSizeGB }}</td>
+			<td>{{ $bucket.ObjectCount }}</td>
+			<td>{{ fdate $bucket.LastModified "2006-01-02" }} ({{ daysrunning $bucket.LastModified }})</td>
+			<td>{{ yesno $bucket.Public }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal housekeeper
+</p>
+`
+
+const orphanMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>Orphaned resources</h2>
+<p>
+HouseKeeper has found resources in your account that appear to be left overs. These are
+volumes not attached to any instance, snapshots of volumes that have been deleted and images
+whose backing snapshots have been deleted. <b>Please review these resources and delete
+the ones you no longer need</b>.
+</p>
+
+<p>
+Orphaned resources are marked for cleanup much sooner than other old resources. If you
+want to keep any of these resources, add a tag with the key <b>{{ .WhitelistTagKey }}</b> to it.
+</p>
+
+<p>
+Read more about how HouseKeeper works and how to better tag your resources at
+<a href="https://wiki.int.brkt.com/display/eng/HouseKeeper+-+Automated+Cleanup+of+cloud+resources">this Wiki page</a>.
+</p>
+
+<h2>Orphaned resources:</h2>
+<p>
+Resources marked <span style="background-color: #c9fc99;">in green</span> are whitelisted.
+</p>
+{{ if gt (len .Images) 0 }}
+	<h3>Images with deleted snapshots</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+		</tr>
+	{{ range $i, $image := .Images }}
+		<tr {{ if and (even $i) (not (whitelisted $image)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $image }}style="background-color: #c9fc99;"{{ end }}>
+			<td>{{ $image.Owner }}</td>
+			<td>{{ $image.Location }}</td>
+			<td>{{ $image.ID }}</td>
+			<td>{{ $image.Name }}</td>
+			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
+			<td>{{ accucost $image }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Volumes) 0 }}
+	<h3>Unattached volumes</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Volume type</strong></th>
+			<th><strong>Total cost</strong></th>
+		</tr>
+	{{ range $i, $volume := .Volumes }}
+		<tr {{ if and (even $i) (not (whitelisted $volume)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $volume }}style="background-color: #c9fc99;"{{ end }}>
+			<td>{{ $volume.Owner }}</td>
+			<td>{{ $volume.Location }}</td>
+			<td>{{ $volume.ID }}</td>
+			<td>{{ $volume.SizeGB }} GB</td>
+			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
+			<td>{{ $volume.VolumeType }}</td>
+			<td>{{ accucost $volume }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Snapshots) 0 }}
+	<h3>Snapshots of deleted volumes</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Source volume</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+		</tr>
+	{{ range $i, $snapshot := .Snapshots }}
+		<tr {{ if and (even $i) (not (whitelisted $snapshot)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $snapshot }}style="background-color: #c9fc99;"{{ end }}>
+			<td>{{ $snapshot.Owner }}</td>
+			<td>{{ $snapshot.Location }}</td>
+			<td>{{ $snapshot.ID }}</td>
+			<td>{{ $snapshot.SourceVolumeID }}</td>
+			<td>{{ $snapshot.SizeGB }} GB</td>
+			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
+			<td>{{ accucost $snapshot }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal housekeeper
+</p>
+`
+
+const unencryptedMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>Unencrypted resources</h2>
+<p>
+HouseKeeper has found resources in your account that are not encrypted. Our policy
+is that all data at rest should be encrypted. <b>Please replace these resources with
+encrypted copies, or delete them if they are no longer needed</b>.
+</p>
+
+<p>
+Unencrypted resources in production accounts may be marked for cleanup by HouseKeeper.
+</p>
+
+<p>
+Read more about how HouseKeeper works and how to better tag your resources at
+<a href="https://wiki.int.brkt.com/display/eng/HouseKeeper+-+Automated+Cleanup+of+cloud+resources">this Wiki page</a>.
+</p>
+
+<h2>Unencrypted resources:</h2>
+<p>
+Resources marked <span style="background-color: #c9fc99;">in green</span> are whitelisted.
+</p>
+{{ if gt (len .Images) 0 }}
+	<h3>Images</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+		</tr>
+	{{ range $i, $image := .Images }}
+		<tr {{ if and (even $i) (not (whitelisted $image)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $image }}style="background-color: #c9fc99;"{{ end }}>
+			<td>{{ $image.Owner }}</td>
+			<td>{{ $image.Location }}</td>
+			<td>{{ $image.ID }}</td>
+			<td>{{ $image.Name }}</td>
+			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
+			<td>{{ accucost $image }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Volumes) 0 }}
+	<h3>Volumes</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Attached to instance</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Volume type</strong></th>
+			<th><strong>Total cost</strong></th>
+		</tr>
+	{{ range $i, $volume := .Volumes }}
+		<tr {{ if and (even $i) (not (whitelisted $volume)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $volume }}style="background-color: #c9fc99;"{{ end }}>
+			<td>{{ $volume.Owner }}</td>
+			<td>{{ $volume.Location }}</td>
+			<td>{{ $volume.ID }}</td>
+			<td>{{ $volume.SizeGB }} GB</td>
+			<td>{{ yesno $volume.Attached }}</td>
+			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
+			<td>{{ $volume.VolumeType }}</td>
+			<td>{{ accucost $volume }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Snapshots) 0 }}
+	<h3>Snapshots</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+		</tr>
+	{{ range $i, $snapshot := .Snapshots }}
+		<tr {{ if and (even $i) (not (whitelisted $snapshot)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $snapshot }}style="background-color: #c9fc99;"{{ end }}>
+			<td>{{ $snapshot.Owner }}</td>
+			<td>{{ $snapshot.Location }}</td>
+			<td>{{ $snapshot.ID }}</td>
+			<td>{{ $snapshot.SizeGB }} GB</td>
+			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
+			<td>{{ accucost $snapshot }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Buckets) 0 }}
+	<h3>Buckets</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Files</strong></th>
+			<th><strong>Last modified</strong></th>
+			<th><strong>Monthly cost</strong></th>
+		</tr>
+	{{ range $i, $bucket := .Buckets }}
+		<tr {{ if and (even $i) (not (whitelisted $bucket)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $bucket }}style="background-color: #c9fc99;"{{ end }}>
+			<td>{{ $bucket.Owner }}</td>
+			<td>{{ $bucket.ID }}</td>
+			<td>{{ printf "%.3f GB" $bucket.TotalSizeGB }}</td>
+			<td>{{ $bucket.ObjectCount }}</td>
+			<td>{{ fdate $bucket.LastModified "2006-01-02" }} ({{ daysrunning $bucket.LastModified }})</td>
+			<td>{{ printf "$%.3f" (bucketcost $bucket) }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal housekeeper
+</p>
+`
+
+const encryptionSummaryTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>{{ .CSP }} encryption summary</h2>
+<p>
+There are {{ .ResourceCount }} unencrypted volumes, snapshots, images and buckets in the org.
+Below is a summary of the unencrypted resources per department and account.
+</p>
+
+{{ range $department := .Departments }}
+	<h3>{{ $department.Name }} ({{ $department.ResourceCount }} unencrypted)</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Owner</strong></th>
+			<th><strong>Account</strong></th>
+			<th><strong>Volumes</strong></th>
+			<th><strong>Snapshots</strong></th>
+			<th><strong>Images</strong></th>
+			<th><strong>Buckets</strong></th>
+			<th><strong>Total</strong></th>
+		</tr>
+	{{ range $i, $account := $department.Accounts }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ $account.Owner }}</td>
+			<td>{{ $account.Account }}</td>
+			<td>{{ $account.Volumes }}</td>
+			<td>{{ $account.Snapshots }}</td>
+			<td>{{ $account.Images }}</td>
+			<td>{{ $account.Buckets }}</td>
+			<td>{{ $account.ResourceCount }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal housekeeper
+</p>
+`
+
 const monthToDateTemplate = `
 {{ $accountToUserMapping := .AccountToUser }}
 <h2>Hello,</h2>
 
 <p>
-The following is a summary of this month's expenditures in {{ .CSP }}.
+The following is a summary of this month's expenditures in {{ .CSP }}.
+</p>
+<p>
+In the summary, only accounts with a total cost over ${{ .MinimumTotalCost }} are listed.
+</p>
+<p>
+In the detailed breakdown, only costs over ${{ .MinimumCost }} are listed (but every cost is still counted towards the total!)
+</p>
+
+<h3>Summary:</h3>
+{{ if gt (len .SortedUsers) 0 }}
+	<table>
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Cost</strong></th>
+		</tr>
+	{{ range $i, $user := .SortedUsers }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ maybeRealName $user.Name $accountToUserMapping }}</td>
+			<td>{{ printf "$%.2f" $user.TotalCost }}</td>
+		</tr>
+	{{ end }}
+		<td colspan="2"><strong>Total cost: {{ printf "$%.2f" .TotalCost }}<strong></td>
+	</table>
+{{ end }}
+
+<h3>Details:</h3>
+{{ if gt (len .SortedUsers) 0 }}
+	{{ range $index, $user := .SortedUsers }}
+		<h3>{{- maybeRealName $user.Name $accountToUserMapping -}}'s costs:</h3>
+		<h4>(Account ID: {{ $user.Name }})</h4>
+		<table>
+		<tr style="text-align:left;">
+			<th><strong>Cost</strong></th>
+			<th><strong>Description</strong></th>
+		</tr>
+		{{ range $i, $detailedCost := $user.DetailedCosts }}
+			<tr {{ if even $i }} style="background-color: #f2f2f2;"{{ end }}>
+				<td>{{ printf "$%.2f" $detailedCost.Cost }}</td>
+				<td>{{ $detailedCost.Description }}</td>
+			</tr>
+		{{ end }}
+		<td colspan="2"><strong>Total cost: {{ printf "$%.2f" $user.TotalCost }}<strong></td>
+	</table>
+	<br />
+	{{ end }}
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal housekeeper
+</p>
+`
+
+const whitelistMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>Whitelisted resources to review</h2>
+<p>
+The resources listed below are whitelisted, but either the whitelisting lapses soon (or already
+has), or no reason for whitelisting them has been given. <b>Once the whitelisting lapses, these
+resources can be cleaned up by HouseKeeper</b>.
+</p>
+
+<p>
+To keep a resource whitelisted, set the value of its <b>{{ .WhitelistTagKey }}</b> tag to when it
+should lapse and why it's needed, for example <b>until=2026-12-31;reason=perf-lab</b>.
+If you no longer need a resource, please delete it.
+</p>
+
+<p>
+Read more about how HouseKeeper works and how to better tag your resources at
+<a href="https://wiki.int.brkt.com/display/eng/HouseKeeper+-+Automated+Cleanup+of+cloud+resources">this Wiki page</a>.
+</p>
+
+{{ if gt (len .Instances) 0 }}
+	<h3>Instances</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Instance type</strong></th>
+			<th><strong>State</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Whitelisted until</strong></th>
+			<th><strong>Reason</strong></th>
+		</tr>
+	{{ range $i, $instance := .Instances }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ $instance.Owner }}</td>
+			<td>{{ $instance.Location }}</td>
+			<td>{{ $instance.ID }}</td>
+			<td>{{ instname $instance }}</td>
+			<td>{{ $instance.InstanceType }}</td>
+			<td>{{ $instance.State }}</td>
+			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
+			<td>{{ whitelistuntil $instance }}</td>
+			<td>{{ whitelistreason $instance }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Images) 0 }}
+	<h3>Images</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Whitelisted until</strong></th>
+			<th><strong>Reason</strong></th>
+		</tr>
+	{{ range $i, $image := .Images }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ $image.Owner }}</td>
+			<td>{{ $image.Location }}</td>
+			<td>{{ $image.ID }}</td>
+			<td>{{ $image.Name }}</td>
+			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
+			<td>{{ whitelistuntil $image }}</td>
+			<td>{{ whitelistreason $image }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Volumes) 0 }}
+	<h3>Volumes</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Whitelisted until</strong></th>
+			<th><strong>Reason</strong></th>
+		</tr>
+	{{ range $i, $volume := .Volumes }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ $volume.Owner }}</td>
+			<td>{{ $volume.Location }}</td>
+			<td>{{ $volume.ID }}</td>
+			<td>{{ $volume.SizeGB }} GB</td>
+			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
+			<td>{{ whitelistuntil $volume }}</td>
+			<td>{{ whitelistreason $volume }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Snapshots) 0 }}
+	<h3>Snapshots</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Whitelisted until</strong></th>
+			<th><strong>Reason</strong></th>
+		</tr>
+	{{ range $i, $snapshot := .Snapshots }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ $snapshot.Owner }}</td>
+			<td>{{ $snapshot.Location }}</td>
+			<td>{{ $snapshot.ID }}</td>
+			<td>{{ $snapshot.SizeGB }} GB</td>
+			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
+			<td>{{ whitelistuntil $snapshot }}</td>
+			<td>{{ whitelistreason $snapshot }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Buckets) 0 }}
+	<h3>Buckets</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Whitelisted until</strong></th>
+			<th><strong>Reason</strong></th>
+		</tr>
+	{{ range $i, $bucket := .Buckets }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ $bucket.Owner }}</td>
+			<td>{{ $bucket.ID }}</td>
+			<td>{{ printf "%.3f GB" $bucket.TotalSizeGB }}</td>
+			<td>{{ fdate $bucket.CreationTime "2006-01-02" }} ({{ daysrunning $bucket.CreationTime }})</td>
+			<td>{{ whitelistuntil $bucket }}</td>
+			<td>{{ whitelistreason $bucket }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal housekeeper
 </p>
+`
+
+const malformedTagsTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>Resources with malformed housekeeper tags</h2>
 <p>
-In the summary, only accounts with a total cost over ${{ .MinimumTotalCost }} are listed.
+The resources listed below have housekeeper tags that can't be understood. <b>These tags are
+ignored until they are fixed</b>, so the resources might be kept longer than you intended, or
+be cleaned up even though you tried to whitelist them.
 </p>
+
 <p>
-In the detailed breakdown, only costs over ${{ .MinimumCost }} are listed (but every cost is still counted towards the total!)
+The lifetime tag (<b>{{ .LifetimeTagKey }}</b>) takes a duration such as <b>days-10</b>, <b>36h</b>,
+<b>2w</b> or <b>P10D</b>. The expiry tag (<b>{{ .ExpiryTagKey }}</b>) takes a date such as
+<b>2018-01-30</b>, a timestamp with a time zone such as <b>2018-01-30T18:00:00+01:00</b>, or a
+duration after the resource was created such as <b>+2w</b>.
 </p>
 
-<h3>Summary:</h3>
-{{ if gt (len .SortedUsers) 0 }}
-	<table>
+{{ if gt (len .Instances) 0 }}
+	<h3>Instances</h3>
+	<table style="width: 100%;">
 		<tr style="text-align:left;">
 			<th><strong>Account</strong></th>
-			<th><strong>Cost</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Instance type</strong></th>
+			<th><strong>State</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Malformed tags</strong></th>
 		</tr>
-	{{ range $i, $user := .SortedUsers }}
+	{{ range $i, $instance := .Instances }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ maybeRealName $user.Name $accountToUserMapping }}</td>
-			<td>{{ printf "$%.2f" $user.TotalCost }}</td>
+			<td>{{ $instance.Owner }}</td>
+			<td>{{ $instance.Location }}</td>
+			<td>{{ $instance.ID }}</td>
+			<td>{{ instname $instance }}</td>
+			<td>{{ $instance.InstanceType }}</td>
+			<td>{{ $instance.State }}</td>
+			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
+			<td>{{ range tagproblems $instance }}{{ . }}<br />{{ end }}</td>
 		</tr>
 	{{ end }}
-		<td colspan="2"><strong>Total cost: {{ printf "$%.2f" .TotalCost }}<strong></td>
 	</table>
 {{ end }}
 
-<h3>Details:</h3>
-{{ if gt (len .SortedUsers) 0 }}
-	{{ range $index, $user := .SortedUsers }}
-		<h3>{{- maybeRealName $user.Name $accountToUserMapping -}}'s costs:</h3>
-		<h4>(Account ID: {{ $user.Name }})</h4>
-		<table>
+{{ if gt (len .Images) 0 }}
+	<h3>Images</h3>
+	<table style="width: 100%;">
 		<tr style="text-align:left;">
-			<th><strong>Cost</strong></th>
-			<th><strong>Description</strong></th>
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Malformed tags</strong></th>
 		</tr>
-		{{ range $i, $detailedCost := $user.DetailedCosts }}
-			<tr {{ if even $i }} style="background-color: #f2f2f2;"{{ end }}>
-				<td>{{ printf "$%.2f" $detailedCost.Cost }}</td>
-				<td>{{ $detailedCost.Description }}</td>
-			</tr>
-		{{ end }}
-		<td colspan="2"><strong>Total cost: {{ printf "$%.2f" $user.TotalCost }}<strong></td>
+	{{ range $i, $image := .Images }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ $image.Owner }}</td>
+			<td>{{ $image.Location }}</td>
+			<td>{{ $image.ID }}</td>
+			<td>{{ $image.Name }}</td>
+			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
+			<td>{{ range tagproblems $image }}{{ . }}<br />{{ end }}</td>
+		</tr>
+	{{ end }}
 	</table>
-	<br />
+{{ end }}
+
+{{ if gt (len .Volumes) 0 }}
+	<h3>Volumes</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Malformed tags</strong></th>
+		</tr>
+	{{ range $i, $volume := .Volumes }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ $volume.Owner }}</td>
+			<td>{{ $volume.Location }}</td>
+			<td>{{ $volume.ID }}</td>
+			<td>{{ $volume.SizeGB }} GB</td>
+			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
+			<td>{{ range tagproblems $volume }}{{ . }}<br />{{ end }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Snapshots) 0 }}
+	<h3>Snapshots</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Malformed tags</strong></th>
+		</tr>
+	{{ range $i, $snapshot := .Snapshots }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ $snapshot.Owner }}</td>
+			<td>{{ $snapshot.Location }}</td>
+			<td>{{ $snapshot.ID }}</td>
+			<td>{{ $snapshot.SizeGB }} GB</td>
+			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
+			<td>{{ range tagproblems $snapshot }}{{ . }}<br />{{ end }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Buckets) 0 }}
+	<h3>Buckets</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Malformed tags</strong></th>
+		</tr>
+	{{ range $i, $bucket := .Buckets }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ $bucket.Owner }}</td>
+			<td>{{ $bucket.ID }}</td>
+			<td>{{ printf "%.3f GB" $bucket.TotalSizeGB }}</td>
+			<td>{{ fdate $bucket.CreationTime "2006-01-02" }} ({{ daysrunning $bucket.CreationTime }})</td>
+			<td>{{ range tagproblems $bucket }}{{ . }}<br />{{ end }}</td>
+		</tr>
 	{{ end }}
+	</table>
 {{ end }}
 
 <p>
@@ -817,3 +1537,115 @@ Thank you,<br />
 Your loyal housekeeper
 </p>
 `
+
+const handoverMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>Handover of {{ .Handover.Employee.RealName }}'s resources</h2>
+<p>
+{{ .Handover.Employee.RealName }} ({{ .Handover.Employee.Username }}) is no longer with the company,
+and has left the resources listed below behind. As their manager, <b>please decide which of these
+resources should be kept</b>. Resources that are not handed over will be marked for cleanup
+at the date listed, and deleted a few days later.
+</p>
+
+<p>
+To keep a resource, either reassign it by adding a tag with the key <b>{{ .OwnerTagKey }}</b> and
+the username of its new owner as value, or whitelist it by adding a tag with the key
+<b>{{ .WhitelistTagKey }}</b>. A whole account can be handed over by moving it to its new owner
+in the organization.
+</p>
+
+<p>
+Read more about how HouseKeeper works and how to better tag your resources at
+<a href="https://wiki.int.brkt.com/display/eng/HouseKeeper+-+Automated+Cleanup+of+cloud+resources">this Wiki page</a>.
+</p>
+
+{{ if gt (len .Handover.Unmanaged) 0 }}
+<p>
+HouseKeeper is not enabled in the following accounts, so their resources could not be
+inventoried: <b>{{ range $i, $account := .Handover.Unmanaged }}{{ if $i }}, {{ end }}{{ $account }}{{ end }}</b>.
+Please review these accounts by hand.
+</p>
+{{ end }}
+
+{{ if gt (len .Handover.Items) 0 }}
+	<h3>Resources</h3>
+	<p>
+	Resources marked <span style="background-color: #c9fc99;">in green</span> are kept.
+	</p>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Kind</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+			<th><strong>Status</strong></th>
+		</tr>
+	{{ range $i, $item := .Handover.Items }}
+		<tr {{ if or (eq $item.Status "whitelisted") (eq $item.Status "reassigned") }}style="background-color: #c9fc99;"{{ else if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ $item.Resource.Owner }}</td>
+			<td>{{ $item.Resource.Location }}</td>
+			<td>{{ $item.Kind }}</td>
+			<td>{{ $item.Resource.ID }}</td>
+			<td>{{ fdate $item.Resource.CreationTime "2006-01-02" }} ({{ daysrunning $item.Resource.CreationTime }})</td>
+			<td>{{ accucost $item.Resource }}</td>
+			<td>
+			{{- if eq $item.Status "reassigned" }}Reassigned to {{ $item.NewOwner }}
+			{{- else if eq $item.Status "whitelisted" }}Whitelisted
+			{{- else if eq $item.Status "in-use" }}In use, marked for cleanup once it's no longer used
+			{{- else if eq $item.Status "marked" }}<b>Deleted {{ if $item.CleanupAt.IsZero }}soon{{ else }}on {{ fdate $item.CleanupAt "2006-01-02" }}{{ end }}</b>
+			{{- else }}Marked for cleanup on {{ fdate $item.CleanupAt "2006-01-02" }}{{ end -}}
+			</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+`
+
+const approvalMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>Deletions awaiting your approval</h2>
+<p>
+HouseKeeper is about to delete the resources listed below, from accounts owned by your team. These
+resources are expensive, large or old enough that their deletion needs your approval, and <b>they
+will not be deleted until you approve it</b>. Please check with the owner of each resource whether
+it's still needed, and approve or decline its deletion using the links below.
+</p>
+
+<p>
+Declined resources are kept, but will be sent to you again if they're marked for deletion later on.
+To keep a resource for good, ask its owner to whitelist it.
+</p>
+
+<p>
+Read more about how HouseKeeper works and how to better tag your resources at
+<a href="https://wiki.int.brkt.com/display/eng/HouseKeeper+-+Automated+Cleanup+of+cloud+resources">this Wiki page</a>.
+</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Owner</strong></th>
+		<th><strong>Account</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Kind</strong></th>
+		<th><strong>ID</strong></th>
+		<th><strong>Monthly cost</strong></th>
+		<th><strong>Reason</strong></th>
+		<th><strong>Decision</strong></th>
+	</tr>
+{{ range $i, $request := .Requests }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td>{{ index $.Employees $request.Account }}</td>
+		<td>{{ $request.Account }}</td>
+		<td>{{ $request.Location }}</td>
+		<td>{{ $request.Kind }}</td>
+		<td>{{ $request.ID }}</td>
+		<td>${{ printf "%.2f" $request.MonthlyCost }}</td>
+		<td>{{ $request.Reason }}</td>
+		<td><a href="{{ $request.ApproveLink }}">Approve</a> | <a href="{{ $request.DeclineLink }}">Decline</a></td>
+	</tr>
+{{ end }}
+</table>
+`
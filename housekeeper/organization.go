@@ -12,6 +12,7 @@ import (
 	"brkt/cloudsweeper/cloud"
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // Organization represents the employees,
@@ -64,10 +65,12 @@ type Employees []*Employee
 
 // AWSAccount represents an account in AWS. An account
 // can have automatic cleanup enabled, indiacated by
-// the HouseKeeperEnabled attribute.
+// the HouseKeeperEnabled attribute. The environment
+// describes what the account is used for, e.g. "prod".
 type AWSAccount struct {
 	ID                 string `json:"id"`
 	HouseKeeperEnabled bool   `json:"housekeeper_enabled,omitempty"`
+	Environment        string `json:"environment,omitempty"`
 }
 
 // AWSAccounts is a list of AWSAccount
@@ -75,10 +78,12 @@ type AWSAccounts []*AWSAccount
 
 // GCPProject represents a project in GPC. A project
 // can have automatic cleanup enabled, indiacated by
-// the HouseKeeperEnabled attribute.
+// the HouseKeeperEnabled attribute. The environment
+// describes what the project is used for, e.g. "prod".
 type GCPProject struct {
 	ID                 string `json:"id"`
 	HouseKeeperEnabled bool   `json:"housekeeper_enabled,omitempty"`
+	Environment        string `json:"environment,omitempty"`
 }
 
 // GCPProjects is a list of GCPProject
@@ -166,6 +171,60 @@ func (org *Organization) EnabledAccounts(csp cloud.CSP) []string {
 	return accounts
 }
 
+// EnabledAccountsInEnvironments will return a list of all housekeeper enabled
+// accounts in the specified CSP, which belong to any of the specified environments
+func (org *Organization) EnabledAccountsInEnvironments(csp cloud.CSP, environments ...string) []string {
+	accounts := []string{}
+	envMapping := org.AccountToEnvironmentMapping(csp)
+	for _, account := range org.EnabledAccounts(csp) {
+		for _, env := range environments {
+			if strings.ToLower(envMapping[account]) == strings.ToLower(env) {
+				accounts = append(accounts, account)
+				break
+			}
+		}
+	}
+	return accounts
+}
+
+// AccountToEnvironmentMapping is a helper method that maps accounts to their
+// environment. Accounts without an environment are mapped to an empty string.
+func (org *Organization) AccountToEnvironmentMapping(csp cloud.CSP) map[string]string {
+	result := make(map[string]string)
+	for _, employee := range org.Employees {
+		switch csp {
+		case cloud.AWS:
+			for _, account := range employee.AWSAccounts {
+				result[account.ID] = account.Environment
+			}
+		case cloud.GCP:
+			for _, project := range employee.GCPProjects {
+				result[project.ID] = project.Environment
+			}
+		}
+	}
+	return result
+}
+
+// AccountToDepartmentMapping is a helper method that maps accounts to the
+// department ID of their owner
+func (org *Organization) AccountToDepartmentMapping(csp cloud.CSP) map[string]string {
+	result := make(map[string]string)
+	for _, employee := range org.Employees {
+		switch csp {
+		case cloud.AWS:
+			for _, account := range employee.AWSAccounts {
+				result[account.ID] = employee.DepartmentID
+			}
+		case cloud.GCP:
+			for _, project := range employee.GCPProjects {
+				result[project.ID] = employee.DepartmentID
+			}
+		}
+	}
+	return result
+}
+
 // AccountToUserMapping is a helper method that maps accounts to their owners
 // username. This is useful for sending out emails to the owner of an account.
 func (org *Organization) AccountToUserMapping(csp cloud.CSP) map[string]string {
@@ -189,3 +248,46 @@ func (org *Organization) AccountToUserMapping(csp cloud.CSP) map[string]string {
 func (org *Organization) UsernameToEmployeeMapping() map[string]*Employee {
 	return org.employeeMapping
 }
+
+// DisabledEmployees returns the employees who are no longer active in
+// the company
+func (org *Organization) DisabledEmployees() Employees {
+	disabled := Employees{}
+	for _, employee := range org.Employees {
+		if employee.Disabled {
+			disabled = append(disabled, employee)
+		}
+	}
+	return disabled
+}
+
+// Accounts returns the IDs of all the employee's accounts in the
+// specified CSP
+func (e *Employee) Accounts(csp cloud.CSP) []string {
+	return e.accounts(csp, false)
+}
+
+// EnabledAccounts returns the IDs of the employee's housekeeper enabled
+// accounts in the specified CSP
+func (e *Employee) EnabledAccounts(csp cloud.CSP) []string {
+	return e.accounts(csp, true)
+}
+
+func (e *Employee) accounts(csp cloud.CSP, enabledOnly bool) []string {
+	accounts := []string{}
+	switch csp {
+	case cloud.AWS:
+		for _, account := range e.AWSAccounts {
+			if account.HouseKeeperEnabled || !enabledOnly {
+				accounts = append(accounts, account.ID)
+			}
+		}
+	case cloud.GCP:
+		for _, project := range e.GCPProjects {
+			if project.HouseKeeperEnabled || !enabledOnly {
+				accounts = append(accounts, project.ID)
+			}
+		}
+	}
+	return accounts
+}
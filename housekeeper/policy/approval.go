@@ -0,0 +1,82 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package policy
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	"fmt"
+	"strings"
+)
+
+// Approval requires the manager of an account's owner to approve the
+// deletion of resources that are too expensive, large or old to delete
+// on the owner's silence alone. A resource requires approval if it
+// reaches any of the thresholds, and thresholds that are zero are not
+// enforced. For example:
+//
+//	"approval": {
+//	  "min_monthly_cost": 500,
+//	  "min_size_gb": 1000,
+//	  "min_age_days": 365
+//	}
+//
+// Deletions that require approval are held back until the manager has
+// approved them.
+type Approval struct {
+	// MinMonthlyCost is the monthly cost, in USD, of resources that
+	// require approval
+	MinMonthlyCost float64 `json:"min_monthly_cost,omitempty"`
+	MinSizeGB      float64 `json:"min_size_gb,omitempty"`
+	MinAgeDays     int     `json:"min_age_days,omitempty"`
+}
+
+// Requires checks if deleting a resource requires approval, given how
+// much it costs per month
+func (a *Approval) Requires(r cloud.Resource, monthlyCost float64) bool {
+	if a.MinMonthlyCost > 0 && monthlyCost >= a.MinMonthlyCost {
+		return true
+	}
+	if a.MinSizeGB > 0 && sizeGB(r) >= a.MinSizeGB {
+		return true
+	}
+	return a.MinAgeDays > 0 && filter.OlderThanXDays(a.MinAgeDays)(r)
+}
+
+// sizeGB returns the size of a resource, or 0 for resources without one
+// such as instances
+func sizeGB(r cloud.Resource) float64 {
+	switch r := r.(type) {
+	case cloud.Bucket:
+		return r.TotalSizeGB()
+	case interface{ SizeGB() int64 }:
+		return float64(r.SizeGB())
+	}
+	return 0
+}
+
+func (a *Approval) validate() []string {
+	errs := []string{}
+	if a.MinMonthlyCost < 0 || a.MinSizeGB < 0 || a.MinAgeDays < 0 {
+		errs = append(errs, "approval thresholds can't be negative")
+	}
+	return errs
+}
+
+func (a *Approval) describe() string {
+	thresholds := []string{}
+	if a.MinMonthlyCost > 0 {
+		thresholds = append(thresholds, fmt.Sprintf("$%.2f per month", a.MinMonthlyCost))
+	}
+	if a.MinSizeGB > 0 {
+		thresholds = append(thresholds, fmt.Sprintf("%g GB", a.MinSizeGB))
+	}
+	if a.MinAgeDays > 0 {
+		thresholds = append(thresholds, fmt.Sprintf("%d days old", a.MinAgeDays))
+	}
+	if len(thresholds) == 0 {
+		return "Manager approval: never required"
+	}
+	return "Manager approval required from: " + strings.Join(thresholds, ", or ")
+}
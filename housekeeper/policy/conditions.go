@@ -0,0 +1,313 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package policy
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Condition is a single check in a rule. Rule is the name of the
+// check to perform, and the remaining fields are parameters to it.
+// Which parameters are required depend on the check.
+type Condition struct {
+	Rule    string   `json:"rule"`
+	Negate  bool     `json:"negate,omitempty"`
+	Hours   int      `json:"hours,omitempty"`
+	Days    int      `json:"days,omitempty"`
+	Months  int      `json:"months,omitempty"`
+	Years   int      `json:"years,omitempty"`
+	Key     string   `json:"key,omitempty"`
+	Value   string   `json:"value,omitempty"`
+	Pattern string   `json:"pattern,omitempty"`
+	Number  *float64 `json:"number,omitempty"`
+	Date    string   `json:"date,omitempty"`
+}
+
+func (c *Condition) String() string {
+	params := []string{}
+	if c.Hours != 0 {
+		params = append(params, fmt.Sprintf("hours=%d", c.Hours))
+	}
+	if c.Days != 0 {
+		params = append(params, fmt.Sprintf("days=%d", c.Days))
+	}
+	if c.Months != 0 {
+		params = append(params, fmt.Sprintf("months=%d", c.Months))
+	}
+	if c.Years != 0 {
+		params = append(params, fmt.Sprintf("years=%d", c.Years))
+	}
+	if c.Key != "" {
+		params = append(params, fmt.Sprintf("key=%s", c.Key))
+	}
+	if c.Value != "" {
+		params = append(params, fmt.Sprintf("value=%s", c.Value))
+	}
+	if c.Pattern != "" {
+		params = append(params, fmt.Sprintf("pattern=%s", c.Pattern))
+	}
+	if c.Number != nil {
+		params = append(params, fmt.Sprintf("number=%g", *c.Number))
+	}
+	if c.Date != "" {
+		params = append(params, fmt.Sprintf("date=%s", c.Date))
+	}
+	s := c.Rule
+	if len(params) > 0 {
+		s = fmt.Sprintf("%s(%s)", s, strings.Join(params, ", "))
+	}
+	if c.Negate {
+		s = "not " + s
+	}
+	return s
+}
+
+// ruleKind returns the kind of resource a compiled condition is limited
+// to, or an empty string if it applies to all resources
+func ruleKind(rule interface{}) string {
+	switch rule.(type) {
+	case func(cloud.Instance) bool:
+		return KindInstance
+	case func(cloud.Volume) bool:
+		return KindVolume
+	case func(cloud.Snapshot) bool:
+		return KindSnapshot
+	case func(cloud.Image) bool:
+		return KindImage
+	case func(cloud.Bucket) bool:
+		return KindBucket
+	default:
+		return ""
+	}
+}
+
+// checkBuilder compiles a condition into a rule, which can be used
+// with the filter.And, filter.Or and filter.Not functions
+type checkBuilder func(c *Condition) (interface{}, error)
+
+// checks holds all conditions that can be used in a policy
+var checks = map[string]checkBuilder{
+	"older_than_hours": func(c *Condition) (interface{}, error) {
+		if c.Hours <= 0 {
+			return nil, errPositive("hours")
+		}
+		return filter.OlderThanXHours(c.Hours), nil
+	},
+	"older_than_days": func(c *Condition) (interface{}, error) {
+		if c.Days <= 0 {
+			return nil, errPositive("days")
+		}
+		return filter.OlderThanXDays(c.Days), nil
+	},
+	"older_than_months": func(c *Condition) (interface{}, error) {
+		if c.Months <= 0 {
+			return nil, errPositive("months")
+		}
+		return filter.OlderThanXMonths(c.Months), nil
+	},
+	"older_than_years": func(c *Condition) (interface{}, error) {
+		if c.Years <= 0 {
+			return nil, errPositive("years")
+		}
+		return filter.OlderThanXYears(c.Years), nil
+	},
+	"untagged": func(c *Condition) (interface{}, error) {
+		return func(r cloud.Resource) bool {
+			return len(r.Tags()) == 0
+		}, nil
+	},
+	"has_tag": func(c *Condition) (interface{}, error) {
+		if c.Key == "" {
+			return nil, errRequired("key")
+		}
+		return filter.HasTag(c.Key), nil
+	},
+	"released": func(c *Condition) (interface{}, error) {
+		// The key is looked up when the policy is compiled, after the
+		// tag keys have been configured
+		return filter.HasTag(filter.ReleaseTagKey), nil
+	},
+	"name_contains": func(c *Condition) (interface{}, error) {
+		if c.Value == "" {
+			return nil, errRequired("value")
+		}
+		return filter.NameContains(c.Value), nil
+	},
+	"tag_equals": func(c *Condition) (interface{}, error) {
+		if c.Key == "" {
+			return nil, errRequired("key")
+		}
+		return filter.TagEquals(c.Key, c.Value), nil
+	},
+	"tag_matches": func(c *Condition) (interface{}, error) {
+		if c.Key == "" || c.Pattern == "" {
+			return nil, errRequired("key and pattern")
+		}
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %s", err)
+		}
+		return filter.TagMatchesRegexp(c.Key, re), nil
+	},
+	"tag_glob": func(c *Condition) (interface{}, error) {
+		if c.Key == "" || c.Pattern == "" {
+			return nil, errRequired("key and pattern")
+		}
+		if _, err := path.Match(c.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern: %s", err)
+		}
+		return filter.TagMatchesGlob(c.Key, c.Pattern), nil
+	},
+	"tag_above": func(c *Condition) (interface{}, error) {
+		if c.Key == "" || c.Number == nil {
+			return nil, errRequired("key and number")
+		}
+		return filter.TagNumberAbove(c.Key, *c.Number), nil
+	},
+	"tag_below": func(c *Condition) (interface{}, error) {
+		if c.Key == "" || c.Number == nil {
+			return nil, errRequired("key and number")
+		}
+		return filter.TagNumberBelow(c.Key, *c.Number), nil
+	},
+	"tag_before": func(c *Condition) (interface{}, error) {
+		if c.Key == "" || c.Date == "" {
+			return nil, errRequired("key and date")
+		}
+		date, err := filter.ParseTagTime(c.Date)
+		if err != nil {
+			return nil, err
+		}
+		return filter.TagDateBefore(c.Key, date), nil
+	},
+	"tag_after": func(c *Condition) (interface{}, error) {
+		if c.Key == "" || c.Date == "" {
+			return nil, errRequired("key and date")
+		}
+		date, err := filter.ParseTagTime(c.Date)
+		if err != nil {
+			return nil, err
+		}
+		return filter.TagDateAfter(c.Key, date), nil
+	},
+	"tag_older_than_days": func(c *Condition) (interface{}, error) {
+		if c.Key == "" {
+			return nil, errRequired("key")
+		}
+		if c.Days <= 0 {
+			return nil, errPositive("days")
+		}
+		return filter.TagDateOlderThanXDays(c.Key, c.Days), nil
+	},
+	"tag_missing_or_empty": func(c *Condition) (interface{}, error) {
+		if c.Key == "" {
+			return nil, errRequired("key")
+		}
+		return filter.TagMissingOrEmpty(c.Key), nil
+	},
+	"public": func(c *Condition) (interface{}, error) {
+		return filter.IsPublic(), nil
+	},
+	"unencrypted": func(c *Condition) (interface{}, error) {
+		return filter.IsUnencrypted(), nil
+	},
+	"daily_cost_above": func(c *Condition) (interface{}, error) {
+		if c.Number == nil {
+			return nil, errRequired("number")
+		}
+		return filter.DailyCostAbove(*c.Number), nil
+	},
+	"accumulated_cost_above": func(c *Condition) (interface{}, error) {
+		if c.Number == nil {
+			return nil, errRequired("number")
+		}
+		return filter.AccumulatedCostAbove(*c.Number), nil
+	},
+	"tagged_for_cleanup": func(c *Condition) (interface{}, error) {
+		return filter.TaggedForCleanup(), nil
+	},
+	"lifetime_exceeded": func(c *Condition) (interface{}, error) {
+		return filter.LifetimeExceeded(), nil
+	},
+	"expiry_passed": func(c *Condition) (interface{}, error) {
+		return filter.ExpiryDatePassed(), nil
+	},
+	"delete_at_passed": func(c *Condition) (interface{}, error) {
+		return filter.DeleteAtPassed(), nil
+	},
+	"malformed_tags": func(c *Condition) (interface{}, error) {
+		return filter.HasMalformedTags(), nil
+	},
+	"running": func(c *Condition) (interface{}, error) {
+		return filter.IsRunning(), nil
+	},
+	"stopped": func(c *Condition) (interface{}, error) {
+		return filter.IsStopped(), nil
+	},
+	"stopped_for_days": func(c *Condition) (interface{}, error) {
+		if c.Days <= 0 {
+			return nil, errPositive("days")
+		}
+		return filter.StoppedForXDays(c.Days), nil
+	},
+	"unattached": func(c *Condition) (interface{}, error) {
+		return filter.IsUnattached(), nil
+	},
+	"in_use": func(c *Condition) (interface{}, error) {
+		return filter.IsInUse(), nil
+	},
+	"not_modified_in_days": func(c *Condition) (interface{}, error) {
+		if c.Days <= 0 {
+			return nil, errPositive("days")
+		}
+		return filter.NotModifiedInXDays(c.Days), nil
+	},
+}
+
+// Conditions returns the names of all conditions that can be used
+// in a policy, in alphabetical order
+func Conditions() []string {
+	names := []string{}
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compile compiles the condition into a filter. A condition which is
+// specific to a kind of resource must be used in a rule that applies
+// to that kind, as it would otherwise have no effect.
+func (c *Condition) compile(kinds []string) (*filter.ResourceFilter, error) {
+	builder, ok := checks[c.Rule]
+	if !ok {
+		return nil, fmt.Errorf("unknown condition")
+	}
+	rule, err := builder(c)
+	if err != nil {
+		return nil, err
+	}
+	if kind := ruleKind(rule); kind != "" && !containsString(kinds, kind) {
+		return nil, fmt.Errorf("only applies to %s resources, which the rule doesn't include", kind)
+	}
+	if c.Negate {
+		rule = filter.Not(rule)
+	}
+	// Naming the condition makes it show up in evaluation traces
+	return filter.Named(c.String(), rule), nil
+}
+
+func errRequired(param string) error {
+	return fmt.Errorf("%s is required", param)
+}
+
+func errPositive(param string) error {
+	return fmt.Errorf("%s must be a positive number", param)
+}
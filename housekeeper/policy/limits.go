@@ -0,0 +1,100 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Limits are guardrails for how much a single cleanup run may delete, so
+// that a bad rule or clock skew can't wipe out an account. Limits that are
+// zero are not enforced. For example:
+//
+//	"limits": {
+//	  "max_deletions": 200,
+//	  "max_deletions_per_account": 50,
+//	  "max_deletions_per_kind": {"instance": 20},
+//	  "max_monthly_cost": 5000,
+//	  "max_account_percent": 50,
+//	  "min_account_resources": 10
+//	}
+//
+// Deletions beyond the count and cost limits are held back until the next
+// run. If any account would lose more than MaxAccountPercent of its
+// resources, nothing at all is deleted. Accounts with fewer resources than
+// MinAccountResources are not checked against MaxAccountPercent, since a
+// single deletion is a large share of a small account.
+type Limits struct {
+	MaxDeletions           int            `json:"max_deletions,omitempty"`
+	MaxDeletionsPerAccount int            `json:"max_deletions_per_account,omitempty"`
+	MaxDeletionsPerKind    map[string]int `json:"max_deletions_per_kind,omitempty"`
+	// MaxMonthlyCost is the maximum total monthly cost, in USD, of the
+	// resources deleted in a run
+	MaxMonthlyCost    float64 `json:"max_monthly_cost,omitempty"`
+	MaxAccountPercent float64 `json:"max_account_percent,omitempty"`
+	// MinAccountResources defaults to DefaultMinAccountResources when
+	// it's not set
+	MinAccountResources int `json:"min_account_resources,omitempty"`
+}
+
+// DefaultMinAccountResources is the number of resources an account needs
+// before MaxAccountPercent applies to it, unless the limits set another
+const DefaultMinAccountResources = 10
+
+// AccountPercentApplies checks if MaxAccountPercent applies to an account
+// with the specified number of resources
+func (l *Limits) AccountPercentApplies(resources int) bool {
+	return l.MaxAccountPercent > 0 && resources >= l.minAccountResources()
+}
+
+func (l *Limits) minAccountResources() int {
+	if l.MinAccountResources == 0 {
+		return DefaultMinAccountResources
+	}
+	return l.MinAccountResources
+}
+
+func (l *Limits) validate() []string {
+	errs := []string{}
+	if l.MaxDeletions < 0 || l.MaxDeletionsPerAccount < 0 || l.MaxMonthlyCost < 0 || l.MinAccountResources < 0 {
+		errs = append(errs, "limits can't be negative")
+	}
+	for kind, max := range l.MaxDeletionsPerKind {
+		if !containsString(validKinds, kind) {
+			errs = append(errs, fmt.Sprintf("invalid kind \"%s\" in max_deletions_per_kind", kind))
+		} else if max < 0 {
+			errs = append(errs, fmt.Sprintf("max_deletions_per_kind for %s can't be negative", kind))
+		}
+	}
+	if l.MaxAccountPercent < 0 || l.MaxAccountPercent > 100 {
+		errs = append(errs, "max_account_percent must be between 0 and 100")
+	}
+	return errs
+}
+
+func (l *Limits) describe() string {
+	s := "Limits per run:"
+	if l.MaxDeletions > 0 {
+		s += fmt.Sprintf(" %d deletions,", l.MaxDeletions)
+	}
+	if l.MaxDeletionsPerAccount > 0 {
+		s += fmt.Sprintf(" %d deletions per account,", l.MaxDeletionsPerAccount)
+	}
+	for _, kind := range validKinds {
+		if max, ok := l.MaxDeletionsPerKind[kind]; ok && max > 0 {
+			s += fmt.Sprintf(" %d %s deletions,", max, kind)
+		}
+	}
+	if l.MaxMonthlyCost > 0 {
+		s += fmt.Sprintf(" $%.2f per month,", l.MaxMonthlyCost)
+	}
+	if l.MaxAccountPercent > 0 {
+		s += fmt.Sprintf(" %g%% of an account with at least %d resources,", l.MaxAccountPercent, l.minAccountResources())
+	}
+	if strings.HasSuffix(s, ":") {
+		return "No limits per run"
+	}
+	return strings.TrimSuffix(s, ",")
+}
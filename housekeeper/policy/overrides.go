@@ -0,0 +1,168 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package policy
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Override changes the policy for the accounts it selects. An account is
+// selected if its ID, department or environment is listed. For example,
+// to give CI accounts a short default lifetime and exempt perf-lab
+// accounts from all volume rules:
+//
+//	"overrides": [
+//	  {"name": "ci", "environments": ["ci"], "default_lifetime_days": 3},
+//	  {"name": "perf-lab", "departments": ["perf"], "exclude_kinds": ["volume"]}
+//	]
+//
+// Rules can also be excluded by name, or added. When several overrides
+// select the same account, they're applied in order.
+type Override struct {
+	Name         string   `json:"name"`
+	Accounts     []string `json:"accounts,omitempty"`
+	Departments  []string `json:"departments,omitempty"`
+	Environments []string `json:"environments,omitempty"`
+
+	CostThreshold       *float64 `json:"cost_threshold,omitempty"`
+	DefaultLifetimeDays *int     `json:"default_lifetime_days,omitempty"`
+	ExcludeRules        []string `json:"exclude_rules,omitempty"`
+	ExcludeKinds        []string `json:"exclude_kinds,omitempty"`
+	Rules               []*Rule  `json:"rules,omitempty"`
+}
+
+// Account describes the account a policy is resolved for
+type Account struct {
+	ID          string
+	Department  string
+	Environment string
+}
+
+// For resolves the policy to use for an account, by applying all
+// overrides that select it. The returned policy has no overrides. Limits
+// and the release lifecycle apply to a whole run, so they can't be
+// overridden.
+func (p *Policy) For(account Account) *Policy {
+	resolved := &Policy{
+		CostThreshold:       p.CostThreshold,
+		DefaultLifetimeDays: p.DefaultLifetimeDays,
+		Limits:              p.Limits,
+		Approval:            p.Approval,
+		Release:             p.Release,
+		Rules:               p.Rules,
+	}
+	for _, o := range p.Overrides {
+		if o.selects(account) {
+			o.apply(resolved)
+		}
+	}
+	return resolved
+}
+
+func (o *Override) selects(account Account) bool {
+	if containsString(o.Accounts, account.ID) {
+		return true
+	}
+	for _, dep := range o.Departments {
+		if account.Department != "" && strings.ToLower(dep) == strings.ToLower(account.Department) {
+			return true
+		}
+	}
+	for _, env := range o.Environments {
+		if account.Environment != "" && strings.ToLower(env) == strings.ToLower(account.Environment) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply changes a resolved policy according to the override. Rules are
+// copied rather than modified, as they're shared with the original policy.
+func (o *Override) apply(pol *Policy) {
+	if o.CostThreshold != nil {
+		pol.CostThreshold = *o.CostThreshold
+	}
+	if o.DefaultLifetimeDays != nil {
+		pol.DefaultLifetimeDays = *o.DefaultLifetimeDays
+	}
+	rules := []*Rule{}
+	for _, rule := range pol.Rules {
+		if containsString(o.ExcludeRules, rule.Name) {
+			continue
+		}
+		kinds := []string{}
+		for _, kind := range rule.Kinds {
+			if !containsString(o.ExcludeKinds, kind) {
+				kinds = append(kinds, kind)
+			}
+		}
+		if len(kinds) == 0 {
+			continue
+		}
+		if len(kinds) < len(rule.Kinds) {
+			copied := *rule
+			copied.Kinds = kinds
+			rule = &copied
+		}
+		rules = append(rules, rule)
+	}
+	pol.Rules = append(rules, o.Rules...)
+}
+
+// compile validates the override and compiles its rules. The names of
+// the policy's own rules are needed to validate excluded rules, and all
+// rule names so far to check that the names of added rules are unique.
+func (o *Override) compile(baseRules, names map[string]bool) []string {
+	errs := []string{}
+	if len(o.Accounts) == 0 && len(o.Departments) == 0 && len(o.Environments) == 0 {
+		errs = append(errs, "at least one account, department or environment is required")
+	}
+	if o.CostThreshold != nil && *o.CostThreshold < 0 {
+		errs = append(errs, "cost_threshold can't be negative")
+	}
+	if o.DefaultLifetimeDays != nil && *o.DefaultLifetimeDays < 0 {
+		errs = append(errs, "default_lifetime_days can't be negative")
+	}
+	for _, name := range o.ExcludeRules {
+		if !baseRules[name] {
+			errs = append(errs, fmt.Sprintf("excluded rule \"%s\" is not in the policy", name))
+		}
+	}
+	for _, kind := range o.ExcludeKinds {
+		if !containsString(validKinds, kind) {
+			errs = append(errs, fmt.Sprintf("invalid excluded kind \"%s\"", kind))
+		}
+	}
+	return append(errs, compileRules(o.Rules, names)...)
+}
+
+func (o *Override) describe(b *bytes.Buffer) {
+	fmt.Fprintf(b, "\nOverride %s\n", o.Name)
+	if len(o.Accounts) > 0 {
+		fmt.Fprintf(b, "  Accounts: %s\n", strings.Join(o.Accounts, ", "))
+	}
+	if len(o.Departments) > 0 {
+		fmt.Fprintf(b, "  Departments: %s\n", strings.Join(o.Departments, ", "))
+	}
+	if len(o.Environments) > 0 {
+		fmt.Fprintf(b, "  Environments: %s\n", strings.Join(o.Environments, ", "))
+	}
+	if o.CostThreshold != nil {
+		fmt.Fprintf(b, "  Total cost threshold: $%.2f\n", *o.CostThreshold)
+	}
+	if o.DefaultLifetimeDays != nil {
+		fmt.Fprintf(b, "  Default lifetime: %d days\n", *o.DefaultLifetimeDays)
+	}
+	if len(o.ExcludeRules) > 0 {
+		fmt.Fprintf(b, "  Excludes rules: %s\n", strings.Join(o.ExcludeRules, ", "))
+	}
+	if len(o.ExcludeKinds) > 0 {
+		fmt.Fprintf(b, "  Excludes kinds: %s\n", strings.Join(o.ExcludeKinds, ", "))
+	}
+	for _, rule := range o.Rules {
+		describeRule(b, rule, "  ")
+	}
+}
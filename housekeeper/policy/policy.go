@@ -0,0 +1,383 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package policy describes which resources housekeeper should act on,
+// and how. A policy is a JSON document made up of rules, where every
+// rule is compiled into a filter.ResourceFilter. An example policy:
+//
+//	{
+//	  "cost_threshold": 10.0,
+//	  "rules": [
+//	    {
+//	      "name": "unattached-volumes",
+//	      "kinds": ["volume"],
+//	      "action": "delete",
+//	      "grace_period_days": 4,
+//	      "conditions": [
+//	        {"rule": "unattached"},
+//	        {"rule": "older_than_days", "days": 30},
+//	        {"rule": "released", "negate": true}
+//	      ]
+//	    }
+//	  ]
+//	}
+//
+// All conditions in a rule must match for a resource to be included.
+// Conditions that are specific to a kind of resource, such as "unattached",
+// only apply to resources of that kind.
+package policy
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// The kinds of resources a rule can apply to
+const (
+	KindInstance = "instance"
+	KindVolume   = "volume"
+	KindSnapshot = "snapshot"
+	KindImage    = "image"
+	KindBucket   = "bucket"
+)
+
+// The actions a rule can take on matching resources
+const (
+	// ActionDelete marks resources for deletion after the grace period
+	ActionDelete = "delete"
+	// ActionTag sets the tag specified by the rule on resources
+	ActionTag = "tag"
+	// ActionWarn only reports resources, without changing anything
+	ActionWarn = "warn"
+)
+
+var validKinds = []string{KindInstance, KindVolume, KindSnapshot, KindImage, KindBucket}
+
+// IsKind checks if a string is one of the kinds of resources
+func IsKind(kind string) bool {
+	return containsString(validKinds, kind)
+}
+
+// KindOf returns the kind of a resource
+func KindOf(r cloud.Resource) string {
+	switch r.(type) {
+	case cloud.Instance:
+		return KindInstance
+	case cloud.Volume:
+		return KindVolume
+	case cloud.Snapshot:
+		return KindSnapshot
+	case cloud.Image:
+		return KindImage
+	case cloud.Bucket:
+		return KindBucket
+	default:
+		return ""
+	}
+}
+
+// Policy is a set of rules, together with a total cost threshold. Resources
+// are only marked for deletion in an account if the total cost of the
+// resources to delete reach the threshold. Resources without a lifetime or
+// expiry tag are marked for deletion once they're older than the default
+// lifetime, if one is set. Overrides change the policy for some accounts,
+// see For. Limits restrict how much a cleanup run may delete, approval
+// which deletions a manager must approve, and the release lifecycle how
+// release images are retired.
+type Policy struct {
+	CostThreshold       float64     `json:"cost_threshold"`
+	DefaultLifetimeDays int         `json:"default_lifetime_days,omitempty"`
+	Limits              *Limits     `json:"limits,omitempty"`
+	Approval            *Approval   `json:"approval,omitempty"`
+	Release             *Release    `json:"release,omitempty"`
+	Rules               []*Rule     `json:"rules"`
+	Overrides           []*Override `json:"overrides,omitempty"`
+}
+
+// Rule selects resources of certain kinds using a list of conditions,
+// and describes the action to take on them.
+type Rule struct {
+	Name              string       `json:"name"`
+	Kinds             []string     `json:"kinds"`
+	Action            string       `json:"action"`
+	GracePeriodDays   int          `json:"grace_period_days,omitempty"`
+	TagKey            string       `json:"tag_key,omitempty"`
+	TagValue          string       `json:"tag_value,omitempty"`
+	OverrideWhitelist bool         `json:"override_whitelist,omitempty"`
+	Conditions        []*Condition `json:"conditions"`
+
+	filter *filter.ResourceFilter
+}
+
+// Filter returns the filter compiled from the rule's conditions
+func (r *Rule) Filter() *filter.ResourceFilter {
+	return r.filter
+}
+
+// AppliesTo checks if the rule should be used for the specified kind
+// of resource
+func (r *Rule) AppliesTo(kind string) bool {
+	return containsString(r.Kinds, kind)
+}
+
+// Parse will parse and validate a policy from raw JSON data, and
+// compile all of its rules into filters.
+func Parse(data []byte) (*Policy, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	pol := new(Policy)
+	err := decoder.Decode(pol)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse policy: %s", err)
+	}
+	err = pol.compile()
+	if err != nil {
+		return nil, err
+	}
+	return pol, nil
+}
+
+// Load will read a policy from the specified file. If no file is
+// specified, the default policy is returned.
+func Load(path string) (*Policy, error) {
+	if path == "" {
+		return Default(), nil
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read policy file: %s", err)
+	}
+	return Parse(raw)
+}
+
+// Default returns the policy housekeeper uses when no policy file is
+// specified. It will mark the following for cleanup:
+//   - unattached volumes > 30 days old
+//   - unused/unaccessed buckets > 120 days old
+//   - non-whitelisted AMIs > 6 months
+//   - non-whitelisted snapshots > 6 months
+//   - non-whitelisted volumes > 6 months
+//   - untagged resources > 30 days (this should take care of instances)
+func Default() *Policy {
+	pol, err := Parse([]byte(defaultPolicy))
+	if err != nil {
+		panic(fmt.Sprintf("The default policy should always be valid: %s", err))
+	}
+	return pol
+}
+
+// Describe returns a human readable summary of the policy
+func (p *Policy) Describe() string {
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "Total cost threshold: $%.2f\n", p.CostThreshold)
+	if p.DefaultLifetimeDays > 0 {
+		fmt.Fprintf(b, "Default lifetime: %d days\n", p.DefaultLifetimeDays)
+	}
+	if p.Limits != nil {
+		fmt.Fprintln(b, p.Limits.describe())
+	}
+	if p.Approval != nil {
+		fmt.Fprintln(b, p.Approval.describe())
+	}
+	fmt.Fprintln(b, p.ReleaseLifecycle().describe())
+	for _, rule := range p.Rules {
+		describeRule(b, rule, "")
+	}
+	for _, o := range p.Overrides {
+		o.describe(b)
+	}
+	return b.String()
+}
+
+func describeRule(b *bytes.Buffer, rule *Rule, indent string) {
+	fmt.Fprintf(b, "\n%s%s (%s)\n", indent, rule.Name, strings.Join(rule.Kinds, ", "))
+	switch rule.Action {
+	case ActionDelete:
+		fmt.Fprintf(b, "%s  Action: delete after %d days\n", indent, rule.GracePeriodDays)
+	case ActionTag:
+		fmt.Fprintf(b, "%s  Action: tag with %s=%s\n", indent, rule.TagKey, rule.TagValue)
+	default:
+		fmt.Fprintf(b, "%s  Action: %s\n", indent, rule.Action)
+	}
+	if rule.OverrideWhitelist {
+		fmt.Fprintf(b, "%s  Includes whitelisted resources\n", indent)
+	}
+	for _, cond := range rule.Conditions {
+		fmt.Fprintf(b, "%s  - %s\n", indent, cond)
+	}
+}
+
+// compile will validate the policy and compile all rules into filters.
+// All validation errors are collected and returned together.
+func (p *Policy) compile() error {
+	errs := []string{}
+	if p.CostThreshold < 0 {
+		errs = append(errs, "cost_threshold can't be negative")
+	}
+	if p.DefaultLifetimeDays < 0 {
+		errs = append(errs, "default_lifetime_days can't be negative")
+	}
+	if p.Limits != nil {
+		errs = append(errs, p.Limits.validate()...)
+	}
+	if p.Approval != nil {
+		errs = append(errs, p.Approval.validate()...)
+	}
+	if p.Release != nil {
+		errs = append(errs, p.Release.validate()...)
+	}
+	if len(p.Rules) == 0 {
+		errs = append(errs, "policy has no rules")
+	}
+	names := make(map[string]bool)
+	errs = append(errs, compileRules(p.Rules, names)...)
+	baseRules := make(map[string]bool)
+	for name := range names {
+		baseRules[name] = true
+	}
+	for i, o := range p.Overrides {
+		name := o.Name
+		if name == "" {
+			name = fmt.Sprintf("override #%d", i+1)
+			errs = append(errs, fmt.Sprintf("%s: name is required", name))
+		}
+		for _, err := range o.compile(baseRules, names) {
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Invalid policy:\n\t%s", strings.Join(errs, "\n\t"))
+	}
+	return nil
+}
+
+// compileRules compiles a list of rules, checking that their names are
+// unique among all names already used
+func compileRules(rules []*Rule, names map[string]bool) []string {
+	errs := []string{}
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule #%d", i+1)
+			errs = append(errs, fmt.Sprintf("%s: name is required", name))
+		} else if names[name] {
+			errs = append(errs, fmt.Sprintf("%s: name is used by more than one rule", name))
+		}
+		names[name] = true
+		for _, err := range rule.compile() {
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+	return errs
+}
+
+func (r *Rule) compile() []string {
+	errs := []string{}
+	if len(r.Kinds) == 0 {
+		errs = append(errs, "at least one kind is required")
+	}
+	for _, kind := range r.Kinds {
+		if !containsString(validKinds, kind) {
+			errs = append(errs, fmt.Sprintf("invalid kind \"%s\"", kind))
+		}
+	}
+	switch r.Action {
+	case ActionDelete:
+		if r.GracePeriodDays <= 0 {
+			errs = append(errs, "grace_period_days must be positive for delete actions")
+		}
+	case ActionTag:
+		if r.TagKey == "" {
+			errs = append(errs, "tag_key is required for tag actions")
+		}
+	case ActionWarn:
+	default:
+		errs = append(errs, fmt.Sprintf("invalid action \"%s\"", r.Action))
+	}
+	if len(r.Conditions) == 0 {
+		// A rule without conditions would match everything
+		errs = append(errs, "at least one condition is required")
+	}
+
+	rules := []interface{}{}
+	for _, cond := range r.Conditions {
+		rule, err := cond.compile(r.Kinds)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("condition %s: %s", cond.Rule, err))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	r.filter = filter.Named(r.Name, filter.And(rules...))
+	r.filter.OverrideWhitelist = r.OverrideWhitelist
+	return errs
+}
+
+func containsString(list []string, s string) bool {
+	for i := range list {
+		if list[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
+const defaultPolicy = `{
+	"cost_threshold": 10.0,
+	"rules": [
+		{
+			"name": "untagged",
+			"kinds": ["instance", "snapshot", "image"],
+			"action": "delete",
+			"grace_period_days": 4,
+			"conditions": [
+				{"rule": "untagged"},
+				{"rule": "older_than_days", "days": 30},
+				{"rule": "in_use", "negate": true},
+				{"rule": "tagged_for_cleanup", "negate": true}
+			]
+		},
+		{
+			"name": "old",
+			"kinds": ["volume", "snapshot", "image"],
+			"action": "delete",
+			"grace_period_days": 4,
+			"conditions": [
+				{"rule": "older_than_months", "months": 6},
+				{"rule": "released", "negate": true},
+				{"rule": "in_use", "negate": true},
+				{"rule": "unattached"},
+				{"rule": "tagged_for_cleanup", "negate": true}
+			]
+		},
+		{
+			"name": "unattached",
+			"kinds": ["volume"],
+			"action": "delete",
+			"grace_period_days": 4,
+			"conditions": [
+				{"rule": "unattached"},
+				{"rule": "older_than_days", "days": 30},
+				{"rule": "released", "negate": true},
+				{"rule": "tagged_for_cleanup", "negate": true}
+			]
+		},
+		{
+			"name": "unused-buckets",
+			"kinds": ["bucket"],
+			"action": "delete",
+			"grace_period_days": 4,
+			"conditions": [
+				{"rule": "not_modified_in_days", "days": 120},
+				{"rule": "older_than_days", "days": 7},
+				{"rule": "released", "negate": true},
+				{"rule": "tagged_for_cleanup", "negate": true}
+			]
+		}
+	]
+}`
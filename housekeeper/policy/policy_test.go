@@ -0,0 +1,208 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package policy
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testVolume struct {
+	tags map[string]string
+}
+
+func (v *testVolume) CSP() cloud.CSP                                 { return cloud.AWS }
+func (v *testVolume) Owner() string                                  { return "111" }
+func (v *testVolume) ID() string                                     { return "vol-1" }
+func (v *testVolume) Tags() map[string]string                        { return v.tags }
+func (v *testVolume) Location() string                               { return "us-west-2" }
+func (v *testVolume) Public() bool                                   { return false }
+func (v *testVolume) CreationTime() time.Time                        { return time.Now().AddDate(0, 0, -60) }
+func (v *testVolume) SetTag(key, value string, overwrite bool) error { return nil }
+func (v *testVolume) RemoveTag(key string) error                     { return nil }
+func (v *testVolume) Cleanup() error                                 { return nil }
+func (v *testVolume) SizeGB() int64                                  { return 100 }
+func (v *testVolume) Attached() bool                                 { return false }
+func (v *testVolume) Encrypted() bool                                { return true }
+func (v *testVolume) VolumeType() string                             { return "gp2" }
+
+func TestDefaultPolicy(t *testing.T) {
+	pol := Default()
+	if len(pol.Rules) != 4 {
+		t.Errorf("Expected 4 rules in the default policy, got %d", len(pol.Rules))
+	}
+	for _, rule := range pol.Rules {
+		if rule.Filter() == nil {
+			t.Errorf("Rule %s was not compiled", rule.Name)
+		}
+	}
+	if !pol.Rules[0].AppliesTo(KindInstance) || pol.Rules[0].AppliesTo(KindBucket) {
+		t.Error("Untagged rule applies to the wrong kinds")
+	}
+}
+
+func TestReleasedUsesConfiguredKey(t *testing.T) {
+	keys := filter.DefaultTagKeys()
+	keys.Release = "sweeper-release"
+	filter.SetTagKeys(keys)
+	defer filter.SetTagKeys(filter.DefaultTagKeys())
+
+	unattached := Default().Rules[2]
+	released := &testVolume{map[string]string{"sweeper-release": "5.2"}}
+	legacy := &testVolume{map[string]string{"Release": "5.2"}}
+	matching := filter.Volumes([]cloud.Volume{released, legacy}, unattached.Filter())
+	if len(matching) != 1 || matching[0] != legacy {
+		t.Errorf("Only volumes without the configured release key should match, got %v", matching)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	raw := `{
+		"cost_threshold": 5,
+		"rules": [{
+			"name": "stopped",
+			"kinds": ["instance"],
+			"action": "tag",
+			"tag_key": "stopped-long",
+			"tag_value": "true",
+			"conditions": [{"rule": "stopped_for_days", "days": 14}]
+		}]
+	}`
+	pol, err := Parse([]byte(raw))
+	if err != nil {
+		t.Fatalf("Could not parse valid policy: %s", err)
+	}
+	if pol.CostThreshold != 5 || pol.Rules[0].TagKey != "stopped-long" {
+		t.Error("Policy was not parsed correctly")
+	}
+	if !strings.Contains(pol.Describe(), "stopped_for_days(days=14)") {
+		t.Error("Condition missing from policy description")
+	}
+}
+
+func TestInvalidPolicy(t *testing.T) {
+	invalid := map[string]string{
+		"no rules":          `{"rules": []}`,
+		"unknown field":     `{"rules": [], "foo": 1}`,
+		"unknown kind":      `{"rules": [{"name": "a", "kinds": ["disk"], "action": "warn", "conditions": [{"rule": "public"}]}]}`,
+		"unknown action":    `{"rules": [{"name": "a", "kinds": ["volume"], "action": "stop", "conditions": [{"rule": "public"}]}]}`,
+		"unknown condition": `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "shiny"}]}]}`,
+		"no conditions":     `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": []}]}`,
+		"no grace period":   `{"rules": [{"name": "a", "kinds": ["volume"], "action": "delete", "conditions": [{"rule": "public"}]}]}`,
+		"no tag key":        `{"rules": [{"name": "a", "kinds": ["volume"], "action": "tag", "conditions": [{"rule": "public"}]}]}`,
+		"missing param":     `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "older_than_days"}]}]}`,
+		"bad regexp":        `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "tag_matches", "key": "env", "pattern": "(ci"}]}]}`,
+		"bad glob":          `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "tag_glob", "key": "env", "pattern": "[ci"}]}]}`,
+		"bad date":          `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "tag_before", "key": "built", "date": "soon"}]}]}`,
+		"no number":         `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "tag_above", "key": "build"}]}]}`,
+		"no cost":           `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "daily_cost_above"}]}]}`,
+		"wrong kind":        `{"rules": [{"name": "a", "kinds": ["instance"], "action": "warn", "conditions": [{"rule": "unattached"}]}]}`,
+		"no selector":       `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "public"}]}], "overrides": [{"name": "ci", "exclude_kinds": ["volume"]}]}`,
+		"unknown exclusion": `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "public"}]}], "overrides": [{"name": "ci", "accounts": ["1"], "exclude_rules": ["b"]}]}`,
+		"override rule name": `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "public"}]}], "overrides": [{"name": "ci", "accounts": ["1"],
+			"rules": [{"name": "a", "kinds": ["image"], "action": "warn", "conditions": [{"rule": "public"}]}]}]}`,
+		"bad limit kind": `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "public"}]}], "limits": {"max_deletions_per_kind": {"disk": 1}}}`,
+		"bad percent":    `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "public"}]}], "limits": {"max_account_percent": 150}}`,
+		"bad minimum":    `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "public"}]}], "limits": {"min_account_resources": -1}}`,
+		"bad approval":   `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "public"}]}], "approval": {"min_age_days": -1}}`,
+		"bad stage":      `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "public"}]}], "release": {"stages": [{"stage": "archived", "after_days": 30}]}}`,
+		"stage order": `{"rules": [{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "public"}]}], "release": {"stages": [
+			{"stage": "deleted", "after_days": 30}, {"stage": "private", "after_days": 30}
+		]}}`,
+		"duplicate names": `{"rules": [
+			{"name": "a", "kinds": ["volume"], "action": "warn", "conditions": [{"rule": "public"}]},
+			{"name": "a", "kinds": ["image"], "action": "warn", "conditions": [{"rule": "public"}]}
+		]}`,
+	}
+	for name, raw := range invalid {
+		if _, err := Parse([]byte(raw)); err == nil {
+			t.Errorf("Policy with %s should not be valid", name)
+		}
+	}
+}
+
+func TestValidationCollectsAllErrors(t *testing.T) {
+	raw := `{"rules": [{"name": "a", "kinds": ["disk"], "action": "stop", "conditions": [{"rule": "shiny"}]}]}`
+	_, err := Parse([]byte(raw))
+	if err == nil {
+		t.Fatal("Invalid policy was accepted")
+	}
+	for _, expected := range []string{"invalid kind", "invalid action", "unknown condition"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to contain \"%s\": %s", expected, err)
+		}
+	}
+}
+
+func TestTagConditions(t *testing.T) {
+	raw := `{
+		"rules": [{
+			"name": "old-ci-builds",
+			"kinds": ["instance", "volume"],
+			"action": "delete",
+			"grace_period_days": 2,
+			"conditions": [
+				{"rule": "tag_equals", "key": "env", "value": "ci"},
+				{"rule": "tag_older_than_days", "key": "build-id", "days": 14},
+				{"rule": "tag_glob", "key": "branch", "pattern": "feature/*"},
+				{"rule": "tag_above", "key": "build-number", "number": 0},
+				{"rule": "tag_after", "key": "built", "date": "2018-01-01"},
+				{"rule": "tag_missing_or_empty", "key": "owner", "negate": true}
+			]
+		}]
+	}`
+	pol, err := Parse([]byte(raw))
+	if err != nil {
+		t.Fatalf("Could not parse tag conditions: %s", err)
+	}
+	if !strings.Contains(pol.Describe(), "tag_above(key=build-number, number=0)") {
+		t.Error("A zero number should still be a parameter")
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	raw := `{
+		"cost_threshold": 10,
+		"rules": [
+			{"name": "unattached", "kinds": ["volume"], "action": "delete", "grace_period_days": 4, "conditions": [{"rule": "unattached"}]},
+			{"name": "old", "kinds": ["volume", "image"], "action": "delete", "grace_period_days": 4, "conditions": [{"rule": "older_than_months", "months": 6}]}
+		],
+		"overrides": [
+			{"name": "ci", "environments": ["CI"], "default_lifetime_days": 3, "cost_threshold": 0},
+			{"name": "perf-lab", "departments": ["perf"], "exclude_kinds": ["volume"]},
+			{"name": "sandbox", "accounts": ["123"], "exclude_rules": ["old"],
+				"rules": [{"name": "public", "kinds": ["bucket"], "action": "warn", "conditions": [{"rule": "public"}]}]}
+		]
+	}`
+	pol, err := Parse([]byte(raw))
+	if err != nil {
+		t.Fatalf("Could not parse policy with overrides: %s", err)
+	}
+
+	ci := pol.For(Account{ID: "1", Environment: "ci"})
+	if ci.DefaultLifetimeDays != 3 || ci.CostThreshold != 0 || len(ci.Rules) != 2 {
+		t.Errorf("CI override was not applied: %+v", ci)
+	}
+
+	perf := pol.For(Account{ID: "2", Department: "perf"})
+	if len(perf.Rules) != 1 || perf.Rules[0].Name != "old" || perf.Rules[0].AppliesTo(KindVolume) || !perf.Rules[0].AppliesTo(KindImage) {
+		t.Errorf("Volume rules should be excluded for perf-lab accounts: %+v", perf.Rules)
+	}
+	if !pol.Rules[1].AppliesTo(KindVolume) {
+		t.Error("Overrides should not change the rules of the original policy")
+	}
+
+	sandbox := pol.For(Account{ID: "123", Department: "perf"})
+	if len(sandbox.Rules) != 1 || sandbox.Rules[0].Name != "public" || sandbox.Rules[0].Filter() == nil {
+		t.Errorf("Both perf-lab and sandbox overrides should apply: %+v", sandbox.Rules)
+	}
+
+	other := pol.For(Account{ID: "4", Environment: "dev"})
+	if other.DefaultLifetimeDays != 0 || other.CostThreshold != 10 || len(other.Rules) != 2 || len(other.Overrides) != 0 {
+		t.Errorf("Unselected accounts should use the policy as is: %+v", other)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package policy
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/filter"
+	"fmt"
+	"strings"
+)
+
+// The stages of the release lifecycle, in the order images go through them
+const (
+	// StagePrivate makes the image private
+	StagePrivate = "private"
+	// StageDeprecated deprecates the image, so it can still be used
+	// but shouldn't be used for anything new
+	StageDeprecated = "deprecated"
+	// StageObsolete makes the image obsolete, so it can no longer be
+	// used. AMIs can't be made obsolete, so they stay deprecated.
+	StageObsolete = "obsolete"
+	// StageDeleted deletes the image
+	StageDeleted = "deleted"
+)
+
+var stageOrder = []string{StagePrivate, StageDeprecated, StageObsolete, StageDeleted}
+
+// The account release images were built in before the release lifecycle
+// could be configured
+const defaultReleaseAWSAccount = "164337164081"
+
+// Release is the lifecycle of release images, such as AMIs shared with
+// customers. Images in the listed accounts and projects with the release
+// tag go through the stages in order, each stage entered a number of days
+// after the previous one. The first stage is entered that many days after
+// the image was created. Unless configured otherwise, public release
+// images are made private after 6 months, and deleted 6 months later:
+//
+//	"release": {
+//	  "aws_accounts": ["164337164081"],
+//	  "public_only": true,
+//	  "stages": [
+//	    {"stage": "private", "after_days": 180},
+//	    {"stage": "deleted", "after_days": 180}
+//	  ]
+//	}
+//
+// Only images whose release tag has a certain value are selected if
+// tag_value is set. Only public images enter the lifecycle if
+// public_only is set, and images that have entered it go through the
+// rest of it even once they're private. Stages can be left out, but not
+// reordered.
+type Release struct {
+	AWSAccounts []string `json:"aws_accounts,omitempty"`
+	GCPProjects []string `json:"gcp_projects,omitempty"`
+	// TagKey defaults to the release tag key in use
+	TagKey     string   `json:"tag_key,omitempty"`
+	TagValue   string   `json:"tag_value,omitempty"`
+	PublicOnly bool     `json:"public_only,omitempty"`
+	Stages     []*Stage `json:"stages"`
+}
+
+// Stage is a stage of the release lifecycle
+type Stage struct {
+	Stage     string `json:"stage"`
+	AfterDays int    `json:"after_days"`
+}
+
+// DefaultRelease returns the release lifecycle used when the policy
+// doesn't have one
+func DefaultRelease() *Release {
+	return &Release{
+		AWSAccounts: []string{defaultReleaseAWSAccount},
+		PublicOnly:  true,
+		Stages: []*Stage{
+			{Stage: StagePrivate, AfterDays: 180},
+			{Stage: StageDeleted, AfterDays: 180},
+		},
+	}
+}
+
+// ReleaseLifecycle returns the release lifecycle of the policy, or the
+// default lifecycle if it doesn't have one. A lifecycle without stages
+// disables release image cleanup.
+func (p *Policy) ReleaseLifecycle() *Release {
+	if p.Release == nil {
+		return DefaultRelease()
+	}
+	return p.Release
+}
+
+// Selects checks if an image is a release image
+func (r *Release) Selects(img cloud.Image) bool {
+	key := r.TagKey
+	if key == "" {
+		key = filter.ReleaseTagKey
+	}
+	if r.TagValue == "" {
+		return filter.HasTag(key)(img)
+	}
+	return filter.TagEquals(key, r.TagValue)(img)
+}
+
+// Next returns the stage that follows the specified stage, or nil if
+// there are no more stages. Images that haven't entered any stage yet
+// have the stage "". Stages that are no longer in the lifecycle are
+// still followed by the next stage in the lifecycle.
+func (r *Release) Next(stage string) *Stage {
+	current := stageIndex(stage)
+	for _, s := range r.Stages {
+		if stageIndex(s.Stage) > current {
+			return s
+		}
+	}
+	return nil
+}
+
+func stageIndex(stage string) int {
+	for i, s := range stageOrder {
+		if s == stage {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *Release) validate() []string {
+	errs := []string{}
+	previous := -1
+	for _, s := range r.Stages {
+		index := stageIndex(s.Stage)
+		switch {
+		case index < 0:
+			errs = append(errs, fmt.Sprintf("invalid release stage \"%s\"", s.Stage))
+		case index <= previous:
+			errs = append(errs, fmt.Sprintf("release stage %s is out of order, stages must be in the order %s", s.Stage, strings.Join(stageOrder, ", ")))
+		default:
+			previous = index
+		}
+		if s.AfterDays < 0 {
+			errs = append(errs, fmt.Sprintf("after_days of release stage %s can't be negative", s.Stage))
+		}
+	}
+	return errs
+}
+
+func (r *Release) describe() string {
+	if len(r.Stages) == 0 {
+		return "Release lifecycle: disabled"
+	}
+	stages := []string{}
+	for _, s := range r.Stages {
+		stages = append(stages, fmt.Sprintf("%s after %d days", s.Stage, s.AfterDays))
+	}
+	s := "Release lifecycle: " + strings.Join(stages, ", then ")
+	if r.PublicOnly {
+		s += " (public images only)"
+	}
+	if len(r.AWSAccounts) > 0 {
+		s += fmt.Sprintf("\n  AWS accounts: %s", strings.Join(r.AWSAccounts, ", "))
+	}
+	if len(r.GCPProjects) > 0 {
+		s += fmt.Sprintf("\n  GCP projects: %s", strings.Join(r.GCPProjects, ", "))
+	}
+	return s
+}
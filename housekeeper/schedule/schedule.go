@@ -0,0 +1,93 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package schedule stops and starts instances according to their schedule
+// tag, so that instances which are only needed during business hours
+// aren't running (and billed) the rest of the week.
+package schedule
+
+import (
+	"brkt/cloudsweeper/cloud"
+	"brkt/cloudsweeper/cloud/billing"
+	"brkt/cloudsweeper/cloud/filter"
+	"brkt/cloudsweeper/housekeeper/freeze"
+	"log"
+	"time"
+)
+
+const (
+	hoursPerWeek  = 7 * 24
+	weeksPerMonth = 52.0 / 12.0
+)
+
+// EnforceSchedules will stop running instances that are outside of their
+// scheduled window, and start stopped instances that are within it. The
+// schedule is opted into by the owner, so whitelisted instances are
+// included as well. With dryRun set no instances are stopped or started,
+// the actions are only logged. In both cases the projected monthly savings
+// of all schedules are reported. No instances are stopped during a change
+// freeze, but they're still started.
+func EnforceSchedules(mngr cloud.ResourceManager, dryRun bool) {
+	allInstances := mngr.InstancesPerAccount()
+	w, frozen := freeze.At(time.Now())
+	if frozen {
+		log.Printf("Not stopping any instances during the %s freeze\n", w)
+	}
+
+	stopFilter := filter.New()
+	stopFilter.AddInstanceRule(filter.IsRunning())
+	stopFilter.AddInstanceRule(filter.OutsideSchedule())
+	stopFilter.OverrideWhitelist = true
+
+	startFilter := filter.New()
+	startFilter.AddInstanceRule(filter.IsStopped())
+	startFilter.AddInstanceRule(filter.WithinSchedule())
+	startFilter.OverrideWhitelist = true
+
+	scheduledFilter := filter.Or(filter.OutsideSchedule(), filter.WithinSchedule())
+	scheduledFilter.OverrideWhitelist = true
+
+	totalSavings := 0.0
+	for account, instances := range allInstances {
+		for _, inst := range filter.Instances(instances, stopFilter) {
+			if frozen {
+				log.Printf("%s: Not stopping %s during the %s freeze\n", account, inst.ID(), w.Name)
+			} else if dryRun {
+				log.Printf("%s: Would stop %s, it's outside of its schedule\n", account, inst.ID())
+			} else if err := inst.Stop(); err != nil {
+				log.Printf("%s: Failed to stop %s: %s\n", account, inst.ID(), err)
+			}
+		}
+		for _, inst := range filter.Instances(instances, startFilter) {
+			if dryRun {
+				log.Printf("%s: Would start %s, it's within its schedule\n", account, inst.ID())
+			} else if err := inst.Start(); err != nil {
+				log.Printf("%s: Failed to start %s: %s\n", account, inst.ID(), err)
+			}
+		}
+
+		accountSavings := 0.0
+		for _, inst := range filter.Instances(instances, scheduledFilter) {
+			s, _, _ := filter.GetSchedule(inst)
+			savings := MonthlySavings(inst, s)
+			if dryRun {
+				value, _ := filter.TagValue(inst, filter.ScheduleTagKey)
+				log.Printf("%s: %s runs %.0f hours per week (%s), saving $%.2f per month\n", account, inst.ID(), s.HoursPerWeek(), value, savings)
+			}
+			accountSavings += savings
+		}
+		if accountSavings > 0 {
+			log.Printf("%s: Schedules save an estimated $%.2f per month\n", account, accountSavings)
+		}
+		totalSavings += accountSavings
+	}
+	log.Printf("Schedules save an estimated $%.2f per month in total\n", totalSavings)
+}
+
+// MonthlySavings estimates how much is saved per month by only running an
+// instance during its scheduled hours, compared to running it around the
+// clock. Storage is paid for either way, so only the compute cost is saved.
+func MonthlySavings(inst cloud.Instance, s filter.Schedule) float64 {
+	offHours := hoursPerWeek - s.HoursPerWeek()
+	return billing.InstancePricePerHour(inst) * offHours * weeksPerMonth
+}